@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/importer"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// Bulk-imports registrations for one event from a CSV file. Events are
+// written to the outbox and published by the server's outbox relay.
+func main() {
+	_ = godotenv.Load()
+
+	dbURL := flag.String("db", os.Getenv("DB_URL"), "Postgres URL (default $DB_URL)")
+	eventIDFlag := flag.String("event", "", "Event ID (UUID)")
+	file := flag.String("file", "", "CSV file to import")
+	dryRun := flag.Bool("dry-run", false, "Validate only, do not insert")
+	topic := flag.String("topic", envOr("KAFKA_TOPIC_REG_CREATED", "registration.created"), "Topic for registration.created events")
+	paymentWindow := flag.Int("payment-window", envIntOr("PAYMENT_WINDOW_HOURS", 48), "Default payment window in hours")
+	jsonOut := flag.Bool("json", false, "Print the report as JSON")
+	flag.Parse()
+
+	eventID, err := uuid.Parse(*eventIDFlag)
+	if err != nil {
+		log.Fatalf("invalid -event: %v", err)
+	}
+	if *file == "" {
+		log.Fatalf("-file is required")
+	}
+	if *dbURL == "" {
+		log.Fatalf("-db or DB_URL is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("failed to open %s: %v", *file, err)
+	}
+	defer f.Close()
+
+	pg, err := repository.NewPostgres(*dbURL)
+	if err != nil {
+		log.Fatalf("failed to init postgres: %v", err)
+	}
+	defer pg.Close()
+	pg.DefaultPaymentWindowHours = *paymentWindow
+
+	ctx := repository.WithActor(context.Background(), repository.Actor{ID: "cli:import:" + envOr("USER", "unknown")})
+	report, err := importer.New(pg, *topic).Import(ctx, eventID, f, *dryRun)
+	if err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printReport(report)
+	}
+	if report.InvalidRows > 0 {
+		os.Exit(2)
+	}
+}
+
+func printReport(r *importer.Report) {
+	if r.DryRun {
+		fmt.Println("Dry run, nothing was written")
+	}
+	fmt.Printf("Rows:       %d\n", r.TotalRows)
+	fmt.Printf("Valid:      %d\n", r.ValidRows)
+	fmt.Printf("Invalid:    %d\n", r.InvalidRows)
+	if !r.DryRun {
+		fmt.Printf("Imported:   %d\n", r.Imported)
+		fmt.Printf("Waitlisted: %d\n", r.Waitlisted)
+	}
+	for _, e := range r.Errors {
+		fmt.Printf("  row %d: %s\n", e.Row, e.Error)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envIntOr(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/migrate"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/migrations"
+)
+
+const usage = `usage: migrate [-db URL] <command>
+
+commands:
+  up        apply all pending migrations
+  down [N]  revert the last N applied migrations (default 1)
+  status    list migrations and whether they are applied
+`
+
+// Applies or reverts the embedded SQL migrations.
+func main() {
+	_ = godotenv.Load()
+
+	dbURL := flag.String("db", os.Getenv("DB_URL"), "Postgres URL (default $DB_URL)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *dbURL == "" {
+		log.Fatalf("-db or DB_URL is required")
+	}
+
+	pg, err := repository.NewPostgres(*dbURL)
+	if err != nil {
+		log.Fatalf("failed to init postgres: %v", err)
+	}
+	defer pg.Close()
+
+	m, err := migrate.New(pg.Pool, migrations.FS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.Logf = log.Printf
+	ctx := context.Background()
+
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migration(s) applied\n", n)
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", flag.Arg(1))
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d migration(s) reverted\n", n)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printStatus(statuses)
+	default:
+		log.Printf("unknown command %q", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func printStatus(statuses []migrate.Status) {
+	for _, s := range statuses {
+		state := "pending"
+		if s.AppliedAt != nil {
+			state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case s.Missing:
+			state += " (file missing)"
+		case s.Modified:
+			state += " (modified since applied)"
+		}
+		fmt.Printf("%04d  %-32s %s\n", s.Version, s.Name, state)
+	}
+}
@@ -22,8 +22,8 @@ func main() {
 	// Command-line flags for flexibility
 	broker := flag.String("broker", "localhost:19093", "Kafka broker address")
 	topic := flag.String("topic", "event.status.changed", "Kafka topic")
-	registrationID := flag.String("id", "REG-001", "Registration ID")
-	status := flag.String("status", "confirmed", "Event status (confirmed, cancelled, pending, etc.)")
+	registrationID := flag.String("id", "00000000-0000-0000-0000-000000000001", "Registration ID (UUID)")
+	status := flag.String("status", "confirmed", "Registration status (pending, paid, confirmed, cancelled, rejected)")
 	count := flag.Int("count", 1, "Number of messages to send")
 	flag.Parse()
 
@@ -46,7 +46,7 @@ func main() {
 	for i := 0; i < *count; i++ {
 		// Create event
 		event := EventStatusChanged{
-			RegistrationID: fmt.Sprintf("%s-%d", *registrationID, i+1),
+			RegistrationID: *registrationID,
 			Status:         *status,
 			Timestamp:      time.Now().Format(time.RFC3339),
 		}
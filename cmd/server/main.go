@@ -10,14 +10,23 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 
 	_ "github.com/miftahulhidayati/registration-payment-service/docs" // docs is generated by Swag CLI
 
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
 	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/expiry"
+	"github.com/miftahulhidayati/registration-payment-service/internal/gateway"
 	"github.com/miftahulhidayati/registration-payment-service/internal/http/handlers"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
 	"github.com/miftahulhidayati/registration-payment-service/internal/kafka"
+	"github.com/miftahulhidayati/registration-payment-service/internal/migrate"
+	"github.com/miftahulhidayati/registration-payment-service/internal/outbox"
 	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+	"github.com/miftahulhidayati/registration-payment-service/migrations"
 )
 
 // @title Registration Payment Service API
@@ -25,6 +34,10 @@ import (
 // @description API for managing event registrations and payments.
 // @host localhost:3003
 // @BasePath /api/v1
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT bearer token, e.g. "Bearer eyJ..."
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -37,6 +50,20 @@ func main() {
 		log.Fatalf("failed to init postgres: %v", err)
 	}
 	defer pg.Close()
+	pg.PromotedTopic = cfg.KafkaTopicRegPromoted
+	pg.DefaultPaymentWindowHours = cfg.PaymentWindowHours
+
+	// Apply pending migrations before serving (DB_AUTO_MIGRATE)
+	if cfg.DBAutoMigrate {
+		migrator, err := migrate.New(pg.Pool, migrations.FS)
+		if err != nil {
+			log.Fatalf("failed to load migrations: %v", err)
+		}
+		migrator.Logf = log.Printf
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+	}
 
 	// Init Kafka producer (best-effort)
 	producer, err := kafka.NewProducer(cfg.KafkaBrokers)
@@ -47,14 +74,51 @@ func main() {
 		defer producer.Close()
 	}
 
+	// Init payment proof storage
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to init storage: %v", err)
+	}
+
+	// Init payment gateway (GATEWAY_DRIVER=none disables gateway payments)
+	gw, err := gateway.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to init payment gateway: %v", err)
+	}
+	if _, ok := gw.(*gateway.Mock); ok {
+		log.Printf("WARNING: GATEWAY_DRIVER=mock: charges are paid by a fake gateway and anyone can complete them through /mock-gateway; never enable it in production")
+	}
+
+	// Background workers stop when workerCtx is cancelled on shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Init outbox relay (publishes events committed with DB changes)
+	if producer != nil {
+		relay := outbox.NewRelay(pg, producer, time.Duration(cfg.OutboxPollIntervalMs)*time.Millisecond, cfg.OutboxBatchSize, cfg.OutboxMaxAttempts)
+		go relay.Run(workerCtx)
+	}
+
+	// Expire pending and partially paid registrations that passed their payment
+	// deadline, and purge idempotency keys past their TTL
+	expirer := expiry.NewScheduler(pg, time.Duration(cfg.ExpiryCheckIntervalSeconds)*time.Second, cfg.KafkaTopicRegCancelled, time.Duration(cfg.IdempotencyTTLHours)*time.Hour)
+	go expirer.Run(workerCtx)
+
 	// Init Kafka consumer (event.status.changed)
 	go func() {
-		if err := kafka.StartConsumer(cfg.KafkaBrokers, cfg.KafkaTopicEventStatus, "regpay-consumer-group", pg); err != nil {
+		if err := kafka.StartConsumer(workerCtx, cfg.KafkaBrokers, cfg.KafkaTopicEventStatus, "regpay-consumer-group", pg); err != nil {
 			log.Printf("warning: kafka consumer init failed: %v", err)
 		}
 	}()
 
-	app := fiber.New()
+	// Leave headroom above the upload limit for the other multipart fields
+	bodyLimit := cfg.UploadMaxBytes + 1024*1024
+	if bodyLimit < fiber.DefaultBodyLimit {
+		bodyLimit = fiber.DefaultBodyLimit
+	}
+	app := fiber.New(fiber.Config{BodyLimit: bodyLimit, ErrorHandler: problem.ErrorHandler})
+	// Tags every request with an X-Request-ID (kept if the client sent one)
+	app.Use(requestid.New())
 
 	// Health
 	app.Get("/healthz", func(c *fiber.Ctx) error {
@@ -63,13 +127,51 @@ func main() {
 
 	// API v1 routes
 	api := app.Group("/api/v1")
+	if cfg.AuthEnabled {
+		verifier, err := auth.NewVerifier(auth.VerifierConfig{
+			HMACSecret:    cfg.JWTHMACSecret,
+			PublicKeyFile: cfg.JWTPublicKeyFile,
+			JWKSFile:      cfg.JWTJWKSFile,
+			Issuer:        cfg.JWTIssuer,
+			Audience:      cfg.JWTAudience,
+		})
+		if err != nil {
+			log.Fatalf("failed to init auth: %v", err)
+		}
+		api.Use(auth.Middleware(verifier))
+	} else {
+		log.Printf("warning: AUTH_ENABLED=false, API routes are public")
+	}
 
 	// Swagger
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
 
-	registrations := handlers.NewRegistrationsHandler(pg, producer, cfg)
+	registrations := handlers.NewRegistrationsHandler(pg, pg, pg, pg, store, cfg)
 	registrations.Register(api)
 
+	events := handlers.NewEventsHandler(pg, pg, pg, cfg)
+	events.Register(api)
+
+	vouchers := handlers.NewVouchersHandler(pg, cfg)
+	vouchers.Register(api)
+
+	orders := handlers.NewOrdersHandler(pg, pg, store, cfg)
+	orders.Register(api)
+
+	// Payment and refund proofs, for those allowed to see them
+	files := handlers.NewFilesHandler(pg, pg, store)
+	files.Register(api)
+
+	if gw != nil {
+		charges := handlers.NewChargesHandler(pg, pg, gw, cfg)
+		charges.Register(api)
+		// Webhooks are signed by the gateway and sit outside the JWT-protected API
+		charges.RegisterWebhooks(app)
+		if mock, ok := gw.(*gateway.Mock); ok {
+			mock.Register(app)
+		}
+	}
+
 	// Graceful shutdown
 	go func() {
 		if err := app.Listen(":" + cfg.AppPort); err != nil {
@@ -80,6 +182,7 @@ func main() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
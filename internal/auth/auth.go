@@ -0,0 +1,103 @@
+// Package auth authenticates requests with JWT bearer tokens and carries the
+// caller's identity and roles through the request context.
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+)
+
+const (
+	RoleParticipant     = "participant"
+	RoleFinanceVerifier = "finance-verifier"
+	RoleAdmin           = "admin"
+)
+
+const principalKey = "auth.principal"
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string
+	Roles   []string
+}
+
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, r := range roles {
+		if slices.Contains(p.Roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the caller may act on registrations other than their own.
+func (p *Principal) IsStaff() bool {
+	return p.HasRole(RoleAdmin, RoleFinanceVerifier)
+}
+
+// UserID parses the subject as the user ID stored on registrations.
+func (p *Principal) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(p.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("token subject is not a user id")
+	}
+	return id, nil
+}
+
+// Owns reports whether userID belongs to the caller.
+func (p *Principal) Owns(userID *uuid.UUID) bool {
+	if userID == nil {
+		return false
+	}
+	id, err := p.UserID()
+	return err == nil && id == *userID
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+	Role  string   `json:"role"`
+}
+
+// Middleware rejects requests without a valid bearer token and stores the
+// Principal for downstream handlers.
+func Middleware(v *Verifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get(fiber.HeaderAuthorization)
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			return problem.Respond(c, http.StatusUnauthorized, "missing bearer token")
+		}
+		p, err := v.Verify(token)
+		if err != nil {
+			return problem.Respond(c, http.StatusUnauthorized, "invalid token")
+		}
+		c.Locals(principalKey, p)
+		return c.Next()
+	}
+}
+
+// RequireRole allows the request through only if the caller has one of roles.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p := FromCtx(c)
+		if p == nil || !p.HasRole(roles...) {
+			return problem.Respond(c, http.StatusForbidden, "forbidden")
+		}
+		return c.Next()
+	}
+}
+
+// FromCtx returns the authenticated caller, or nil when auth is disabled.
+func FromCtx(c *fiber.Ctx) *Principal {
+	p, _ := c.Locals(principalKey).(*Principal)
+	return p
+}
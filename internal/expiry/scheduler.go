@@ -0,0 +1,87 @@
+// Package expiry cancels pending and partially paid registrations whose
+// payment deadline passed, and deletes idempotency keys past their TTL.
+package expiry
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+const batchSize = 100
+
+type Scheduler struct {
+	repo           *repository.Postgres
+	interval       time.Duration
+	cancelledTopic string
+	idempotencyTTL time.Duration
+}
+
+func NewScheduler(repo *repository.Postgres, interval time.Duration, cancelledTopic string, idempotencyTTL time.Duration) *Scheduler {
+	return &Scheduler{repo: repo, interval: interval, cancelledTopic: cancelledTopic, idempotencyTTL: idempotencyTTL}
+}
+
+// Run checks for overdue registrations and expired idempotency keys every
+// interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.expire(ctx)
+		s.purgeIdempotencyKeys(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) expire(ctx context.Context) {
+	ctx = repository.WithActor(ctx, repository.Actor{ID: "system:payment-expiry"})
+	for {
+		expired, err := s.repo.ExpireOverdueRegistrations(ctx, batchSize, s.cancelledEvent)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("payment expiry error: %v", err)
+			}
+			return
+		}
+		for _, reg := range expired {
+			log.Printf("registration %s cancelled: %s (due %s)", reg.RegistrationID, repository.PaymentTimeoutReason, reg.PaymentDueAt)
+		}
+		if len(expired) < batchSize {
+			return
+		}
+	}
+}
+
+// purgeIdempotencyKeys deletes idempotency keys past their TTL. Clients
+// send a fresh key with every new request, so expired keys are rarely
+// claimed again and would otherwise pile up.
+func (s *Scheduler) purgeIdempotencyKeys(ctx context.Context) {
+	for {
+		n, err := s.repo.PurgeIdempotencyKeys(ctx, s.idempotencyTTL, batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("idempotency key purge error: %v", err)
+			}
+			return
+		}
+		if n < batchSize {
+			return
+		}
+	}
+}
+
+func (s *Scheduler) cancelledEvent(reg *repository.Registration) []repository.OutboxMessage {
+	return []repository.OutboxMessage{repository.Event(s.cancelledTopic, reg.RegistrationID.String(), "registration.cancelled", map[string]any{
+		"registration_id": reg.RegistrationID,
+		"reason":          repository.PaymentTimeoutReason,
+		"payment_due_at":  reg.PaymentDueAt,
+		"timestamp":       time.Now().UTC().Format(time.RFC3339),
+	})}
+}
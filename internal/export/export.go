@@ -0,0 +1,89 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Writer writes a table row by row. Close flushes any buffered output and
+// must be called once all rows are written.
+type Writer interface {
+	WriteRow(cells []string) error
+	Close() error
+}
+
+// Format describes an output format.
+type Format struct {
+	ContentType string
+	Extension   string
+	New         func(w io.Writer) Writer
+}
+
+var formats = map[string]Format{
+	"csv": {
+		ContentType: "text/csv; charset=utf-8",
+		Extension:   "csv",
+		New:         NewCSV,
+	},
+	"xlsx": {
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		Extension:   "xlsx",
+		New:         NewXLSX,
+	},
+}
+
+// LookupFormat returns the format registered under name.
+func LookupFormat(name string) (Format, error) {
+	f, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("unsupported format %q, expected csv or xlsx", name)
+	}
+	return f, nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSV returns a Writer producing RFC 4180 CSV.
+func NewCSV(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteRow(cells []string) error {
+	safe := make([]string, len(cells))
+	for i, cell := range cells {
+		safe[i] = neutralizeFormula(cell)
+	}
+	return c.w.Write(safe)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// numeric matches cells that are only a number or phone number, such as
+// +62 812-3456-7890 or -15000.00.
+var numeric = regexp.MustCompile(`^[+-]?[0-9 .()-]+$`)
+
+// neutralizeFormula prefixes cells a spreadsheet would evaluate as a formula
+// with a quote. A leading + or - is left alone only when the whole cell is
+// numeric, so phone numbers like +62812... and negative amounts survive while
+// free text such as -1+cmd|... does not.
+func neutralizeFormula(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + s
+	case '+', '-':
+		if !numeric.MatchString(s) {
+			return "'" + s
+		}
+	}
+	return s
+}
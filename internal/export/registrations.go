@@ -0,0 +1,120 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// Column is one exportable registration field.
+type Column struct {
+	Name   string
+	Header string
+	Value  func(*repository.RegistrationExportRow) string
+}
+
+// RegistrationColumns lists every exportable column in default order.
+var RegistrationColumns = []Column{
+	{"registration_id", "Registration ID", func(r *repository.RegistrationExportRow) string { return r.RegistrationID.String() }},
+	{"user_id", "User ID", func(r *repository.RegistrationExportRow) string {
+		if r.UserID == nil {
+			return ""
+		}
+		return r.UserID.String()
+	}},
+	{"full_name", "Full Name", func(r *repository.RegistrationExportRow) string { return r.FullName }},
+	{"gender", "Gender", func(r *repository.RegistrationExportRow) string { return r.Gender }},
+	{"category", "Category", func(r *repository.RegistrationExportRow) string { return str(r.Category) }},
+	{"phone", "Phone", func(r *repository.RegistrationExportRow) string { return r.Phone }},
+	{"email", "Email", func(r *repository.RegistrationExportRow) string { return r.Email }},
+	{"address", "Address", func(r *repository.RegistrationExportRow) string { return str(r.Address) }},
+	{"emergency_contact_name", "Emergency Contact Name", func(r *repository.RegistrationExportRow) string { return str(r.EmergencyContactName) }},
+	{"emergency_contact_phone", "Emergency Contact Phone", func(r *repository.RegistrationExportRow) string { return str(r.EmergencyContactPhone) }},
+	{"emergency_contact_relation", "Emergency Contact Relation", func(r *repository.RegistrationExportRow) string { return str(r.EmergencyContactRelation) }},
+	{"special_needs", "Special Needs", func(r *repository.RegistrationExportRow) string { return str(r.SpecialNeeds) }},
+	{"registration_date", "Registration Date", func(r *repository.RegistrationExportRow) string { return timestamp(&r.RegistrationDate) }},
+	{"status", "Status", func(r *repository.RegistrationExportRow) string { return r.Status }},
+	{"waitlist_position", "Waitlist Position", func(r *repository.RegistrationExportRow) string {
+		if r.WaitlistPosition == nil {
+			return ""
+		}
+		return strconv.Itoa(*r.WaitlistPosition)
+	}},
+	{"payment_due_at", "Payment Due At", func(r *repository.RegistrationExportRow) string { return timestamp(r.PaymentDueAt) }},
+	{"amount_due", "Amount Due", func(r *repository.RegistrationExportRow) string { return amount(r.AmountDue) }},
+	{"voucher_code", "Voucher Code", func(r *repository.RegistrationExportRow) string { return str(r.VoucherCode) }},
+	{"discount_amount", "Discount Amount", func(r *repository.RegistrationExportRow) string { return amount(r.DiscountAmount) }},
+	{"amount_paid", "Amount Paid", func(r *repository.RegistrationExportRow) string { return amount(&r.AmountPaid) }},
+	{"balance", "Balance", func(r *repository.RegistrationExportRow) string { return amount(r.Balance) }},
+	{"payment_status", "Payment Status", func(r *repository.RegistrationExportRow) string { return str(r.PaymentStatus) }},
+	{"payment_amount", "Payment Amount", func(r *repository.RegistrationExportRow) string { return amount(r.PaymentAmount) }},
+	{"payment_method", "Payment Method", func(r *repository.RegistrationExportRow) string { return str(r.PaymentMethod) }},
+	{"payment_date", "Payment Date", func(r *repository.RegistrationExportRow) string { return timestamp(r.PaymentDate) }},
+	{"payment_verified_at", "Payment Verified At", func(r *repository.RegistrationExportRow) string { return timestamp(r.VerifiedAt) }},
+	{"cancelled_at", "Cancelled At", func(r *repository.RegistrationExportRow) string { return timestamp(r.CancelledAt) }},
+	{"cancellation_reason", "Cancellation Reason", func(r *repository.RegistrationExportRow) string { return str(r.CancellationReason) }},
+	{"notes", "Notes", func(r *repository.RegistrationExportRow) string { return str(r.Notes) }},
+}
+
+// SelectColumns returns the named columns in the given order, or all columns
+// when names is empty.
+func SelectColumns(names []string) ([]Column, error) {
+	if len(names) == 0 {
+		return RegistrationColumns, nil
+	}
+	byName := make(map[string]Column, len(RegistrationColumns))
+	for _, col := range RegistrationColumns {
+		byName[col.Name] = col
+	}
+	cols := make([]Column, 0, len(names))
+	for _, name := range names {
+		col, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// Headers returns the header row for cols.
+func Headers(cols []Column) []string {
+	row := make([]string, len(cols))
+	for i, col := range cols {
+		row[i] = col.Header
+	}
+	return row
+}
+
+// Row renders reg as a row of cols.
+func Row(cols []Column, reg *repository.RegistrationExportRow) []string {
+	row := make([]string, len(cols))
+	for i, col := range cols {
+		row[i] = col.Value(reg)
+	}
+	return row
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func amount(a *float64) string {
+	if a == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*a, 'f', 2, 64)
+}
+
+func timestamp(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+)
+
+// Charge statuses reported by webhooks.
+const (
+	StatusPaid    = "paid"
+	StatusExpired = "expired"
+	StatusFailed  = "failed"
+)
+
+// Methods are the payment_method values a gateway collects.
+var Methods = []string{"virtual_account", "qris", "ewallet"}
+
+// PaymentGateway collects payments through a third-party provider. A charge
+// is completed by the payer out of band and its outcome is reported to
+// POST /webhooks/payments/{provider}.
+type PaymentGateway interface {
+	// Provider names the gateway in webhook URLs and stored charges.
+	Provider() string
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	// ParseWebhook verifies the signature of a webhook delivery and decodes
+	// it. header looks up the delivery's request headers.
+	ParseWebhook(header func(string) string, body []byte) (*WebhookEvent, error)
+}
+
+// ChargeRequest asks a gateway to collect Amount. Reference is the service's
+// ID for the charge, echoed back in webhooks.
+type ChargeRequest struct {
+	Reference     string
+	Method        string
+	Amount        float64
+	CustomerName  string
+	CustomerEmail string
+	ExpiresAt     time.Time
+}
+
+// Charge is a charge as the gateway created it. PaymentCode is what the payer
+// pays with: a virtual account number, a QRIS payload or an e-wallet
+// checkout URL.
+type Charge struct {
+	ID          string
+	PaymentCode string
+	ExpiresAt   time.Time
+}
+
+// WebhookEvent reports the outcome of a charge. A redelivered event keeps its
+// EventID, so it can be recognised.
+type WebhookEvent struct {
+	EventID   string     `json:"event_id"`
+	ChargeID  string     `json:"charge_id"`
+	Reference string     `json:"reference"`
+	Status    string     `json:"status"`
+	Amount    float64    `json:"amount"`
+	PaidAt    *time.Time `json:"paid_at,omitempty"`
+}
+
+func (e *WebhookEvent) validate() error {
+	switch {
+	case e.EventID == "" || e.ChargeID == "":
+		return errors.New("invalid webhook payload: event_id and charge_id are required")
+	case e.Status != StatusPaid && e.Status != StatusExpired && e.Status != StatusFailed:
+		return fmt.Errorf("invalid webhook payload: unknown status %q", e.Status)
+	case e.Status == StatusPaid && e.Amount <= 0:
+		return errors.New("invalid webhook payload: a paid charge needs a positive amount")
+	}
+	return nil
+}
+
+// Webhook deliveries are signed with HMAC-SHA256 over "<timestamp>.<body>"
+// using the shared webhook secret.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	// SignatureTolerance bounds the age of a delivery, limiting replays.
+	SignatureTolerance = 5 * time.Minute
+)
+
+// ErrInvalidSignature is returned for deliveries that are unsigned, signed
+// with another secret or too old.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the hex signature of body sent at timestamp (Unix seconds).
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature headers of a delivery of body.
+func VerifySignature(secret []byte, header func(string) string, body []byte, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(header(SignatureHeader))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	want, _ := hex.DecodeString(Sign(secret, timestamp, body))
+	if !hmac.Equal(got, want) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// New builds the PaymentGateway selected by GATEWAY_DRIVER. It returns nil
+// when gateway payments are disabled.
+func New(cfg *config.Config) (PaymentGateway, error) {
+	switch cfg.GatewayDriver {
+	case "none":
+		return nil, nil
+	case "mock":
+		mock, err := NewMock(MockConfig{
+			Secret:      cfg.GatewayWebhookSecret,
+			CallbackURL: cfg.GatewayCallbackURL,
+			PayAfter:    time.Duration(cfg.GatewayMockPayAfterSeconds) * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mock, nil
+	default:
+		return nil, fmt.Errorf("unknown gateway driver %q", cfg.GatewayDriver)
+	}
+}
@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// MockConfig configures a Mock gateway.
+type MockConfig struct {
+	// Secret signs webhook deliveries.
+	Secret string
+	// CallbackURL is the base URL of this service; webhooks are posted to
+	// CallbackURL/webhooks/payments/mock.
+	CallbackURL string
+	// PayAfter is how long after creation a charge is paid. With zero,
+	// charges are only completed through Complete or the routes mounted by
+	// Register.
+	PayAfter time.Duration
+	// Client delivers webhooks; http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// Mock is a local stand-in for a payment gateway. It issues fake virtual
+// account numbers, QRIS payloads and e-wallet checkout links, and reports
+// each charge's outcome back to the service with a signed webhook, as a real
+// provider would.
+type Mock struct {
+	secret      []byte
+	callbackURL string
+	payAfter    time.Duration
+	client      *http.Client
+
+	mu      sync.Mutex
+	charges map[string]*mockCharge
+}
+
+type mockCharge struct {
+	Charge
+	reference string
+	amount    float64
+	status    string
+}
+
+// mockDeliveryAttempts is how often a scheduled webhook is tried before the
+// mock gives up, backing off a second longer each time.
+const mockDeliveryAttempts = 3
+
+func NewMock(cfg MockConfig) (*Mock, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("mock gateway requires a webhook secret")
+	}
+	if cfg.CallbackURL == "" {
+		return nil, errors.New("mock gateway requires a callback URL")
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Mock{
+		secret:      []byte(cfg.Secret),
+		callbackURL: strings.TrimRight(cfg.CallbackURL, "/"),
+		payAfter:    cfg.PayAfter,
+		client:      client,
+		charges:     make(map[string]*mockCharge),
+	}, nil
+}
+
+func (m *Mock) Provider() string { return "mock" }
+
+func (m *Mock) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	id := "mock_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	var code string
+	switch req.Method {
+	case "virtual_account":
+		code = fmt.Sprintf("8808%012d", rand.Int64N(1_000_000_000_000))
+	case "qris":
+		code = "00020101021226590014ID.MOCK.QRIS01" + id + "5303360540" + strconv.FormatFloat(req.Amount, 'f', 2, 64)
+	case "ewallet":
+		code = m.callbackURL + "/mock-gateway/charges/" + id + "/paid"
+	default:
+		return nil, fmt.Errorf("mock gateway does not support payment method %q", req.Method)
+	}
+
+	charge := &mockCharge{
+		Charge:    Charge{ID: id, PaymentCode: code, ExpiresAt: req.ExpiresAt},
+		reference: req.Reference,
+		amount:    req.Amount,
+	}
+	m.mu.Lock()
+	m.charges[id] = charge
+	m.mu.Unlock()
+
+	if m.payAfter > 0 {
+		time.AfterFunc(m.payAfter, func() {
+			if err := m.complete(context.Background(), id, StatusPaid, mockDeliveryAttempts); err != nil {
+				log.Printf("mock gateway: charge %s: %v", id, err)
+			}
+		})
+	}
+	c := charge.Charge
+	return &c, nil
+}
+
+func (m *Mock) ParseWebhook(header func(string) string, body []byte) (*WebhookEvent, error) {
+	if err := VerifySignature(m.secret, header, body, time.Now()); err != nil {
+		return nil, err
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Complete settles a pending charge with status (paid, expired or failed)
+// and delivers the webhook, returning an error unless the service accepted
+// it. A charge cannot be paid after it expired.
+func (m *Mock) Complete(ctx context.Context, chargeID, status string) error {
+	return m.complete(ctx, chargeID, status, 1)
+}
+
+func (m *Mock) complete(ctx context.Context, chargeID, status string, attempts int) error {
+	m.mu.Lock()
+	charge, ok := m.charges[chargeID]
+	switch {
+	case !ok:
+		m.mu.Unlock()
+		return fmt.Errorf("unknown charge %s", chargeID)
+	case charge.status != "" && charge.status != status:
+		m.mu.Unlock()
+		return fmt.Errorf("charge is already %s", charge.status)
+	case status == StatusPaid && !charge.ExpiresAt.IsZero() && time.Now().After(charge.ExpiresAt):
+		m.mu.Unlock()
+		return errors.New("charge has expired")
+	}
+	charge.status = status
+	event := WebhookEvent{
+		EventID:   "evt_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		ChargeID:  charge.ID,
+		Reference: charge.reference,
+		Status:    status,
+	}
+	if status == StatusPaid {
+		now := time.Now().UTC()
+		event.Amount = charge.amount
+		event.PaidAt = &now
+	}
+	m.mu.Unlock()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = m.deliver(ctx, body)
+		if err == nil || attempt == attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+// deliver posts one signed webhook. The same event is redelivered as is, so
+// the service can recognise it by its event_id.
+func (m *Mock) deliver(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.callbackURL+"/webhooks/payments/"+m.Provider(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(m.secret, timestamp, body))
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook rejected with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Register mounts /mock-gateway/charges/:id/:outcome, which completes a
+// charge with outcome paid, expired or failed, for trying the flow by hand.
+// It answers GET as well as POST so the e-wallet checkout link handed out as
+// a payment_code can be opened in a browser. It is unauthenticated and only
+// meant for local setups.
+func (m *Mock) Register(router fiber.Router) {
+	complete := func(c *fiber.Ctx) error {
+		outcome := c.Params("outcome")
+		if outcome != StatusPaid && outcome != StatusExpired && outcome != StatusFailed {
+			return fiber.NewError(http.StatusNotFound, "outcome must be one of paid, expired, failed")
+		}
+		if err := m.Complete(c.UserContext(), c.Params("id"), outcome); err != nil {
+			return fiber.NewError(http.StatusConflict, err.Error())
+		}
+		return c.JSON(fiber.Map{"charge_id": c.Params("id"), "status": outcome})
+	}
+	router.Get("/mock-gateway/charges/:id/:outcome", complete)
+	router.Post("/mock-gateway/charges/:id/:outcome", complete)
+}
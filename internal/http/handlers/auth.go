@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// errForbidden is returned when the caller may not act on a registration.
+var errForbidden = errors.New("forbidden")
+
+// requireRole restricts a route to roles. With auth disabled every request
+// passes, matching the unauthenticated local setup.
+func requireRole(cfg *config.Config, roles ...string) fiber.Handler {
+	if !cfg.AuthEnabled {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+	return auth.RequireRole(roles...)
+}
+
+// maxRequestIDLength is the size of audit_events.request_id.
+const maxRequestIDLength = 255
+
+// requestID returns the request's X-Request-ID for the audit log. Clients may
+// send their own, of any length, so it is cut to fit. The header's memory is
+// reused by fasthttp after the request, hence the copy.
+func requestID(c *fiber.Ctx) string {
+	id := c.GetRespHeader(fiber.HeaderXRequestID)
+	if len(id) > maxRequestIDLength {
+		id = strings.ToValidUTF8(id[:maxRequestIDLength], "")
+	}
+	return strings.Clone(id)
+}
+
+// requestContext attributes the repository changes made while serving c to
+// the caller, for the audit log.
+func requestContext(c *fiber.Ctx) context.Context {
+	actor := repository.Actor{
+		ID:        "anonymous",
+		RequestID: requestID(c),
+		IP:        c.IP(),
+	}
+	if p := auth.FromCtx(c); p != nil {
+		actor.ID = p.Subject
+	}
+	return repository.WithActor(context.Background(), actor)
+}
+
+// loadRegistration fetches a registration the caller is allowed to access.
+// Participants may only touch their own registrations, and those they paid
+// for as the payer of an order; finance verifiers may read any registration
+// but only admins may modify other people's.
+func (h *RegistrationsHandler) loadRegistration(c *fiber.Ctx, id uuid.UUID, write bool) (*repository.Registration, error) {
+	return loadRegistration(c, h.repo, id, write)
+}
+
+// registrationGetter is the part of the stores loadRegistration needs.
+type registrationGetter interface {
+	GetRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*repository.Registration, error)
+	orderGetter
+}
+
+func loadRegistration(c *fiber.Ctx, repo registrationGetter, id uuid.UUID, write bool) (*repository.Registration, error) {
+	reg, err := repo.GetRegistrationByID(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if reg == nil {
+		return nil, repository.ErrRegistrationNotFound
+	}
+
+	p := auth.FromCtx(c)
+	switch {
+	case p == nil, p.HasRole(auth.RoleAdmin), p.Owns(reg.UserID):
+		return reg, nil
+	case !write && p.HasRole(auth.RoleFinanceVerifier):
+		return reg, nil
+	case reg.OrderID == nil:
+		return nil, errForbidden
+	}
+	order, err := repo.GetOrder(context.Background(), *reg.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || !p.Owns(order.PayerUserID) {
+		return nil, errForbidden
+	}
+	return reg, nil
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/gateway"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/middleware"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+// ChargesHandler collects payments through a payment gateway: it creates
+// charges for registrations and applies the gateway's webhooks, which
+// approve paid charges without a verifier.
+type ChargesHandler struct {
+	repo        repository.ChargeStore
+	idempotency repository.IdempotencyStore
+	gateway     gateway.PaymentGateway
+	cfg         *config.Config
+}
+
+func NewChargesHandler(repo repository.ChargeStore, idempotency repository.IdempotencyStore, gw gateway.PaymentGateway, cfg *config.Config) *ChargesHandler {
+	return &ChargesHandler{repo: repo, idempotency: idempotency, gateway: gw, cfg: cfg}
+}
+
+func (h *ChargesHandler) Register(router fiber.Router) {
+	idempotent := middleware.Idempotency(h.idempotency, time.Duration(h.cfg.IdempotencyTTLHours)*time.Hour)
+	router.Post("/registrations/:id/payment/charge", idempotent, h.createCharge)
+	router.Get("/registrations/:id/payment/charges", h.listCharges)
+}
+
+// RegisterWebhooks mounts the webhook receiver. Deliveries are authenticated
+// by their signature rather than a bearer token, so router must not require
+// one.
+func (h *ChargesHandler) RegisterWebhooks(router fiber.Router) {
+	router.Post("/webhooks/payments/:provider", h.receiveWebhook)
+}
+
+type createChargeRequest struct {
+	PaymentMethod string `json:"payment_method"`
+}
+
+// CreateCharge godoc
+// @Summary Pay through the payment gateway
+// @Description Create a gateway charge for what the registration owes next: its balance, or the amount covering its next installment. The response's payment_code is what the payer pays with: a virtual account number, a QRIS payload or an e-wallet checkout URL. The charge expires with the registration's payment deadline. The registration stays as it is until the gateway reports the charge paid; the payment is then recorded and approved automatically. Members of an order are paid through the order instead.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Param Idempotency-Key header string false "Replay-safe retry key"
+// @Param request body createChargeRequest true "Charge Request"
+// @Success 201 {object} repository.Charge
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 409 {object} problem.Details
+// @Failure 422 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Failure 502 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/payment/charge [post]
+func (h *ChargesHandler) createCharge(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	var req createChargeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	var v validation.Validator
+	if v.Required("payment_method", req.PaymentMethod) {
+		v.OneOf("payment_method", req.PaymentMethod, gateway.Methods...)
+	}
+	if err := v.Err(); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	reg, err := loadRegistration(c, h.repo, id, true)
+	if err != nil {
+		return repoError(c, err)
+	}
+	// Check before creating the charge so refused requests leave none
+	// behind at the gateway
+	current := statemachine.Status(reg.Status)
+	if current != statemachine.Paid {
+		if err := statemachine.Validate(current, statemachine.Paid); err != nil {
+			return repoError(c, err)
+		}
+	}
+	if reg.OrderID != nil {
+		return repoError(c, repository.ErrPaidByOrder)
+	}
+	amount := reg.AmountOwed()
+	if amount == nil || *amount <= 0 {
+		return repoError(c, repository.ErrNoAmountDue)
+	}
+	expiresAt := time.Now().UTC().Add(time.Duration(h.cfg.PaymentWindowHours) * time.Hour)
+	if reg.PaymentDueAt != nil {
+		expiresAt = *reg.PaymentDueAt
+	}
+
+	chargeID := uuid.New()
+	created, err := h.gateway.CreateCharge(ctx, gateway.ChargeRequest{
+		Reference:     chargeID.String(),
+		Method:        req.PaymentMethod,
+		Amount:        *amount,
+		CustomerName:  reg.FullName,
+		CustomerEmail: reg.Email,
+		ExpiresAt:     expiresAt,
+	})
+	if err != nil {
+		log.Printf("payment gateway %s: create charge: %v", h.gateway.Provider(), err)
+		return problem.Respond(c, http.StatusBadGateway, "payment gateway unavailable")
+	}
+	charge, err := h.repo.CreateCharge(ctx, repository.CreateChargeParams{
+		ChargeID:         chargeID,
+		RegistrationID:   id,
+		Provider:         h.gateway.Provider(),
+		ProviderChargeID: created.ID,
+		PaymentMethod:    req.PaymentMethod,
+		Amount:           *amount,
+		PaymentCode:      created.PaymentCode,
+		ExpiresAt:        &created.ExpiresAt,
+	})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(charge)
+}
+
+// ListCharges godoc
+// @Summary List gateway charges
+// @Description Get the gateway charges created for a registration, newest first
+// @Tags payments
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Success 200 {array} repository.Charge
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/payment/charges [get]
+func (h *ChargesHandler) listCharges(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	if _, err := loadRegistration(c, h.repo, id, false); err != nil {
+		return repoError(c, err)
+	}
+	charges, err := h.repo.ListChargesByRegistrationID(context.Background(), id)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if charges == nil {
+		charges = []*repository.Charge{}
+	}
+	return c.JSON(charges)
+}
+
+// receiveWebhook applies a signed report from the gateway on one of its
+// charges. Deliveries with a bad signature get 401 and redeliveries 200
+// without effect; anything else that is refused gets an error status so the
+// gateway retries or flags it. It is mounted outside /api/v1 and therefore
+// not in the Swagger docs.
+func (h *ChargesHandler) receiveWebhook(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+	if provider != h.gateway.Provider() {
+		return problem.Respond(c, http.StatusNotFound, "unknown payment provider")
+	}
+	event, err := h.gateway.ParseWebhook(func(key string) string { return c.Get(key) }, c.Body())
+	if errors.Is(err, gateway.ErrInvalidSignature) {
+		return problem.Respond(c, http.StatusUnauthorized, err.Error())
+	}
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+
+	ctx := repository.WithActor(context.Background(), repository.Actor{
+		ID:        "gateway:" + provider,
+		RequestID: requestID(c),
+		IP:        c.IP(),
+	})
+	params := repository.ChargeWebhookParams{
+		Provider:         provider,
+		EventID:          event.EventID,
+		ProviderChargeID: event.ChargeID,
+		Status:           event.Status,
+		Amount:           event.Amount,
+		PaidAt:           event.PaidAt,
+		Payload:          c.Body(),
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	// Events are only relayed once the webhook's transaction commits
+	charge, applied, err := h.repo.ApplyChargeWebhook(ctx, params, func(payment *repository.Payment, reg *repository.Registration) []repository.OutboxMessage {
+		key := payment.RegistrationID.String()
+		events := []repository.OutboxMessage{
+			outboxEvent(h.cfg.KafkaTopicPayVerified, key, "payment.verified", fiber.Map{
+				"payment_id":          payment.PaymentID,
+				"registration_id":     payment.RegistrationID,
+				"verification_status": payment.VerificationStatus,
+				"amount":              payment.Amount,
+				"amount_status":       payment.AmountStatus,
+				"amount_paid":         reg.AmountPaid,
+				"balance":             reg.Balance,
+				"registration_status": reg.Status,
+				"payment_method":      payment.PaymentMethod,
+				"provider":            provider,
+				"provider_charge_id":  event.ChargeID,
+				"timestamp":           now,
+			}),
+		}
+		if reg.Status == string(statemachine.Confirmed) {
+			events = append(events, outboxEvent(h.cfg.KafkaTopicRegConfirmed, key, "registration.confirmed", fiber.Map{
+				"registration_id": payment.RegistrationID,
+				"timestamp":       now,
+			}))
+		}
+		return events
+	})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(fiber.Map{"charge_id": charge.ChargeID, "status": charge.Status, "applied": applied})
+}
@@ -0,0 +1,209 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/gateway"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+type webhookResult struct {
+	Status  string `json:"status"`
+	Applied bool   `json:"applied"`
+}
+
+// webhook delivers event to the mock provider's webhook endpoint, signed
+// with secret at sentAt.
+func (s *testServer) webhook(event map[string]any, secret string, sentAt time.Time) *response {
+	s.t.Helper()
+	body, err := json.Marshal(event)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := jsonRequest(s.t, http.MethodPost, "/webhooks/payments/mock", string(body))
+	req.Header.Set(gateway.TimestampHeader, strconv.FormatInt(sentAt.Unix(), 10))
+	req.Header.Set(gateway.SignatureHeader, gateway.Sign([]byte(secret), sentAt.Unix(), body))
+	return s.send(anonymous, req)
+}
+
+func (s *testServer) createCharge(as caller, reg repository.Registration, method string) repository.Charge {
+	s.t.Helper()
+	res := s.call(as, http.MethodPost, registrationPath(reg.RegistrationID, "/payment/charge"), map[string]any{"payment_method": method})
+	return decode[repository.Charge](s.t, res, http.StatusCreated)
+}
+
+func TestGatewayCharge(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	unpriced := s.register(alice, nil)
+	s.setPricing(map[string]any{"base_price": 150000})
+	owner := newCaller(auth.RoleParticipant)
+	reg := s.register(owner, nil)
+
+	path := registrationPath(reg.RegistrationID, "/payment/charge")
+	expectFieldErrors(t, s.call(owner, http.MethodPost, path, map[string]any{}), "payment_method")
+	expectFieldErrors(t, s.call(owner, http.MethodPost, path, map[string]any{"payment_method": "cash"}), "payment_method")
+	expectProblem(t, s.call(alice, http.MethodPost, path, map[string]any{"payment_method": "qris"}), http.StatusForbidden)
+	expectProblem(t, s.call(alice, http.MethodPost, registrationPath(unpriced.RegistrationID, "/payment/charge"), map[string]any{"payment_method": "qris"}), http.StatusConflict)
+
+	charge := s.createCharge(owner, reg, "virtual_account")
+	if charge.Amount != 150000 || charge.Status != "pending" || charge.Provider != "mock" || !strings.HasPrefix(charge.PaymentCode, "8808") {
+		t.Errorf("charge = %+v", charge)
+	}
+	if charge.ExpiresAt == nil || !charge.ExpiresAt.Equal(*reg.PaymentDueAt) {
+		t.Errorf("expires_at = %v, want %v", charge.ExpiresAt, reg.PaymentDueAt)
+	}
+	if got := s.registration(reg.RegistrationID); got.Status != "pending" {
+		t.Errorf("status = %s, want pending until the charge is paid", got.Status)
+	}
+	s.published()
+
+	// The gateway's signed webhook approves the payment without a verifier
+	if err := s.gateway.Complete(context.Background(), charge.ProviderChargeID, gateway.StatusPaid); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.registration(reg.RegistrationID); got.Status != "confirmed" || got.AmountPaid != 150000 {
+		t.Errorf("registration = %+v", got)
+	}
+	payment := decode[repository.Payment](t, s.call(owner, http.MethodGet, registrationPath(reg.RegistrationID, "/payment"), nil), http.StatusOK)
+	if payment.VerificationStatus != "approved" || payment.PaymentMethod != "virtual_account" || *payment.AmountStatus != repository.AmountExact || payment.VerifiedBy != nil {
+		t.Errorf("payment = %+v", payment)
+	}
+	if topics := s.published(); !slices.Equal(topics, []string{"payment.verified", "registration.confirmed"}) {
+		t.Errorf("published %v", topics)
+	}
+	charges := decode[[]repository.Charge](t, s.call(finance, http.MethodGet, registrationPath(reg.RegistrationID, "/payment/charges"), nil), http.StatusOK)
+	if len(charges) != 1 || charges[0].Status != "paid" || charges[0].PaymentID == nil || *charges[0].PaymentID != payment.PaymentID {
+		t.Errorf("charges = %+v", charges)
+	}
+
+	expectProblem(t, s.call(owner, http.MethodPost, path, map[string]any{"payment_method": "ewallet"}), http.StatusConflict)
+}
+
+func TestMockEwalletCheckout(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000})
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	charge := s.createCharge(alice, reg, "ewallet")
+
+	// The checkout link is opened in a browser, so a plain GET pays the charge
+	checkout, ok := strings.CutPrefix(charge.PaymentCode, "http://regpay.test")
+	if !ok || checkout != "/mock-gateway/charges/"+charge.ProviderChargeID+"/paid" {
+		t.Fatalf("payment_code = %s", charge.PaymentCode)
+	}
+	expectStatus(t, s.call(anonymous, http.MethodGet, checkout, nil), http.StatusOK)
+	if got := s.registration(reg.RegistrationID); got.Status != "confirmed" || got.AmountPaid != 150000 {
+		t.Errorf("registration = %+v", got)
+	}
+	expectStatus(t, s.call(anonymous, http.MethodGet, checkout, nil), http.StatusOK)
+	expectStatus(t, s.call(anonymous, http.MethodPost, strings.Replace(checkout, "/paid", "/failed", 1), nil), http.StatusConflict)
+}
+
+func TestGatewayWebhook(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000})
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	charge := s.createCharge(alice, reg, "qris")
+
+	paid := map[string]any{"event_id": "evt_1", "charge_id": charge.ProviderChargeID, "status": "paid", "amount": 100000}
+	expectProblem(t, s.webhook(paid, "wrong-secret", time.Now()), http.StatusUnauthorized)
+	expectProblem(t, s.webhook(paid, testWebhookSecret, time.Now().Add(-time.Hour)), http.StatusUnauthorized)
+	expectProblem(t, s.webhook(map[string]any{"event_id": "evt_0", "charge_id": "nope", "status": "paid", "amount": 1}, testWebhookSecret, time.Now()), http.StatusNotFound)
+	expectProblem(t, s.webhook(map[string]any{"event_id": "evt_0", "charge_id": charge.ProviderChargeID, "status": "refunded"}, testWebhookSecret, time.Now()), http.StatusBadRequest)
+	expectProblem(t, s.call(anonymous, http.MethodPost, "/webhooks/payments/other", paid), http.StatusNotFound)
+
+	// A short payment is credited and leaves the rest owed
+	if res := decode[webhookResult](t, s.webhook(paid, testWebhookSecret, time.Now()), http.StatusOK); !res.Applied || res.Status != "paid" {
+		t.Errorf("result = %+v", res)
+	}
+	got := s.registration(reg.RegistrationID)
+	if got.Status != "partially_paid" || got.AmountPaid != 100000 || *got.Balance != 50000 {
+		t.Errorf("registration = %+v", got)
+	}
+	s.published()
+
+	// Redeliveries, and later events about a settled charge, change nothing
+	if res := decode[webhookResult](t, s.webhook(paid, testWebhookSecret, time.Now()), http.StatusOK); res.Applied {
+		t.Errorf("redelivery applied")
+	}
+	paid["event_id"] = "evt_2"
+	if res := decode[webhookResult](t, s.webhook(paid, testWebhookSecret, time.Now()), http.StatusOK); res.Applied {
+		t.Errorf("second event applied")
+	}
+	if got := s.registration(reg.RegistrationID); got.AmountPaid != 100000 {
+		t.Errorf("amount_paid = %v, want 100000", got.AmountPaid)
+	}
+	if topics := s.published(); len(topics) != 0 {
+		t.Errorf("published %v", topics)
+	}
+
+	// The next charge is for the balance; an expired one leaves it owed
+	charge = s.createCharge(alice, reg, "ewallet")
+	if charge.Amount != 50000 {
+		t.Errorf("amount = %v, want 50000", charge.Amount)
+	}
+	expired := map[string]any{"event_id": "evt_3", "charge_id": charge.ProviderChargeID, "status": "expired"}
+	if res := decode[webhookResult](t, s.webhook(expired, testWebhookSecret, time.Now()), http.StatusOK); !res.Applied || res.Status != "expired" {
+		t.Errorf("result = %+v", res)
+	}
+	if got := s.registration(reg.RegistrationID); got.Status != "partially_paid" || *got.Balance != 50000 {
+		t.Errorf("registration = %+v", got)
+	}
+	history := decode[[]repository.AuditEvent](t, s.call(admin, http.MethodGet, registrationPath(reg.RegistrationID, "/history"), nil), http.StatusOK)
+	var actions []string
+	for _, e := range history {
+		if e.EntityType == "charge" {
+			actions = append(actions, e.Action+" by "+e.Actor)
+		}
+	}
+	want := []string{"charge.created by " + alice.Subject, "charge.paid by gateway:mock", "charge.created by " + alice.Subject, "charge.expired by gateway:mock"}
+	if !slices.Equal(actions, want) {
+		t.Errorf("charge history = %v", actions)
+	}
+}
+
+func TestGatewayWebhookAfterCancellation(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000})
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	charge := s.createCharge(alice, reg, "virtual_account")
+
+	// The registration is cancelled, as by the expiry scheduler, while the
+	// payer is still paying
+	expectStatus(t, s.call(alice, http.MethodPost, registrationPath(reg.RegistrationID, "/cancel"), map[string]any{"reason": "payment timeout"}), http.StatusNoContent)
+	paid := map[string]any{"event_id": "evt_1", "charge_id": charge.ProviderChargeID, "status": "paid", "amount": 150000}
+	if res := decode[webhookResult](t, s.webhook(paid, testWebhookSecret, time.Now()), http.StatusOK); !res.Applied || res.Status != "paid" {
+		t.Errorf("result = %+v", res)
+	}
+	if res := decode[webhookResult](t, s.webhook(paid, testWebhookSecret, time.Now()), http.StatusOK); res.Applied {
+		t.Errorf("redelivery applied")
+	}
+
+	// The money is recorded and handed back; the registration stays cancelled
+	if got := s.registration(reg.RegistrationID); got.Status != "cancelled" || got.AmountPaid != 0 {
+		t.Errorf("registration = %+v", got)
+	}
+	payment := decode[repository.Payment](t, s.call(alice, http.MethodGet, registrationPath(reg.RegistrationID, "/payment"), nil), http.StatusOK)
+	if payment.VerificationStatus != "rejected" || payment.Amount != 150000 || payment.RejectionReason == nil {
+		t.Errorf("payment = %+v", payment)
+	}
+	refund := decode[repository.Refund](t, s.call(alice, http.MethodGet, registrationPath(reg.RegistrationID, "/refund"), nil), http.StatusOK)
+	if refund.PaymentID != payment.PaymentID || refund.Amount != 150000 || refund.RefundType != "full" || refund.Status != "pending" {
+		t.Errorf("refund = %+v", refund)
+	}
+	charges := decode[[]repository.Charge](t, s.call(alice, http.MethodGet, registrationPath(reg.RegistrationID, "/payment/charges"), nil), http.StatusOK)
+	if len(charges) != 1 || charges[0].Status != "paid" || charges[0].PaymentID == nil || *charges[0].PaymentID != payment.PaymentID {
+		t.Errorf("charges = %+v", charges)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+// repoError maps repository errors to a problem response: invalid fields and
+// bad paging parameters become 400, access denied 403, missing rows 404, full
+// events, used-up vouchers, payment conflicts and illegal status transitions
+// 409, constraint violations the matching 4xx, and anything else
+// a 500 that does not leak the error text.
+func repoError(c *fiber.Ctx, err error) error {
+	var (
+		fieldErrs     validation.Errors
+		transitionErr *statemachine.TransitionError
+		pgErr         *pgconn.PgError
+	)
+	switch {
+	case errors.As(err, &fieldErrs):
+		return problem.Validation(c, fieldErrs)
+	case errors.Is(err, repository.ErrInvalidCursor), errors.Is(err, repository.ErrInvalidSort):
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errForbidden):
+		return problem.Respond(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, repository.ErrRegistrationNotFound), errors.Is(err, repository.ErrVoucherNotFound),
+		errors.Is(err, repository.ErrOrderNotFound), errors.Is(err, repository.ErrChargeNotFound),
+		errors.Is(err, storage.ErrNotFound):
+		return problem.Respond(c, http.StatusNotFound, "not found")
+	case errors.Is(err, repository.ErrNoPendingPayment), errors.Is(err, repository.ErrNoPendingRefund):
+		return problem.Respond(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, repository.ErrEventFull), errors.Is(err, repository.ErrGenderQuotaFull):
+		return problem.Write(c, problem.New(http.StatusConflict, err.Error()).With("code", "full"))
+	case errors.Is(err, repository.ErrVoucherExhausted), errors.Is(err, repository.ErrVoucherAlreadyUsed):
+		return problem.Write(c, problem.New(http.StatusConflict, err.Error()).With("code", "voucher_unavailable"))
+	case errors.Is(err, repository.ErrPaidByOrder), errors.Is(err, repository.ErrNothingToPay),
+		errors.Is(err, repository.ErrNoAmountDue):
+		return problem.Respond(c, http.StatusConflict, err.Error())
+	case errors.As(err, &transitionErr):
+		return problem.Write(c, problem.New(http.StatusConflict, transitionErr.Error()).
+			With("current_status", transitionErr.From))
+	case errors.As(err, &pgErr):
+		return constraintError(c, pgErr)
+	default:
+		return problem.Internal(c, err)
+	}
+}
+
+// constraintFields names the request field behind each schema constraint, so
+// a violation that slipped past validation (or raced it) still points at the
+// right field.
+var constraintFields = map[string]validation.FieldError{
+	"unique_event_user":                         {Field: "user_id", Message: "is already registered for this event"},
+	"registrations_gender_check":                {Field: "gender", Message: "must be one of male, female"},
+	"event_capacity_total_quota_check":          {Field: "total_quota", Message: "must not be negative"},
+	"event_capacity_male_quota_check":           {Field: "male_quota", Message: "must not be negative"},
+	"event_capacity_female_quota_check":         {Field: "female_quota", Message: "must not be negative"},
+	"event_capacity_payment_window_hours_check": {Field: "payment_window_hours", Message: "must be positive"},
+	"payments_registration_id_fkey":             {Field: "registration_id", Message: "does not exist"},
+	"unique_voucher_code":                       {Field: "code", Message: "is already in use"},
+	"voucher_usage_limit":                       {Field: "max_uses", Message: "must not be below used_count"},
+	"voucher_validity":                          {Field: "valid_until", Message: "must be after valid_from"},
+	"payment_charges_registration_id_fkey":      {Field: "registration_id", Message: "does not exist"},
+}
+
+// constraintError maps Postgres integrity and data errors to client errors.
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html.
+func constraintError(c *fiber.Ctx, pgErr *pgconn.PgError) error {
+	fieldErr, known := constraintFields[pgErr.ConstraintName]
+	switch pgErr.Code {
+	case "23505": // unique_violation
+		d := problem.New(http.StatusConflict, "resource already exists")
+		if known {
+			d.Detail = fieldErr.Field + " " + fieldErr.Message
+			d.Errors = []validation.FieldError{fieldErr}
+		}
+		return problem.Write(c, d)
+	case "23514", "23503": // check_violation, foreign_key_violation
+		if known {
+			return problem.Validation(c, validation.Errors{fieldErr})
+		}
+		return problem.Respond(c, http.StatusBadRequest, "a value violates a constraint")
+	case "23502": // not_null_violation
+		return problem.Validation(c, validation.Errors{{Field: pgErr.ColumnName, Message: "is required"}})
+	case "22001": // string_data_right_truncation
+		return problem.Respond(c, http.StatusBadRequest, "a value is too long")
+	case "22003", "22007", "22008", "22P02": // out of range, bad datetime, bad text representation
+		return problem.Respond(c, http.StatusBadRequest, "a value has an invalid format")
+	default:
+		return problem.Internal(c, pgErr)
+	}
+}
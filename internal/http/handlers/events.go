@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/export"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/importer"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+type EventsHandler struct {
+	repo     repository.EventStore
+	refunds  repository.RefundStore
+	cfg      *config.Config
+	importer *importer.Importer
+}
+
+func NewEventsHandler(repo repository.EventStore, imports repository.ImportStore, refunds repository.RefundStore, cfg *config.Config) *EventsHandler {
+	return &EventsHandler{repo: repo, refunds: refunds, cfg: cfg, importer: importer.New(imports, cfg.KafkaTopicRegCreated)}
+}
+
+func (h *EventsHandler) Register(router fiber.Router) {
+	g := router.Group("/events")
+	g.Get(":event_id/capacity", h.getCapacity)
+	g.Put(":event_id/capacity", requireRole(h.cfg, auth.RoleAdmin), h.setCapacity)
+	g.Get(":event_id/pricing", h.getPricing)
+	g.Put(":event_id/pricing", requireRole(h.cfg, auth.RoleAdmin), h.setPricing)
+	g.Post(":event_id/registrations/import", requireRole(h.cfg, auth.RoleAdmin), h.importRegistrations)
+	g.Get(":event_id/registrations/export", requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin), h.exportRegistrations)
+	g.Get(":event_id/refund-policy", h.getRefundPolicy)
+	g.Put(":event_id/refund-policy", requireRole(h.cfg, auth.RoleAdmin), h.setRefundPolicy)
+	g.Get(":event_id/refunds", requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin), h.listRefunds)
+}
+
+type setCapacityRequest struct {
+	TotalQuota         *int `json:"total_quota"`
+	MaleQuota          *int `json:"male_quota"`
+	FemaleQuota        *int `json:"female_quota"`
+	PaymentWindowHours *int `json:"payment_window_hours"`
+}
+
+// GetCapacity godoc
+// @Summary Get event capacity
+// @Description Get the seat quotas of an event and how many seats are taken
+// @Tags events
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Success 200 {object} repository.EventCapacity
+// @Failure 400 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/capacity [get]
+func (h *EventsHandler) getCapacity(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	ctx := context.Background()
+	capacity, err := h.repo.GetEventCapacity(ctx, eventID)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if capacity == nil {
+		return problem.Respond(c, http.StatusNotFound, "no capacity configured for event")
+	}
+	return c.JSON(capacity)
+}
+
+// SetCapacity godoc
+// @Summary Set event capacity
+// @Description Set the total and per-gender seat quotas of an event and its payment window. Omitted quotas are unlimited; an omitted payment window uses the service default.
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Param request body setCapacityRequest true "Capacity"
+// @Success 200 {object} repository.EventCapacity
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/capacity [put]
+func (h *EventsHandler) setCapacity(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	var req setCapacityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	var v validation.Validator
+	for _, q := range []struct {
+		name  string
+		value *int
+	}{
+		{"total_quota", req.TotalQuota}, {"male_quota", req.MaleQuota}, {"female_quota", req.FemaleQuota},
+	} {
+		v.Check(q.value == nil || *q.value >= 0, q.name, "must not be negative")
+	}
+	v.Check(req.PaymentWindowHours == nil || *req.PaymentWindowHours > 0, "payment_window_hours", "must be positive")
+	if err := v.Err(); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	capacity, err := h.repo.UpsertEventCapacity(ctx, repository.UpsertEventCapacityParams{
+		EventID:            eventID,
+		TotalQuota:         req.TotalQuota,
+		MaleQuota:          req.MaleQuota,
+		FemaleQuota:        req.FemaleQuota,
+		PaymentWindowHours: req.PaymentWindowHours,
+	})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(capacity)
+}
+
+// ExportRegistrations godoc
+// @Summary Export registrations of an event
+// @Description Stream all registrations of an event, with their latest payment, as CSV or XLSX. Use columns to pick fields (e.g. to leave out address). Staff only.
+// @Tags events
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param event_id path string true "Event ID"
+// @Param format query string false "csv or xlsx" default(csv)
+// @Param columns query string false "Comma-separated column names, default all: registration_id, user_id, full_name, gender, category, phone, email, address, emergency_contact_name, emergency_contact_phone, emergency_contact_relation, special_needs, registration_date, status, waitlist_position, payment_due_at, amount_due, voucher_code, discount_amount, amount_paid, balance, payment_status, payment_amount, payment_method, payment_date, payment_verified_at, cancelled_at, cancellation_reason, notes"
+// @Success 200 {file} file
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/registrations/export [get]
+func (h *EventsHandler) exportRegistrations(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	format, err := export.LookupFormat(c.Query("format", "csv"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	var names []string
+	if v := c.Query("columns"); v != "" {
+		names = strings.Split(v, ",")
+	}
+	cols, err := export.SelectColumns(names)
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+
+	filename := fmt.Sprintf("registrations-%s-%s.%s", eventID, time.Now().UTC().Format("20060102"), format.Extension)
+	c.Set(fiber.HeaderContentType, format.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// The body is produced after the handler returns, so a failure midway
+	// can only be logged; the client sees a truncated file.
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		w := format.New(bw)
+		err := w.WriteRow(export.Headers(cols))
+		if err == nil {
+			err = h.repo.EachEventRegistration(context.Background(), eventID, func(row *repository.RegistrationExportRow) error {
+				return w.WriteRow(export.Row(cols, row))
+			})
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err == nil {
+			err = bw.Flush()
+		}
+		if err != nil {
+			log.Printf("export registrations of event %s: %v", eventID, err)
+		}
+	})
+	return nil
+}
+
+// ImportRegistrations godoc
+// @Summary Import registrations from CSV
+// @Description Bulk-register participants for an event from a CSV with a header row. Columns: full_name, gender, phone, email (required), user_id, address, emergency_contact_name, emergency_contact_phone, emergency_contact_relation, special_needs, category. Rows are validated like POST /registrations, including the category against the event's pricing; invalid rows are skipped and reported, valid rows are inserted in one transaction. With dry_run=true nothing is written. Admin only.
+// @Tags events
+// @Accept multipart/form-data
+// @Accept text/csv
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Param dry_run query bool false "Validate only"
+// @Param file formData file false "CSV file (or send the CSV as the request body)"
+// @Success 200 {object} importer.Report
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/registrations/import [post]
+func (h *EventsHandler) importRegistrations(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+
+	var body io.Reader
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return problem.Respond(c, http.StatusBadRequest, "file is required")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return problem.Respond(c, http.StatusBadRequest, "failed to read file")
+		}
+		defer f.Close()
+		body = f
+	} else {
+		body = bytes.NewReader(c.Body())
+	}
+
+	ctx := requestContext(c)
+	report, err := h.importer.Import(ctx, eventID, body, c.QueryBool("dry_run"))
+	if errors.Is(err, importer.ErrInvalidFile) {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/importer"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+func eventPath(suffix string) string {
+	return "/api/v1/events/" + eventID.String() + suffix
+}
+
+func TestEventCapacity(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	path := eventPath("/capacity")
+
+	expectProblem(t, s.call(alice, http.MethodGet, path, nil), http.StatusNotFound)
+
+	s.setCapacity(map[string]any{"total_quota": 1})
+	s.register(alice, nil)
+	waiting := s.register(admin, map[string]any{"user_id": uuid.New(), "gender": "male"})
+	if got := s.registration(waiting.RegistrationID).Status; got != "waitlisted" {
+		t.Fatalf("status = %s, want waitlisted", got)
+	}
+
+	// Raising the quota promotes the waitlist
+	res := s.call(admin, http.MethodPut, path, map[string]any{"total_quota": 5, "female_quota": 3, "payment_window_hours": 24})
+	capacity := decode[repository.EventCapacity](t, res, http.StatusOK)
+	if capacity.RegisteredTotal != 2 || capacity.RegisteredFemale != 1 || capacity.RegisteredMale != 1 {
+		t.Errorf("capacity = %+v", capacity)
+	}
+	if got := s.registration(waiting.RegistrationID).Status; got != "pending" {
+		t.Errorf("status = %s, want promoted to pending", got)
+	}
+
+	capacity = decode[repository.EventCapacity](t, s.call(alice, http.MethodGet, path, nil), http.StatusOK)
+	if capacity.TotalQuota == nil || *capacity.TotalQuota != 5 || capacity.MaleQuota != nil {
+		t.Errorf("capacity = %+v", capacity)
+	}
+
+	res = s.call(admin, http.MethodPut, path, map[string]any{"total_quota": -1, "male_quota": -1, "payment_window_hours": 0})
+	expectFieldErrors(t, res, "total_quota", "male_quota", "payment_window_hours")
+	expectProblem(t, s.call(admin, http.MethodPut, path, "{"), http.StatusBadRequest)
+	expectProblem(t, s.call(finance, http.MethodPut, path, map[string]any{}), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/events/x/capacity", nil), http.StatusBadRequest)
+	expectProblem(t, s.call(admin, http.MethodPut, "/api/v1/events/x/capacity", map[string]any{}), http.StatusBadRequest)
+}
+
+func TestExportRegistrations(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, map[string]any{"full_name": "=HYPERLINK(\"x\")", "phone": "+6281234567890", "special_needs": "-1+cmd|' /C calc'!A0"})
+	s.pay(alice, reg.RegistrationID)
+	s.register(admin, map[string]any{"user_id": uuid.New(), "event_id": uuid.New()}) // another event
+
+	res := s.call(finance, http.MethodGet, eventPath("/registrations/export?columns=full_name,phone,special_needs,status,payment_status"), nil)
+	expectStatus(t, res, http.StatusOK)
+	if ct := res.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(res.Body))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Full Name", "Phone", "Special Needs", "Status", "Payment Status"},
+		{"'=HYPERLINK(\"x\")", "+6281234567890", "'-1+cmd|' /C calc'!A0", "paid", "pending"},
+	}
+	if len(rows) != len(want) || strings.Join(rows[0], ",") != strings.Join(want[0], ",") || strings.Join(rows[1], ",") != strings.Join(want[1], ",") {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+
+	res = s.call(admin, http.MethodGet, eventPath("/registrations/export?format=xlsx"), nil)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.HasPrefix(string(res.Body), "PK") {
+		t.Errorf("xlsx export is not a zip archive")
+	}
+
+	expectProblem(t, s.call(admin, http.MethodGet, eventPath("/registrations/export?format=pdf"), nil), http.StatusBadRequest)
+	expectProblem(t, s.call(admin, http.MethodGet, eventPath("/registrations/export?columns=password"), nil), http.StatusBadRequest)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/events/x/registrations/export", nil), http.StatusBadRequest)
+	expectProblem(t, s.call(alice, http.MethodGet, eventPath("/registrations/export"), nil), http.StatusForbidden)
+}
+
+func TestImportRegistrations(t *testing.T) {
+	s := newTestServer(t)
+	existing := uuid.New()
+	s.register(admin, map[string]any{"user_id": existing})
+	s.published()
+
+	file := "full_name,gender,phone,email,user_id\n" +
+		"Andi,male,081211112222,andi@example.com,\n" +
+		"Bad Phone,female,12,bad@example.com,\n" +
+		"Already,female,081233334444,already@example.com," + existing.String() + "\n"
+	path := eventPath("/registrations/import")
+	csvRequest := func(query string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path+query, strings.NewReader(file))
+		req.Header.Set(fiber.HeaderContentType, "text/csv")
+		return req
+	}
+
+	report := decode[importer.Report](t, s.send(admin, csvRequest("?dry_run=true")), http.StatusOK)
+	if !report.DryRun || report.TotalRows != 3 || report.ValidRows != 1 || report.InvalidRows != 2 || report.Imported != 0 {
+		t.Errorf("dry run report = %+v", report)
+	}
+	if len(report.Errors) != 2 || report.Errors[0].Row != 3 || report.Errors[1].Row != 4 {
+		t.Errorf("errors = %+v", report.Errors)
+	}
+	if topics := s.published(); len(topics) != 0 {
+		t.Errorf("dry run published %v", topics)
+	}
+
+	res := s.send(admin, multipartRequest(t, http.MethodPost, path, nil, "file", "peserta.csv", []byte(file)))
+	report = decode[importer.Report](t, res, http.StatusOK)
+	if report.DryRun || report.Imported != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	results := decode[[]repository.RegistrationSearchResult](t, s.call(admin, http.MethodGet, "/api/v1/registrations/search?q=andi", nil), http.StatusOK)
+	if len(results) != 1 || results[0].Status != "pending" {
+		t.Errorf("imported registration not found: %+v", results)
+	}
+	if topics := s.published(); len(topics) != 1 || topics[0] != "registration.created" {
+		t.Errorf("published %v", topics)
+	}
+
+	bad := httptest.NewRequest(http.MethodPost, path, strings.NewReader("name,phone\nx,y\n"))
+	bad.Header.Set(fiber.HeaderContentType, "text/csv")
+	expectProblem(t, s.send(admin, bad), http.StatusBadRequest)
+	expectProblem(t, s.send(admin, multipartRequest(t, http.MethodPost, path, nil, "", "", nil)), http.StatusBadRequest)
+	expectProblem(t, s.send(finance, csvRequest("")), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodPost, "/api/v1/events/x/registrations/import", ""), http.StatusBadRequest)
+}
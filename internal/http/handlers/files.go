@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+)
+
+// FilesHandler serves stored payment and refund proofs. They show the
+// payer's name and bank account, so each is only served to those allowed to
+// read the registration or order it was uploaded for.
+type FilesHandler struct {
+	registrations repository.RegistrationStore
+	orders        repository.OrderStore
+	storage       storage.Storage
+}
+
+func NewFilesHandler(registrations repository.RegistrationStore, orders repository.OrderStore, store storage.Storage) *FilesHandler {
+	return &FilesHandler{registrations: registrations, orders: orders, storage: store}
+}
+
+// Register mounts the files under storage.FilesURLPrefix, which router must
+// be the /api/v1 group for.
+func (h *FilesHandler) Register(router fiber.Router) {
+	router.Get("/files/:dir/:owner/:name", h.getFile)
+}
+
+// proofContentType returns the content type of a proof stored with ext.
+func proofContentType(ext string) (string, bool) {
+	for contentType, e := range allowedProofTypes {
+		if e == ext {
+			return contentType, true
+		}
+	}
+	return "", false
+}
+
+// GetFile godoc
+// @Summary Download a payment or refund proof
+// @Description Download a proof by the URL stored with its payment or refund. Proofs of registration payments and refunds are served to those who may read the registration, proofs of order payments to those who may read the order.
+// @Tags payments
+// @Produce application/pdf,image/jpeg,image/png
+// @Param dir path string true "payments, refunds or orders"
+// @Param owner path string true "Registration or order ID"
+// @Param name path string true "File name"
+// @Success 200 {file} file
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /files/{dir}/{owner}/{name} [get]
+func (h *FilesHandler) getFile(c *fiber.Ctx) error {
+	// Keys are dir/owner/<uuid><ext> as storeProof builds them; anything
+	// else cannot be stored
+	name := c.Params("name")
+	ext := path.Ext(name)
+	contentType, ok := proofContentType(ext)
+	if _, err := uuid.Parse(strings.TrimSuffix(name, ext)); err != nil || !ok {
+		return repoError(c, storage.ErrNotFound)
+	}
+	owner, err := uuid.Parse(c.Params("owner"))
+	if err != nil {
+		return repoError(c, storage.ErrNotFound)
+	}
+
+	dir := c.Params("dir")
+	switch dir {
+	case "payments", "refunds":
+		_, err = loadRegistration(c, h.registrations, owner, false)
+	case "orders":
+		_, err = loadOrder(c, h.orders, owner, false)
+	default:
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		return repoError(c, err)
+	}
+
+	f, err := h.storage.Open(c.UserContext(), dir+"/"+owner.String()+"/"+name)
+	if err != nil {
+		return repoError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.Status(http.StatusOK).SendStream(f)
+}
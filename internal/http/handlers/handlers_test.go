@@ -0,0 +1,332 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/gateway"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/handlers"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/kafka"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+)
+
+const (
+	testSecret        = "test-secret"
+	testWebhookSecret = "test-webhook-secret"
+)
+
+// testServer wires the handlers to an in-memory store the same way
+// cmd/server wires them to Postgres.
+type testServer struct {
+	t       *testing.T
+	app     *fiber.App
+	store   *repository.Memory
+	cfg     *config.Config
+	gateway *gateway.Mock
+}
+
+func newTestServer(t *testing.T, opts ...func(*config.Config)) *testServer {
+	t.Helper()
+	cfg := &config.Config{
+		KafkaTopicRegCreated:   "registration.created",
+		KafkaTopicPayUploaded:  "payment.uploaded",
+		KafkaTopicPayVerified:  "payment.verified",
+		KafkaTopicPayRefunded:  "payment.refunded",
+		KafkaTopicRegConfirmed: "registration.confirmed",
+		KafkaTopicRegCancelled: "registration.cancelled",
+		KafkaTopicRegPromoted:  "registration.promoted",
+		UploadMaxBytes:         1024 * 1024,
+		IdempotencyTTLHours:    24,
+		PaymentWindowHours:     48,
+		AuthEnabled:            true,
+		JWTHMACSecret:          testSecret,
+		GatewayDriver:          "mock",
+		GatewayWebhookSecret:   testWebhookSecret,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	store := repository.NewMemory()
+	store.PromotedTopic = cfg.KafkaTopicRegPromoted
+	store.DefaultPaymentWindowHours = cfg.PaymentWindowHours
+	files, err := storage.NewLocal(t.TempDir(), storage.FilesURLPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	// The mock gateway delivers its webhooks straight to app
+	mock, err := gateway.NewMock(gateway.MockConfig{
+		Secret:      cfg.GatewayWebhookSecret,
+		CallbackURL: "http://regpay.test",
+		Client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return app.Test(req, -1)
+		})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Use(requestid.New())
+	api := app.Group("/api/v1")
+	if cfg.AuthEnabled {
+		verifier, err := auth.NewVerifier(auth.VerifierConfig{HMACSecret: cfg.JWTHMACSecret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		api.Use(auth.Middleware(verifier))
+	}
+	handlers.NewRegistrationsHandler(store, store, store, store, files, cfg).Register(api)
+	handlers.NewEventsHandler(store, store, store, cfg).Register(api)
+	handlers.NewVouchersHandler(store, cfg).Register(api)
+	handlers.NewOrdersHandler(store, store, files, cfg).Register(api)
+	handlers.NewFilesHandler(store, store, files).Register(api)
+	charges := handlers.NewChargesHandler(store, store, mock, cfg)
+	charges.Register(api)
+	charges.RegisterWebhooks(app)
+	mock.Register(app)
+
+	return &testServer{t: t, app: app, store: store, cfg: cfg, gateway: mock}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// caller is the identity a request is sent as. The zero value sends no
+// token.
+type caller struct {
+	Subject string
+	Roles   []string
+}
+
+var anonymous caller
+
+func newCaller(roles ...string) caller {
+	return caller{Subject: uuid.NewString(), Roles: roles}
+}
+
+func (c caller) userID() uuid.UUID {
+	return uuid.MustParse(c.Subject)
+}
+
+func (c caller) token(t *testing.T) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   c.Subject,
+		"roles": c.Roles,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	s, err := tok.SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+type response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// send runs req through the app as the given caller.
+func (s *testServer) send(as caller, req *http.Request) *response {
+	s.t.Helper()
+	if as.Subject != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+as.token(s.t))
+	}
+	res, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return &response{Status: res.StatusCode, Header: res.Header, Body: body}
+}
+
+// call sends body as JSON; a string body is sent verbatim.
+func (s *testServer) call(as caller, method, path string, body any) *response {
+	s.t.Helper()
+	return s.send(as, jsonRequest(s.t, method, path, body))
+}
+
+func jsonRequest(t *testing.T, method, path string, body any) *http.Request {
+	t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(b)
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if r != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	return req
+}
+
+// multipartRequest builds a multipart/form-data request with the given
+// fields and, if fileField is set, one file.
+func multipartRequest(t *testing.T, method, path string, fields map[string]string, fileField, filename string, content []byte) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fileField != "" {
+		fw, err := w.CreateFormFile(fileField, filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+func expectStatus(t *testing.T, res *response, want int) {
+	t.Helper()
+	if res.Status != want {
+		t.Fatalf("status = %d, want %d; body: %s", res.Status, want, res.Body)
+	}
+}
+
+// decode expects status and unmarshals the JSON body into v.
+func decode[T any](t *testing.T, res *response, status int) T {
+	t.Helper()
+	expectStatus(t, res, status)
+	var v T
+	if err := json.Unmarshal(res.Body, &v); err != nil {
+		t.Fatalf("decode %s: %v", res.Body, err)
+	}
+	return v
+}
+
+type problemBody struct {
+	Type          string              `json:"type"`
+	Title         string              `json:"title"`
+	Status        int                 `json:"status"`
+	Detail        string              `json:"detail"`
+	Errors        []map[string]string `json:"errors"`
+	Code          string              `json:"code"`
+	CurrentStatus string              `json:"current_status"`
+}
+
+// expectProblem expects an application/problem+json response with status.
+func expectProblem(t *testing.T, res *response, status int) problemBody {
+	t.Helper()
+	p := decode[problemBody](t, res, status)
+	if ct := res.Header.Get(fiber.HeaderContentType); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	if p.Status != status {
+		t.Errorf("problem status = %d, want %d", p.Status, status)
+	}
+	return p
+}
+
+// expectFieldErrors expects a validation problem naming exactly fields.
+func expectFieldErrors(t *testing.T, res *response, fields ...string) {
+	t.Helper()
+	p := expectProblem(t, res, http.StatusBadRequest)
+	if p.Type != problem.TypeValidation {
+		t.Errorf("problem type = %q, want %q", p.Type, problem.TypeValidation)
+	}
+	got := make([]string, len(p.Errors))
+	for i, e := range p.Errors {
+		got[i] = e["field"]
+	}
+	if strings.Join(got, ",") != strings.Join(fields, ",") {
+		t.Errorf("invalid fields = %v, want %v", got, fields)
+	}
+}
+
+// published drains the store's outbox and returns the topics of the
+// messages, in order.
+func (s *testServer) published() []string {
+	s.t.Helper()
+	ctx := context.Background()
+	pub := &kafka.MemoryPublisher{}
+	_, err := s.store.ProcessOutbox(ctx, 1000, 1, func(rec repository.OutboxRecord) error {
+		return pub.Publish(ctx, rec.Topic, rec.Key, rec.Payload)
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	var topics []string
+	for _, m := range pub.Messages() {
+		topics = append(topics, m.Topic)
+	}
+	return topics
+}
+
+var (
+	eventID = uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	admin   = newCaller(auth.RoleAdmin)
+	finance = newCaller(auth.RoleFinanceVerifier)
+)
+
+func registrationBody(overrides map[string]any) map[string]any {
+	body := map[string]any{
+		"event_id":  eventID,
+		"full_name": "Siti Aminah",
+		"gender":    "female",
+		"phone":     "081234567890",
+		"email":     "siti@example.com",
+	}
+	for k, v := range overrides {
+		body[k] = v
+	}
+	return body
+}
+
+// register creates a registration for the participant and returns it.
+func (s *testServer) register(as caller, overrides map[string]any) repository.Registration {
+	s.t.Helper()
+	res := s.call(as, http.MethodPost, "/api/v1/registrations", registrationBody(overrides))
+	return decode[repository.Registration](s.t, res, http.StatusCreated)
+}
+
+func (s *testServer) setCapacity(body map[string]any) {
+	s.t.Helper()
+	res := s.call(admin, http.MethodPut, "/api/v1/events/"+eventID.String()+"/capacity", body)
+	expectStatus(s.t, res, http.StatusOK)
+}
+
+func registrationPath(id uuid.UUID, suffix string) string {
+	return "/api/v1/registrations/" + id.String() + suffix
+}
@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// setInstallmentPricing prices the event at 300000, paid in two halves due
+// in first and second.
+func (s *testServer) setInstallmentPricing(first, second time.Time) {
+	s.t.Helper()
+	s.setPricing(map[string]any{"base_price": 300000, "installments": []map[string]any{
+		{"percent": 50, "due_at": first.Format(time.RFC3339)},
+		{"percent": 50, "due_at": second.Format(time.RFC3339)},
+	}})
+}
+
+func TestInstallmentPayments(t *testing.T) {
+	s := newTestServer(t)
+	s.setInstallmentPricing(time.Now().Add(10*24*time.Hour), time.Now().Add(40*24*time.Hour))
+	alice := newCaller(auth.RoleParticipant)
+
+	reg := s.register(alice, nil)
+	if len(reg.Installments) != 2 || reg.Installments[0].Amount != 150000 || reg.Installments[1].Amount != 150000 {
+		t.Fatalf("installments = %+v", reg.Installments)
+	}
+	if reg.Balance == nil || *reg.Balance != 300000 || reg.AmountPaid != 0 || !reg.PaymentDueAt.Equal(reg.Installments[0].DueAt) {
+		t.Errorf("registration = %+v", reg)
+	}
+	s.published()
+
+	// Less than the first installment is underpaid; the installment itself is exact
+	pay := registrationPath(reg.RegistrationID, "/payment")
+	payment := decode[repository.Payment](t, s.call(alice, http.MethodPost, pay, paymentBody(map[string]any{"amount": 100000})), http.StatusCreated)
+	if *payment.AmountStatus != repository.AmountUnderpaid {
+		t.Errorf("amount_status = %s, want underpaid", *payment.AmountStatus)
+	}
+	payment = s.pay(alice, reg.RegistrationID)
+	if *payment.AmountStatus != repository.AmountExact {
+		t.Errorf("amount_status = %s, want exact", *payment.AmountStatus)
+	}
+
+	verify := registrationPath(reg.RegistrationID, "/payment/verify")
+	expectStatus(t, s.call(finance, http.MethodPatch, verify, map[string]any{"status": "approved"}), http.StatusOK)
+	got := s.registration(reg.RegistrationID)
+	if got.Status != "partially_paid" || got.AmountPaid != 150000 || *got.Balance != 150000 || !got.PaymentDueAt.Equal(got.Installments[1].DueAt) {
+		t.Errorf("registration = %+v", got)
+	}
+	if topics := s.published(); !slices.Equal(topics, []string{"payment.uploaded", "payment.uploaded", "payment.verified"}) {
+		t.Errorf("published %v", topics)
+	}
+
+	// A rejected installment leaves what was already paid
+	s.pay(alice, reg.RegistrationID)
+	if got := s.registration(reg.RegistrationID); got.Status != "paid" {
+		t.Errorf("status = %s, want paid", got.Status)
+	}
+	body := map[string]any{"status": "rejected", "rejection_reason": "transfer not received"}
+	expectStatus(t, s.call(finance, http.MethodPatch, verify, body), http.StatusOK)
+	if got := s.registration(reg.RegistrationID); got.Status != "partially_paid" || got.AmountPaid != 150000 {
+		t.Errorf("registration = %+v", got)
+	}
+
+	// The last installment confirms the registration
+	s.pay(alice, reg.RegistrationID)
+	s.published()
+	expectStatus(t, s.call(finance, http.MethodPatch, verify, map[string]any{"status": "approved"}), http.StatusOK)
+	got = s.registration(reg.RegistrationID)
+	if got.Status != "confirmed" || got.AmountPaid != 300000 || *got.Balance != 0 || got.PaymentDueAt != nil {
+		t.Errorf("registration = %+v", got)
+	}
+	if topics := s.published(); !slices.Equal(topics, []string{"payment.verified", "registration.confirmed"}) {
+		t.Errorf("published %v", topics)
+	}
+	payments := decode[[]repository.Payment](t, s.call(alice, http.MethodGet, registrationPath(reg.RegistrationID, "/payment/history"), nil), http.StatusOK)
+	if len(payments) != 4 {
+		t.Errorf("payments = %d, want 4", len(payments))
+	}
+}
+
+func TestInstallmentsLateRegistration(t *testing.T) {
+	s := newTestServer(t)
+	// Both installments were due before this registrant's payment window ends
+	s.setInstallmentPricing(time.Now().Add(-48*time.Hour), time.Now().Add(24*time.Hour))
+	alice := newCaller(auth.RoleParticipant)
+
+	reg := s.register(alice, nil)
+	window := time.Now().Add(48 * time.Hour)
+	for i, inst := range reg.Installments {
+		if inst.DueAt.Before(window.Add(-time.Minute)) || !inst.DueAt.Equal(*reg.PaymentDueAt) {
+			t.Errorf("installment %d due %v, want the end of the payment window", i, inst.DueAt)
+		}
+	}
+	res := s.call(alice, http.MethodPost, registrationPath(reg.RegistrationID, "/payment"), paymentBody(nil))
+	if payment := decode[repository.Payment](t, res, http.StatusCreated); *payment.AmountStatus != repository.AmountUnderpaid {
+		t.Errorf("amount_status = %s, want underpaid", *payment.AmountStatus)
+	}
+
+	// Cancelling refunds what was paid so far
+	expectStatus(t, s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), map[string]any{"status": "approved"}), http.StatusOK)
+	expectStatus(t, s.call(alice, http.MethodPost, registrationPath(reg.RegistrationID, "/cancel"), map[string]any{"reason": "cannot attend"}), http.StatusNoContent)
+	refund := decode[repository.Refund](t, s.call(alice, http.MethodGet, registrationPath(reg.RegistrationID, "/refund"), nil), http.StatusOK)
+	if refund.Amount != 150000 {
+		t.Errorf("refund = %+v", refund)
+	}
+}
+
+func TestInstallmentPlanValidation(t *testing.T) {
+	s := newTestServer(t)
+	first := time.Now().Add(10 * 24 * time.Hour)
+	res := s.call(admin, http.MethodPut, eventPath("/pricing"), map[string]any{"base_price": 300000, "installments": []map[string]any{
+		{"percent": 0, "due_at": first.Format(time.RFC3339)},
+		{"percent": 60, "due_at": first.Add(-time.Hour).Format(time.RFC3339)},
+		{"percent": 30},
+	}})
+	expectFieldErrors(t, res, "installments[0].percent", "installments[1].due_at", "installments[2].due_at", "installments")
+
+	// Events without a plan are paid in one go
+	s.setPricing(map[string]any{"base_price": 300000})
+	if reg := s.register(newCaller(auth.RoleParticipant), nil); reg.Installments != nil || *reg.Balance != 300000 {
+		t.Errorf("registration = %+v", reg)
+	}
+}
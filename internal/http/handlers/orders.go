@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/middleware"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+type OrdersHandler struct {
+	repo        repository.OrderStore
+	idempotency repository.IdempotencyStore
+	storage     storage.Storage
+	cfg         *config.Config
+}
+
+func NewOrdersHandler(repo repository.OrderStore, idempotency repository.IdempotencyStore, store storage.Storage, cfg *config.Config) *OrdersHandler {
+	return &OrdersHandler{repo: repo, idempotency: idempotency, storage: store, cfg: cfg}
+}
+
+func (h *OrdersHandler) Register(router fiber.Router) {
+	g := router.Group("/orders")
+	idempotent := middleware.Idempotency(h.idempotency, time.Duration(h.cfg.IdempotencyTTLHours)*time.Hour)
+	g.Post("/", idempotent, h.createOrder)
+	g.Get(":id", h.getOrder)
+	g.Post(":id/payment", idempotent, h.uploadOrderPayment)
+	g.Patch(":id/payment/verify", requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin), h.verifyOrderPayment)
+}
+
+// loadOrder fetches an order the caller is allowed to access, following the
+// rules of loadRegistration with the payer as owner.
+func (h *OrdersHandler) loadOrder(c *fiber.Ctx, id uuid.UUID, write bool) (*repository.Order, error) {
+	return loadOrder(c, h.repo, id, write)
+}
+
+// orderGetter is the part of the stores loadOrder needs.
+type orderGetter interface {
+	GetOrder(ctx context.Context, orderID uuid.UUID) (*repository.Order, error)
+}
+
+func loadOrder(c *fiber.Ctx, repo orderGetter, id uuid.UUID, write bool) (*repository.Order, error) {
+	order, err := repo.GetOrder(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, repository.ErrOrderNotFound
+	}
+
+	p := auth.FromCtx(c)
+	switch {
+	case p == nil, p.HasRole(auth.RoleAdmin), p.Owns(order.PayerUserID):
+		return order, nil
+	case !write && p.HasRole(auth.RoleFinanceVerifier):
+		return order, nil
+	default:
+		return nil, errForbidden
+	}
+}
+
+type orderMemberRequest struct {
+	UserID                   *uuid.UUID `json:"user_id"`
+	FullName                 string     `json:"full_name"`
+	Gender                   string     `json:"gender"`
+	Category                 string     `json:"category"`
+	Phone                    string     `json:"phone"`
+	Email                    string     `json:"email"`
+	Address                  *string    `json:"address"`
+	EmergencyContactName     *string    `json:"emergency_contact_name"`
+	EmergencyContactPhone    *string    `json:"emergency_contact_phone"`
+	EmergencyContactRelation *string    `json:"emergency_contact_relation"`
+	SpecialNeeds             *string    `json:"special_needs"`
+	VoucherCode              string     `json:"voucher_code"`
+}
+
+type createOrderRequest struct {
+	EventID     uuid.UUID            `json:"event_id"`
+	PayerUserID *uuid.UUID           `json:"payer_user_id"`
+	PayerName   string               `json:"payer_name"`
+	PayerEmail  string               `json:"payer_email"`
+	PayerPhone  string               `json:"payer_phone"`
+	Members     []orderMemberRequest `json:"members"`
+}
+
+// CreateOrder godoc
+// @Summary Create an order
+// @Description Register several members (e.g. a family, at most 10) for one event under a single payer, who then pays for all of them with one transfer. Each member gets a registration as with POST /registrations, all in one go: if any member is refused, no one is registered. A member's phone and email default to the payer's. The payer is the caller unless an admin sets payer_user_id; only admins link members to user accounts. amount_due is the combined amount of the members awaiting payment.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string false "Replay-safe retry key"
+// @Param request body createOrderRequest true "Order"
+// @Success 201 {object} repository.Order
+// @Failure 400 {object} problem.Details
+// @Failure 409 {object} problem.Details "Request with the same Idempotency-Key in progress, or voucher used up"
+// @Failure 422 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /orders [post]
+func (h *OrdersHandler) createOrder(c *fiber.Ctx) error {
+	var req createOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	admin := true
+	if p := auth.FromCtx(c); p != nil && !p.HasRole(auth.RoleAdmin) {
+		userID, err := p.UserID()
+		if err != nil {
+			return problem.Respond(c, http.StatusForbidden, err.Error())
+		}
+		req.PayerUserID = &userID
+		admin = false
+	}
+	params := repository.CreateOrderParams{
+		EventID:     req.EventID,
+		PayerUserID: req.PayerUserID,
+		PayerName:   req.PayerName,
+		PayerEmail:  req.PayerEmail,
+		PayerPhone:  req.PayerPhone,
+	}
+	for _, m := range req.Members {
+		member := repository.CreateRegistrationParams{
+			EventID:                  req.EventID,
+			FullName:                 m.FullName,
+			Gender:                   m.Gender,
+			Category:                 m.Category,
+			Phone:                    m.Phone,
+			Email:                    m.Email,
+			Address:                  m.Address,
+			EmergencyContactName:     m.EmergencyContactName,
+			EmergencyContactPhone:    m.EmergencyContactPhone,
+			EmergencyContactRelation: m.EmergencyContactRelation,
+			SpecialNeeds:             m.SpecialNeeds,
+			VoucherCode:              m.VoucherCode,
+		}
+		// A participant cannot register other accounts
+		if admin {
+			member.UserID = m.UserID
+		}
+		if member.Phone == "" {
+			member.Phone = req.PayerPhone
+		}
+		if member.Email == "" {
+			member.Email = req.PayerEmail
+		}
+		params.Members = append(params.Members, member)
+	}
+	if err := params.Validate(); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	order, err := h.repo.CreateOrder(ctx, params, func(reg *repository.Registration) []repository.OutboxMessage {
+		return []repository.OutboxMessage{repository.RegistrationCreatedEvent(h.cfg.KafkaTopicRegCreated, reg)}
+	})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(order)
+}
+
+// GetOrder godoc
+// @Summary Get an order
+// @Description Get an order with its member registrations. Participants only see orders they pay for.
+// @Tags orders
+// @Produce json
+// @Param id path string true "Order ID"
+// @Success 200 {object} repository.Order
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /orders/{id} [get]
+func (h *OrdersHandler) getOrder(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	order, err := h.loadOrder(c, id, false)
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(order)
+}
+
+// UploadOrderPayment godoc
+// @Summary Upload order payment proof
+// @Description Upload proof of one transfer paying for every member of the order awaiting payment, as JSON with a payment_proof_url or as multipart/form-data with a payment_proof file (JPEG, PNG or PDF). Each of those members is marked paid and gets a payment for its share of the amount, in proportion to its amount_due (evenly without pricing); every payment's amount_status compares the whole amount with the order's amount_due.
+// @Tags orders
+// @Accept json,mpfd
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param Idempotency-Key header string false "Replay-safe retry key"
+// @Param request body uploadPaymentRequest false "Payment Proof (JSON)"
+// @Param payment_proof formData file false "Payment proof file (multipart)"
+// @Param amount formData number false "Amount (multipart)"
+// @Param payment_method formData string false "Payment method (multipart)"
+// @Param bank_name formData string false "Bank name (multipart)"
+// @Param account_number formData string false "Account number (multipart)"
+// @Param account_holder_name formData string false "Account holder name (multipart)"
+// @Success 201 {array} repository.Payment
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 409 {object} problem.Details
+// @Failure 413 {object} problem.Details
+// @Failure 415 {object} problem.Details
+// @Failure 422 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /orders/{id}/payment [post]
+func (h *OrdersHandler) uploadOrderPayment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	var req uploadPaymentRequest
+	var proof *multipart.FileHeader
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if req, err = parseMultipartPayment(c); err != nil {
+			return repoError(c, err)
+		}
+		if proof, err = c.FormFile("payment_proof"); err != nil {
+			return repoError(c, validation.Errors{{Field: "payment_proof", Message: "is required"}})
+		}
+	} else if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	if err := req.validate(proof != nil); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	order, err := h.loadOrder(c, id, true)
+	if err != nil {
+		return repoError(c, err)
+	}
+	// Check before storing the proof so refused uploads leave no orphaned files
+	payable := false
+	for _, reg := range order.Registrations {
+		if current := statemachine.Status(reg.Status); current == statemachine.Paid || statemachine.CanTransition(current, statemachine.Paid) {
+			payable = true
+		}
+	}
+	if !payable {
+		return repoError(c, repository.ErrNothingToPay)
+	}
+
+	var proofKey string
+	var proofFilename *string
+	if proof != nil {
+		key, url, status, err := storeProof(ctx, h.storage, h.cfg.UploadMaxBytes, "payment_proof", "orders", id, proof)
+		if status >= http.StatusInternalServerError {
+			return problem.Internal(c, err)
+		}
+		if err != nil {
+			return problem.Respond(c, status, err.Error())
+		}
+		proofKey = key
+		req.PaymentProofURL = &url
+		proofFilename = &proof.Filename
+	}
+
+	payments, err := h.repo.CreateOrderPayment(ctx, repository.CreateOrderPaymentParams{
+		OrderID:              id,
+		Amount:               req.Amount,
+		PaymentMethod:        req.PaymentMethod,
+		PaymentProofURL:      req.PaymentProofURL,
+		PaymentProofFilename: proofFilename,
+		BankName:             req.BankName,
+		AccountNumber:        req.AccountNumber,
+		AccountHolderName:    req.AccountHolderName,
+	}, func(payment *repository.Payment) []repository.OutboxMessage {
+		key := payment.RegistrationID.String()
+		return []repository.OutboxMessage{outboxEvent(h.cfg.KafkaTopicPayUploaded, key, "payment.uploaded", fiber.Map{
+			"payment_id":        payment.PaymentID,
+			"registration_id":   payment.RegistrationID,
+			"order_id":          id,
+			"amount":            payment.Amount,
+			"order_amount":      req.Amount,
+			"order_amount_due":  order.AmountDue,
+			"amount_status":     payment.AmountStatus,
+			"payment_method":    payment.PaymentMethod,
+			"payment_proof_url": payment.PaymentProofURL,
+			"timestamp":         time.Now().UTC().Format(time.RFC3339),
+		})}
+	})
+	if err != nil {
+		discardProof(ctx, h.storage, proofKey)
+		return repoError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(payments)
+}
+
+// VerifyOrderPayment godoc
+// @Summary Verify order payment
+// @Description Approve or reject the pending payment of an order (finance-verifier or admin), deciding for all its members at once. Approval credits each member's share to its amount_paid and confirms the members left with no balance, each emitting registration.confirmed; the others become partially_paid. Rejection returns them to pending (partially_paid if earlier payments were approved), or rejects them when reject_registration is set.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path string true "Order ID"
+// @Param request body verifyPaymentRequest true "Verification Request"
+// @Success 200 {array} repository.Payment
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 409 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /orders/{id}/payment/verify [patch]
+func (h *OrdersHandler) verifyOrderPayment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	var req verifyPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+
+	params := repository.VerifyOrderPaymentParams{
+		OrderID:           id,
+		VerificationNotes: req.Notes,
+	}
+	if p := auth.FromCtx(c); p != nil {
+		verifierID, err := p.UserID()
+		if err != nil {
+			return problem.Respond(c, http.StatusForbidden, err.Error())
+		}
+		params.VerifiedBy = &verifierID
+	}
+	switch req.Status {
+	case "approved":
+		params.Approved = true
+		params.RegistrationStatus = statemachine.Confirmed
+	case "rejected":
+		if req.RejectionReason == nil || *req.RejectionReason == "" {
+			return repoError(c, validation.Errors{{Field: "rejection_reason", Message: "is required when status is rejected"}})
+		}
+		params.RejectionReason = req.RejectionReason
+		params.RegistrationStatus = statemachine.Pending
+		if req.RejectRegistration {
+			params.RegistrationStatus = statemachine.Rejected
+		}
+	default:
+		return repoError(c, validation.Errors{{Field: "status", Message: "must be one of approved, rejected"}})
+	}
+
+	ctx := requestContext(c)
+	now := time.Now().UTC().Format(time.RFC3339)
+	// Events are only relayed once the verification transaction commits
+	payments, err := h.repo.VerifyOrderPayment(ctx, params, func(payment *repository.Payment, reg *repository.Registration) []repository.OutboxMessage {
+		key := payment.RegistrationID.String()
+		events := []repository.OutboxMessage{
+			outboxEvent(h.cfg.KafkaTopicPayVerified, key, "payment.verified", fiber.Map{
+				"payment_id":          payment.PaymentID,
+				"registration_id":     payment.RegistrationID,
+				"order_id":            id,
+				"verification_status": payment.VerificationStatus,
+				"amount":              payment.Amount,
+				"amount_status":       payment.AmountStatus,
+				"amount_paid":         reg.AmountPaid,
+				"balance":             reg.Balance,
+				"registration_status": reg.Status,
+				"verified_by":         params.VerifiedBy,
+				"rejection_reason":    params.RejectionReason,
+				"timestamp":           now,
+			}),
+		}
+		if reg.Status == string(statemachine.Confirmed) {
+			events = append(events, outboxEvent(h.cfg.KafkaTopicRegConfirmed, key, "registration.confirmed", fiber.Map{
+				"registration_id": payment.RegistrationID,
+				"order_id":        id,
+				"timestamp":       now,
+			}))
+		}
+		return events
+	})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(payments)
+}
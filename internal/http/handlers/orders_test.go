@@ -0,0 +1,214 @@
+package handlers_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// orderBody is a family of two parents and a child; members get the payer's
+// phone and email.
+func orderBody(overrides map[string]any) map[string]any {
+	body := map[string]any{
+		"event_id":    eventID,
+		"payer_name":  "Ahmad Fauzi",
+		"payer_email": "ahmad@example.com",
+		"payer_phone": "081234567890",
+		"members": []map[string]any{
+			{"full_name": "Ahmad Fauzi", "gender": "male"},
+			{"full_name": "Siti Aminah", "gender": "female"},
+			{"full_name": "Umar", "gender": "male", "category": "child"},
+		},
+	}
+	for k, v := range overrides {
+		body[k] = v
+	}
+	return body
+}
+
+func (s *testServer) createOrder(as caller, overrides map[string]any) repository.Order {
+	s.t.Helper()
+	return decode[repository.Order](s.t, s.call(as, http.MethodPost, "/api/v1/orders", orderBody(overrides)), http.StatusCreated)
+}
+
+func orderPath(id uuid.UUID, suffix string) string {
+	return "/api/v1/orders/" + id.String() + suffix
+}
+
+func TestOrderPayment(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000, "categories": []map[string]any{{"category": "child", "price": 75000}}})
+	payer := newCaller(auth.RoleParticipant)
+
+	order := s.createOrder(payer, nil)
+	if order.PayerUserID == nil || order.PayerUserID.String() != payer.Subject || len(order.Registrations) != 3 {
+		t.Fatalf("order = %+v", order)
+	}
+	if order.AmountDue == nil || *order.AmountDue != 375000 {
+		t.Errorf("amount_due = %v, want 375000", order.AmountDue)
+	}
+	for _, reg := range order.Registrations {
+		if reg.OrderID == nil || *reg.OrderID != order.OrderID || reg.Status != "pending" || reg.UserID != nil || reg.Email != "ahmad@example.com" {
+			t.Errorf("registration = %+v", reg)
+		}
+	}
+	created := []string{"registration.created", "registration.created", "registration.created"}
+	if topics := s.published(); !slices.Equal(topics, created) {
+		t.Errorf("published %v", topics)
+	}
+
+	decode[repository.Order](t, s.call(finance, http.MethodGet, orderPath(order.OrderID, ""), nil), http.StatusOK)
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, orderPath(order.OrderID, ""), nil), http.StatusForbidden)
+	// Members are paid through their order only
+	member := order.Registrations[0].RegistrationID
+	expectProblem(t, s.call(admin, http.MethodPost, registrationPath(member, "/payment"), paymentBody(nil)), http.StatusConflict)
+
+	payments := decode[[]repository.Payment](t, s.call(payer, http.MethodPost, orderPath(order.OrderID, "/payment"), paymentBody(map[string]any{"amount": 375000})), http.StatusCreated)
+	if len(payments) != 3 {
+		t.Fatalf("payments = %+v", payments)
+	}
+	for i, p := range payments {
+		reg := s.registration(p.RegistrationID)
+		if p.OrderID == nil || *p.OrderID != order.OrderID || p.Amount != *reg.AmountDue || *p.AmountStatus != repository.AmountExact || reg.Status != "paid" {
+			t.Errorf("payment %d = %+v, registration = %+v", i, p, reg)
+		}
+	}
+	expectProblem(t, s.call(finance, http.MethodPatch, registrationPath(member, "/payment/verify"), map[string]any{"status": "approved"}), http.StatusConflict)
+	s.published()
+
+	verify := orderPath(order.OrderID, "/payment/verify")
+	expectProblem(t, s.call(payer, http.MethodPatch, verify, map[string]any{"status": "approved"}), http.StatusForbidden)
+	verified := decode[[]repository.Payment](t, s.call(finance, http.MethodPatch, verify, map[string]any{"status": "approved"}), http.StatusOK)
+	if len(verified) != 3 {
+		t.Fatalf("payments = %+v", verified)
+	}
+	order = decode[repository.Order](t, s.call(payer, http.MethodGet, orderPath(order.OrderID, ""), nil), http.StatusOK)
+	for _, reg := range order.Registrations {
+		if reg.Status != "confirmed" {
+			t.Errorf("status = %s, want confirmed", reg.Status)
+		}
+	}
+	confirmed := []string{
+		"payment.verified", "registration.confirmed",
+		"payment.verified", "registration.confirmed",
+		"payment.verified", "registration.confirmed",
+	}
+	if topics := s.published(); !slices.Equal(topics, confirmed) {
+		t.Errorf("published %v", topics)
+	}
+
+	expectProblem(t, s.call(finance, http.MethodPatch, verify, map[string]any{"status": "approved"}), http.StatusNotFound)
+	expectProblem(t, s.call(payer, http.MethodPost, orderPath(order.OrderID, "/payment"), paymentBody(nil)), http.StatusConflict)
+}
+
+func TestOrderPaymentRejected(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000})
+	payer := newCaller(auth.RoleParticipant)
+	order := s.createOrder(payer, map[string]any{"members": []map[string]any{
+		{"full_name": "Ahmad Fauzi", "gender": "male"},
+		{"full_name": "Siti Aminah", "gender": "female"},
+	}})
+
+	// An underpayment is split in proportion and flagged on every member
+	payments := decode[[]repository.Payment](t, s.call(payer, http.MethodPost, orderPath(order.OrderID, "/payment"), paymentBody(map[string]any{"amount": 200000.01})), http.StatusCreated)
+	if payments[0].Amount+payments[1].Amount != 200000.01 || payments[0].Amount != 100000 || *payments[1].AmountStatus != repository.AmountUnderpaid {
+		t.Errorf("payments = %+v", payments)
+	}
+	// A corrected proof supersedes the first
+	payments = decode[[]repository.Payment](t, s.call(payer, http.MethodPost, orderPath(order.OrderID, "/payment"), paymentBody(map[string]any{"amount": 300000})), http.StatusCreated)
+
+	verify := orderPath(order.OrderID, "/payment/verify")
+	expectFieldErrors(t, s.call(finance, http.MethodPatch, verify, map[string]any{"status": "rejected"}), "rejection_reason")
+	body := map[string]any{"status": "rejected", "rejection_reason": "transfer not received", "reject_registration": true}
+	verified := decode[[]repository.Payment](t, s.call(finance, http.MethodPatch, verify, body), http.StatusOK)
+	for i, p := range verified {
+		if p.PaymentID != payments[i].PaymentID || p.VerificationStatus != "rejected" {
+			t.Errorf("payment %d = %+v", i, p)
+		}
+		if reg := s.registration(p.RegistrationID); reg.Status != "rejected" {
+			t.Errorf("status = %s, want rejected", reg.Status)
+		}
+	}
+	expectProblem(t, s.call(finance, http.MethodPatch, orderPath(uuid.New(), "/payment/verify"), body), http.StatusNotFound)
+}
+
+func TestOrderPayerActsForMembers(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000})
+	payer := newCaller(auth.RoleParticipant)
+	order := s.createOrder(payer, nil)
+	expectStatus(t, s.call(payer, http.MethodPost, orderPath(order.OrderID, "/payment"), paymentBody(map[string]any{"amount": 450000})), http.StatusCreated)
+	expectStatus(t, s.call(finance, http.MethodPatch, orderPath(order.OrderID, "/payment/verify"), map[string]any{"status": "approved"}), http.StatusOK)
+
+	// Members have no account of their own; the payer sees and manages them
+	page := decode[repository.RegistrationPage](t, s.call(payer, http.MethodGet, "/api/v1/registrations", nil), http.StatusOK)
+	if page.Total != 3 {
+		t.Errorf("payer lists %d registrations, want 3", page.Total)
+	}
+	member := order.Registrations[2].RegistrationID
+	other := newCaller(auth.RoleParticipant)
+	expectProblem(t, s.call(other, http.MethodGet, registrationPath(member, ""), nil), http.StatusForbidden)
+	expectProblem(t, s.call(other, http.MethodPost, registrationPath(member, "/cancel"), map[string]any{"reason": "x"}), http.StatusForbidden)
+	if page := decode[repository.RegistrationPage](t, s.call(other, http.MethodGet, "/api/v1/registrations", nil), http.StatusOK); page.Total != 0 {
+		t.Errorf("other participant lists %d registrations", page.Total)
+	}
+
+	expectStatus(t, s.call(payer, http.MethodPost, registrationPath(member, "/cancel"), map[string]any{"reason": "fell ill"}), http.StatusNoContent)
+	if got := decode[repository.Registration](t, s.call(payer, http.MethodGet, registrationPath(member, ""), nil), http.StatusOK); got.Status != "cancelled" {
+		t.Errorf("status = %s, want cancelled", got.Status)
+	}
+	refund := decode[repository.Refund](t, s.call(payer, http.MethodGet, registrationPath(member, "/refund"), nil), http.StatusOK)
+	if refund.Amount != 150000 || refund.Status != "pending" {
+		t.Errorf("refund = %+v", refund)
+	}
+}
+
+func TestCreateOrderValidation(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000, "categories": []map[string]any{{"category": "student", "price": 100000}}})
+	s.createVoucher(map[string]any{"code": "ONCE", "discount_type": "fixed", "discount_value": 50000, "max_uses": 1})
+	payer := newCaller(auth.RoleParticipant)
+
+	expectFieldErrors(t, s.call(payer, http.MethodPost, "/api/v1/orders", map[string]any{"event_id": eventID}),
+		"payer_name", "payer_email", "payer_phone", "members")
+	res := s.call(payer, http.MethodPost, "/api/v1/orders", orderBody(map[string]any{"members": []map[string]any{
+		{"full_name": "Ahmad Fauzi", "gender": "male"},
+		{"gender": "x", "email": "nope"},
+	}}))
+	expectFieldErrors(t, res, "members[1].full_name", "members[1].gender", "members[1].email")
+	// Refused by the store: the event has no child price
+	expectFieldErrors(t, s.call(payer, http.MethodPost, "/api/v1/orders", orderBody(nil)), "members[2].category")
+
+	// When one member is refused no one is registered
+	res = s.call(payer, http.MethodPost, "/api/v1/orders", orderBody(map[string]any{"members": []map[string]any{
+		{"full_name": "Ahmad Fauzi", "gender": "male", "email": "ahmad@example.com", "voucher_code": "ONCE"},
+		{"full_name": "Siti Aminah", "gender": "female", "email": "siti@example.com", "voucher_code": "ONCE"},
+	}}))
+	if p := expectProblem(t, res, http.StatusConflict); p.Code != "voucher_unavailable" {
+		t.Errorf("code = %q", p.Code)
+	}
+	page := decode[repository.RegistrationPage](t, s.call(admin, http.MethodGet, "/api/v1/registrations", nil), http.StatusOK)
+	if len(page.Items) != 0 {
+		t.Errorf("registrations = %+v", page.Items)
+	}
+	vouchers := decode[[]repository.Voucher](t, s.call(admin, http.MethodGet, "/api/v1/vouchers", nil), http.StatusOK)
+	if vouchers[0].UsedCount != 0 {
+		t.Errorf("used_count = %d, want 0", vouchers[0].UsedCount)
+	}
+
+	// Only admins link members to accounts
+	linked := uuid.New()
+	members := []map[string]any{{"full_name": "Ahmad Fauzi", "gender": "male", "user_id": linked}}
+	if order := s.createOrder(payer, map[string]any{"members": members}); order.Registrations[0].UserID != nil {
+		t.Errorf("user_id = %v, want none", order.Registrations[0].UserID)
+	}
+	if order := s.createOrder(admin, map[string]any{"members": members}); *order.Registrations[0].UserID != linked || order.PayerUserID != nil {
+		t.Errorf("order = %+v", order)
+	}
+}
@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+type uploadPaymentRequest struct {
+	Amount            float64 `json:"amount"`
+	PaymentMethod     string  `json:"payment_method"`
+	PaymentProofURL   *string `json:"payment_proof_url"`
+	BankName          *string `json:"bank_name"`
+	AccountNumber     *string `json:"account_number"`
+	AccountHolderName *string `json:"account_holder_name"`
+}
+
+var paymentMethods = []string{"bank_transfer", "ewallet", "cash", "other", "virtual_account", "qris"}
+
+// validate checks the payment fields; hasFile reports whether the proof was
+// uploaded as a file instead of given as a URL.
+func (req uploadPaymentRequest) validate(hasFile bool) error {
+	var v validation.Validator
+	v.Check(req.Amount > 0, "amount", "must be greater than zero")
+	v.Check(req.Amount <= repository.MaxAmount, "amount", fmt.Sprintf("must not exceed %.2f", repository.MaxAmount))
+	if req.PaymentMethod != "" {
+		v.OneOf("payment_method", req.PaymentMethod, paymentMethods...)
+	}
+	if !hasFile {
+		if req.PaymentProofURL == nil || *req.PaymentProofURL == "" {
+			v.Add("payment_proof_url", "is required unless a payment_proof file is uploaded")
+		} else {
+			v.MaxLen("payment_proof_url", *req.PaymentProofURL, 500)
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"bank_name", req.BankName, 100},
+		{"account_number", req.AccountNumber, 50},
+		{"account_holder_name", req.AccountHolderName, 255},
+	} {
+		if f.value != nil {
+			v.MaxLen(f.name, *f.value, f.max)
+		}
+	}
+	return v.Err()
+}
+
+// allowedProofTypes maps accepted payment proof content types to the file
+// extension used when storing them.
+var allowedProofTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+// UploadPaymentProof godoc
+// @Summary Upload payment proof
+// @Description Upload proof of payment for a registration, either as JSON with a payment_proof_url or as multipart/form-data with a payment_proof file (JPEG, PNG or PDF). When the registration has an amount_due, the payment's amount_status says whether it is exact, underpaid or overpaid against its balance; with installments, any amount covering the next installment is exact. A partially_paid registration pays its next installment the same way. Members of an order are paid through the order instead.
+// @Tags payments
+// @Accept json,mpfd
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Param Idempotency-Key header string false "Replay-safe retry key"
+// @Param request body uploadPaymentRequest false "Payment Proof (JSON)"
+// @Param payment_proof formData file false "Payment proof file (multipart)"
+// @Param amount formData number false "Amount (multipart)"
+// @Param payment_method formData string false "Payment method (multipart)"
+// @Param bank_name formData string false "Bank name (multipart)"
+// @Param account_number formData string false "Account number (multipart)"
+// @Param account_holder_name formData string false "Account holder name (multipart)"
+// @Success 201 {object} repository.Payment
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 409 {object} problem.Details
+// @Failure 413 {object} problem.Details
+// @Failure 415 {object} problem.Details
+// @Failure 422 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/payment [post]
+func (h *RegistrationsHandler) uploadPaymentProof(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	var req uploadPaymentRequest
+	var proof *multipart.FileHeader
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if req, err = parseMultipartPayment(c); err != nil {
+			return repoError(c, err)
+		}
+		if proof, err = c.FormFile("payment_proof"); err != nil {
+			return repoError(c, validation.Errors{{Field: "payment_proof", Message: "is required"}})
+		}
+	} else if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	if err := req.validate(proof != nil); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	reg, err := h.loadRegistration(c, id, true)
+	if err != nil {
+		return repoError(c, err)
+	}
+	// Check before storing the proof so refused uploads leave no orphaned files
+	current := statemachine.Status(reg.Status)
+	if current != statemachine.Paid {
+		if err := statemachine.Validate(current, statemachine.Paid); err != nil {
+			return repoError(c, err)
+		}
+	}
+	if reg.OrderID != nil {
+		return repoError(c, repository.ErrPaidByOrder)
+	}
+
+	var proofKey string
+	var proofFilename *string
+	if proof != nil {
+		key, url, status, err := storeProof(ctx, h.storage, h.cfg.UploadMaxBytes, "payment_proof", "payments", id, proof)
+		if status >= http.StatusInternalServerError {
+			return problem.Internal(c, err)
+		}
+		if err != nil {
+			return problem.Respond(c, status, err.Error())
+		}
+		proofKey = key
+		req.PaymentProofURL = &url
+		proofFilename = &proof.Filename
+	}
+
+	paymentID := uuid.New()
+	method := req.PaymentMethod
+	if method == "" {
+		method = "bank_transfer"
+	}
+	uploaded := outboxEvent(h.cfg.KafkaTopicPayUploaded, id.String(), "payment.uploaded", fiber.Map{
+		"payment_id":        paymentID,
+		"registration_id":   id,
+		"amount":            req.Amount,
+		"amount_due":        reg.AmountDue,
+		"balance":           reg.Balance,
+		"amount_status":     reg.PaymentAmountStatus(req.Amount),
+		"payment_method":    method,
+		"payment_proof_url": req.PaymentProofURL,
+		"timestamp":         time.Now().UTC().Format(time.RFC3339),
+	})
+	payment, err := h.payments.CreatePayment(ctx, repository.CreatePaymentParams{
+		PaymentID:            paymentID,
+		RegistrationID:       id,
+		Amount:               req.Amount,
+		PaymentMethod:        method,
+		PaymentProofURL:      req.PaymentProofURL,
+		PaymentProofFilename: proofFilename,
+		BankName:             req.BankName,
+		AccountNumber:        req.AccountNumber,
+		AccountHolderName:    req.AccountHolderName,
+	}, uploaded)
+	if err != nil {
+		discardProof(ctx, h.storage, proofKey)
+		return repoError(c, err)
+	}
+
+	return c.Status(http.StatusCreated).JSON(payment)
+}
+
+func parseMultipartPayment(c *fiber.Ctx) (uploadPaymentRequest, error) {
+	var req uploadPaymentRequest
+	amount, err := strconv.ParseFloat(c.FormValue("amount"), 64)
+	if err != nil {
+		return req, validation.Errors{{Field: "amount", Message: "must be a number"}}
+	}
+	req.Amount = amount
+	req.PaymentMethod = c.FormValue("payment_method")
+	req.BankName = optionalFormValue(c, "bank_name")
+	req.AccountNumber = optionalFormValue(c, "account_number")
+	req.AccountHolderName = optionalFormValue(c, "account_holder_name")
+	return req, nil
+}
+
+func optionalFormValue(c *fiber.Ctx, key string) *string {
+	v := c.FormValue(key)
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// storeProof validates a proof file uploaded as field and saves it to store
+// under dir/ownerID, returning its key and URL or an HTTP status describing
+// why it was refused.
+func storeProof(ctx context.Context, store storage.Storage, maxBytes int, field, dir string, ownerID uuid.UUID, fh *multipart.FileHeader) (key, url string, status int, err error) {
+	if utf8.RuneCountInString(fh.Filename) > 255 {
+		return "", "", http.StatusBadRequest, fmt.Errorf("%s filename must be at most 255 characters", field)
+	}
+	if fh.Size > int64(maxBytes) {
+		return "", "", http.StatusRequestEntityTooLarge, fmt.Errorf("%s exceeds %d bytes", field, maxBytes)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return "", "", http.StatusBadRequest, fmt.Errorf("cannot read %s", field)
+	}
+	defer f.Close()
+
+	// Sniff the content rather than trusting the client-supplied header
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", "", http.StatusBadRequest, fmt.Errorf("cannot read %s", field)
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := allowedProofTypes[contentType]
+	if !ok {
+		return "", "", http.StatusUnsupportedMediaType, fmt.Errorf("%s must be JPEG, PNG or PDF", field)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", "", http.StatusInternalServerError, err
+	}
+
+	key = fmt.Sprintf("%s/%s/%s%s", dir, ownerID, uuid.New(), ext)
+	url, err = store.Save(ctx, key, f, fh.Size, contentType)
+	if err != nil {
+		return "", "", http.StatusInternalServerError, fmt.Errorf("failed to store %s: %w", field, err)
+	}
+	return key, url, http.StatusOK, nil
+}
+
+// discardProof deletes a proof stored by storeProof whose payment or refund
+// was then refused, so it is not left behind. key is empty when no proof was
+// stored.
+func discardProof(ctx context.Context, store storage.Storage, key string) {
+	if key == "" {
+		return
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		log.Printf("failed to discard proof %s: %v", key, err)
+	}
+}
+
+// GetPaymentInfo godoc
+// @Summary Get payment info
+// @Description Get the latest payment status and details
+// @Tags payments
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Success 200 {object} repository.Payment
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/payment [get]
+func (h *RegistrationsHandler) getPaymentInfo(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	if _, err := h.loadRegistration(c, id, false); err != nil {
+		return repoError(c, err)
+	}
+	ctx := context.Background()
+	payment, err := h.payments.GetLatestPaymentByRegistrationID(ctx, id)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if payment == nil {
+		return problem.Respond(c, http.StatusNotFound, "no payment found")
+	}
+	return c.JSON(payment)
+}
+
+// ListPayments godoc
+// @Summary List payment history
+// @Description Get all payments uploaded for a registration, newest first
+// @Tags payments
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Success 200 {array} repository.Payment
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/payment/history [get]
+func (h *RegistrationsHandler) listPayments(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	if _, err := h.loadRegistration(c, id, false); err != nil {
+		return repoError(c, err)
+	}
+	ctx := context.Background()
+	payments, err := h.payments.ListPaymentsByRegistrationID(ctx, id)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if payments == nil {
+		payments = []*repository.Payment{}
+	}
+	return c.JSON(payments)
+}
+
+type verifyPaymentRequest struct {
+	Status             string  `json:"status"`
+	Notes              *string `json:"notes"`
+	RejectionReason    *string `json:"rejection_reason"`
+	RejectRegistration bool    `json:"reject_registration"`
+}
+
+// VerifyPayment godoc
+// @Summary Verify payment
+// @Description Approve or reject the latest pending payment (finance-verifier or admin); uploading a new payment supersedes any earlier one still pending. verified_by is taken from the token subject. Approval adds the payment to the registration's amount_paid and confirms it once no balance remains; until then it is partially_paid. Rejection returns it to pending (partially_paid if earlier payments were approved), or rejects it when reject_registration is set. The payment's amount_status flags an under- or overpayment against what the registration owes for the verifier to act on. Payments of an order are verified through the order instead.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Param request body verifyPaymentRequest true "Verification Request"
+// @Success 200 {object} repository.Payment
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 409 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/payment/verify [patch]
+func (h *RegistrationsHandler) verifyPayment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	var req verifyPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+
+	params := repository.VerifyPaymentParams{
+		RegistrationID:    id,
+		VerificationNotes: req.Notes,
+	}
+	if p := auth.FromCtx(c); p != nil {
+		verifierID, err := p.UserID()
+		if err != nil {
+			return problem.Respond(c, http.StatusForbidden, err.Error())
+		}
+		params.VerifiedBy = &verifierID
+	}
+	switch req.Status {
+	case "approved":
+		params.Approved = true
+		params.RegistrationStatus = statemachine.Confirmed
+	case "rejected":
+		if req.RejectionReason == nil || *req.RejectionReason == "" {
+			return repoError(c, validation.Errors{{Field: "rejection_reason", Message: "is required when status is rejected"}})
+		}
+		params.RejectionReason = req.RejectionReason
+		params.RegistrationStatus = statemachine.Pending
+		if req.RejectRegistration {
+			params.RegistrationStatus = statemachine.Rejected
+		}
+	default:
+		return repoError(c, validation.Errors{{Field: "status", Message: "must be one of approved, rejected"}})
+	}
+
+	ctx := requestContext(c)
+	pending, err := h.payments.GetLatestPaymentByRegistrationID(ctx, id)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if pending == nil || pending.VerificationStatus != "pending" {
+		return repoError(c, repository.ErrNoPendingPayment)
+	}
+	if pending.OrderID != nil {
+		return repoError(c, repository.ErrPaidByOrder)
+	}
+	params.PaymentID = pending.PaymentID
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	// Events are only relayed once the verification transaction commits
+	payment, err := h.payments.VerifyPayment(ctx, params, func(payment *repository.Payment, reg *repository.Registration) []repository.OutboxMessage {
+		events := []repository.OutboxMessage{
+			outboxEvent(h.cfg.KafkaTopicPayVerified, id.String(), "payment.verified", fiber.Map{
+				"payment_id":          payment.PaymentID,
+				"registration_id":     id,
+				"verification_status": payment.VerificationStatus,
+				"amount":              payment.Amount,
+				"amount_status":       payment.AmountStatus,
+				"amount_paid":         reg.AmountPaid,
+				"balance":             reg.Balance,
+				"registration_status": reg.Status,
+				"verified_by":         params.VerifiedBy,
+				"rejection_reason":    params.RejectionReason,
+				"timestamp":           now,
+			}),
+		}
+		// Only the payment that settles the balance confirms the registration
+		if reg.Status == string(statemachine.Confirmed) {
+			events = append(events, outboxEvent(h.cfg.KafkaTopicRegConfirmed, id.String(), "registration.confirmed", fiber.Map{
+				"registration_id": id,
+				"timestamp":       now,
+			}))
+		}
+		return events
+	})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(payment)
+}
@@ -0,0 +1,273 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+)
+
+// pngHeader is enough for content sniffing to detect a PNG.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func paymentBody(overrides map[string]any) map[string]any {
+	body := map[string]any{
+		"amount":            150000,
+		"payment_method":    "bank_transfer",
+		"payment_proof_url": "https://example.com/proof.jpg",
+		"bank_name":         "BCA",
+	}
+	for k, v := range overrides {
+		body[k] = v
+	}
+	return body
+}
+
+func (s *testServer) pay(as caller, id uuid.UUID) repository.Payment {
+	s.t.Helper()
+	res := s.call(as, http.MethodPost, registrationPath(id, "/payment"), paymentBody(nil))
+	return decode[repository.Payment](s.t, res, http.StatusCreated)
+}
+
+func (s *testServer) registration(id uuid.UUID) repository.Registration {
+	s.t.Helper()
+	return decode[repository.Registration](s.t, s.call(admin, http.MethodGet, registrationPath(id, ""), nil), http.StatusOK)
+}
+
+func TestUploadPaymentProof(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	s.published()
+
+	payment := s.pay(alice, reg.RegistrationID)
+	if payment.VerificationStatus != "pending" || payment.Amount != 150000 {
+		t.Errorf("payment = %+v", payment)
+	}
+	if got := s.registration(reg.RegistrationID).Status; got != "paid" {
+		t.Errorf("registration status = %s, want paid", got)
+	}
+	if topics := s.published(); !slices.Equal(topics, []string{"payment.uploaded"}) {
+		t.Errorf("published %v", topics)
+	}
+	// A corrected proof may be uploaded while paid
+	s.pay(alice, reg.RegistrationID)
+}
+
+func TestPaymentProofDownload(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	fields := map[string]string{"amount": "150000", "payment_method": "bank_transfer"}
+	res := s.send(alice, multipartRequest(t, http.MethodPost, registrationPath(reg.RegistrationID, "/payment"), fields, "payment_proof", "receipt.png", pngHeader))
+	payment := decode[repository.Payment](t, res, http.StatusCreated)
+	proof := *payment.PaymentProofURL
+
+	// Proofs show bank details: only the owner and staff may fetch them
+	for _, as := range []caller{alice, finance, admin} {
+		res := s.call(as, http.MethodGet, proof, nil)
+		expectStatus(t, res, http.StatusOK)
+		if !bytes.Equal(res.Body, pngHeader) || res.Header.Get(fiber.HeaderContentType) != "image/png" {
+			t.Errorf("proof = %q (%s)", res.Body, res.Header.Get(fiber.HeaderContentType))
+		}
+	}
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, proof, nil), http.StatusForbidden)
+	expectProblem(t, s.call(anonymous, http.MethodGet, proof, nil), http.StatusUnauthorized)
+
+	dir := storage.FilesURLPrefix + "/payments/" + reg.RegistrationID.String() + "/"
+	expectProblem(t, s.call(alice, http.MethodGet, dir+uuid.NewString()+".png", nil), http.StatusNotFound)
+	expectProblem(t, s.call(alice, http.MethodGet, dir+"..%2F..%2Fsecret.png", nil), http.StatusNotFound)
+	expectProblem(t, s.call(alice, http.MethodGet, strings.Replace(proof, "/payments/", "/other/", 1), nil), http.StatusNotFound)
+}
+
+func TestUploadPaymentProofMultipart(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.UploadMaxBytes = 1024 })
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	path := registrationPath(reg.RegistrationID, "/payment")
+	fields := map[string]string{"amount": "150000", "payment_method": "ewallet"}
+
+	res := s.send(alice, multipartRequest(t, http.MethodPost, path, fields, "payment_proof", "proof.png", pngHeader))
+	payment := decode[repository.Payment](t, res, http.StatusCreated)
+	if payment.PaymentProofURL == nil || !strings.HasPrefix(*payment.PaymentProofURL, storage.FilesURLPrefix+"/payments/") {
+		t.Errorf("payment_proof_url = %v", payment.PaymentProofURL)
+	}
+	if payment.PaymentProofFilename == nil || *payment.PaymentProofFilename != "proof.png" {
+		t.Errorf("payment_proof_filename = %v", payment.PaymentProofFilename)
+	}
+
+	res = s.send(alice, multipartRequest(t, http.MethodPost, path, fields, "payment_proof", "proof.txt", []byte("plain text")))
+	expectProblem(t, res, http.StatusUnsupportedMediaType)
+	big := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 2048)...)
+	res = s.send(alice, multipartRequest(t, http.MethodPost, path, fields, "payment_proof", "big.png", big))
+	expectProblem(t, res, http.StatusRequestEntityTooLarge)
+	res = s.send(alice, multipartRequest(t, http.MethodPost, path, fields, "", "", nil))
+	expectFieldErrors(t, res, "payment_proof")
+	res = s.send(alice, multipartRequest(t, http.MethodPost, path, map[string]string{"amount": "lots"}, "payment_proof", "proof.png", pngHeader))
+	expectFieldErrors(t, res, "amount")
+}
+
+func TestUploadPaymentProofErrors(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	path := registrationPath(reg.RegistrationID, "/payment")
+
+	res := s.call(alice, http.MethodPost, path, map[string]any{"amount": 0, "payment_method": "gold", "bank_name": strings.Repeat("x", 101)})
+	expectFieldErrors(t, res, "amount", "payment_method", "payment_proof_url", "bank_name")
+	expectFieldErrors(t, s.call(alice, http.MethodPost, path, paymentBody(map[string]any{"amount": 1e9})), "amount")
+	expectProblem(t, s.call(alice, http.MethodPost, path, "{"), http.StatusBadRequest)
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodPost, path, paymentBody(nil)), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodPost, registrationPath(uuid.New(), "/payment"), paymentBody(nil)), http.StatusNotFound)
+
+	expectStatus(t, s.call(alice, http.MethodPost, registrationPath(reg.RegistrationID, "/cancel"), map[string]any{"reason": "x"}), http.StatusNoContent)
+	p := expectProblem(t, s.call(alice, http.MethodPost, path, paymentBody(nil)), http.StatusConflict)
+	if p.CurrentStatus != "cancelled" {
+		t.Errorf("current_status = %q, want cancelled", p.CurrentStatus)
+	}
+}
+
+func TestGetPaymentInfo(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	path := registrationPath(reg.RegistrationID, "/payment")
+
+	expectProblem(t, s.call(alice, http.MethodGet, path, nil), http.StatusNotFound)
+	first := s.pay(alice, reg.RegistrationID)
+	got := decode[repository.Payment](t, s.call(finance, http.MethodGet, path, nil), http.StatusOK)
+	if got.PaymentID != first.PaymentID {
+		t.Errorf("payment = %s, want %s", got.PaymentID, first.PaymentID)
+	}
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, path, nil), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/registrations/x/payment", nil), http.StatusBadRequest)
+}
+
+func TestListPayments(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	path := registrationPath(reg.RegistrationID, "/payment/history")
+
+	if got := decode[[]repository.Payment](t, s.call(alice, http.MethodGet, path, nil), http.StatusOK); len(got) != 0 {
+		t.Errorf("got %d payments before any upload", len(got))
+	}
+	first := s.pay(alice, reg.RegistrationID)
+	second := s.pay(alice, reg.RegistrationID)
+	got := decode[[]repository.Payment](t, s.call(alice, http.MethodGet, path, nil), http.StatusOK)
+	if len(got) != 2 || got[0].PaymentID != second.PaymentID || got[1].PaymentID != first.PaymentID {
+		t.Errorf("payments not listed newest first: %+v", got)
+	}
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, path, nil), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, registrationPath(uuid.New(), "/payment/history"), nil), http.StatusNotFound)
+}
+
+func TestVerifyPayment(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+
+	t.Run("approve", func(t *testing.T) {
+		reg := s.register(alice, map[string]any{"event_id": uuid.New()})
+		s.pay(alice, reg.RegistrationID)
+		s.published()
+
+		res := s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), map[string]any{"status": "approved"})
+		payment := decode[repository.Payment](t, res, http.StatusOK)
+		if payment.VerificationStatus != "approved" || payment.VerifiedBy == nil || *payment.VerifiedBy != finance.userID() {
+			t.Errorf("payment = %+v", payment)
+		}
+		if got := s.registration(reg.RegistrationID).Status; got != "confirmed" {
+			t.Errorf("registration status = %s, want confirmed", got)
+		}
+		if topics := s.published(); !slices.Equal(topics, []string{"payment.verified", "registration.confirmed"}) {
+			t.Errorf("published %v", topics)
+		}
+		// Nothing left to verify
+		expectProblem(t, s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), map[string]any{"status": "approved"}), http.StatusNotFound)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		reg := s.register(alice, map[string]any{"event_id": uuid.New()})
+		s.pay(alice, reg.RegistrationID)
+		path := registrationPath(reg.RegistrationID, "/payment/verify")
+
+		expectFieldErrors(t, s.call(finance, http.MethodPatch, path, map[string]any{"status": "rejected"}), "rejection_reason")
+		res := s.call(finance, http.MethodPatch, path, map[string]any{"status": "rejected", "rejection_reason": "blurry"})
+		if got := decode[repository.Payment](t, res, http.StatusOK); got.VerificationStatus != "rejected" {
+			t.Errorf("verification_status = %s, want rejected", got.VerificationStatus)
+		}
+		// The participant may upload again
+		if got := s.registration(reg.RegistrationID).Status; got != "pending" {
+			t.Errorf("registration status = %s, want pending", got)
+		}
+	})
+
+	t.Run("superseded", func(t *testing.T) {
+		reg := s.register(alice, map[string]any{"event_id": uuid.New()})
+		first := s.pay(alice, reg.RegistrationID)
+		second := s.pay(alice, reg.RegistrationID)
+
+		// A corrected upload replaces the one still awaiting review
+		res := s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), map[string]any{"status": "approved"})
+		if got := decode[repository.Payment](t, res, http.StatusOK); got.PaymentID != second.PaymentID {
+			t.Errorf("verified %s, want the latest payment %s", got.PaymentID, second.PaymentID)
+		}
+		history := decode[[]repository.Payment](t, s.call(finance, http.MethodGet, registrationPath(reg.RegistrationID, "/payment/history"), nil), http.StatusOK)
+		if len(history) != 2 || history[1].PaymentID != first.PaymentID || history[1].VerificationStatus != "superseded" {
+			t.Errorf("history = %+v", history)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		reg := s.register(alice, map[string]any{"event_id": uuid.New()})
+		path := registrationPath(reg.RegistrationID, "/payment/verify")
+
+		expectProblem(t, s.call(finance, http.MethodPatch, path, map[string]any{"status": "approved"}), http.StatusNotFound)
+		expectFieldErrors(t, s.call(finance, http.MethodPatch, path, map[string]any{"status": "maybe"}), "status")
+		expectProblem(t, s.call(finance, http.MethodPatch, path, "{"), http.StatusBadRequest)
+		expectProblem(t, s.call(alice, http.MethodPatch, path, map[string]any{"status": "approved"}), http.StatusForbidden)
+		expectProblem(t, s.call(finance, http.MethodPatch, "/api/v1/registrations/x/payment/verify", map[string]any{"status": "approved"}), http.StatusBadRequest)
+	})
+}
+
+func TestVerifyPaymentAfterDeadline(t *testing.T) {
+	// Registrations start out past their deadline; the event's own window
+	// is what a reopened one gets
+	s := newTestServer(t, func(cfg *config.Config) { cfg.PaymentWindowHours = -1 })
+	s.setPricing(map[string]any{"base_price": 150000})
+	s.setCapacity(map[string]any{"payment_window_hours": 24})
+	alice := newCaller(auth.RoleParticipant)
+	window := time.Now().Add(24 * time.Hour)
+
+	t.Run("reject", func(t *testing.T) {
+		reg := s.register(alice, nil)
+		s.pay(alice, reg.RegistrationID)
+		res := s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), map[string]any{"status": "rejected", "rejection_reason": "blurry"})
+		expectStatus(t, res, http.StatusOK)
+		got := s.registration(reg.RegistrationID)
+		if got.Status != "pending" || got.PaymentDueAt == nil || got.PaymentDueAt.Before(window.Add(-time.Minute)) {
+			t.Errorf("status = %s, payment_due_at = %v; want pending until about %v", got.Status, got.PaymentDueAt, window)
+		}
+	})
+
+	t.Run("underpaid", func(t *testing.T) {
+		reg := s.register(newCaller(auth.RoleParticipant), nil)
+		expectStatus(t, s.call(admin, http.MethodPost, registrationPath(reg.RegistrationID, "/payment"), paymentBody(map[string]any{"amount": 100000})), http.StatusCreated)
+		res := s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), map[string]any{"status": "approved"})
+		expectStatus(t, res, http.StatusOK)
+		got := s.registration(reg.RegistrationID)
+		if got.Status != "partially_paid" || got.PaymentDueAt == nil || got.PaymentDueAt.Before(window.Add(-time.Minute)) {
+			t.Errorf("status = %s, payment_due_at = %v; want partially_paid until about %v", got.Status, got.PaymentDueAt, window)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+type setPricingRequest struct {
+	BasePrice    float64                      `json:"base_price"`
+	MalePrice    *float64                     `json:"male_price"`
+	FemalePrice  *float64                     `json:"female_price"`
+	Categories   []repository.CategoryPrice   `json:"categories"`
+	EarlyBird    []repository.EarlyBirdWindow `json:"early_bird"`
+	Installments []repository.InstallmentRule `json:"installments"`
+}
+
+// GetPricing godoc
+// @Summary Get event pricing
+// @Description Get what registering for an event costs
+// @Tags pricing
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Success 200 {object} repository.EventPricing
+// @Failure 400 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/pricing [get]
+func (h *EventsHandler) getPricing(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	ctx := context.Background()
+	pricing, err := h.repo.GetEventPricing(ctx, eventID)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if pricing == nil {
+		return problem.Respond(c, http.StatusNotFound, "no pricing configured for event")
+	}
+	return c.JSON(pricing)
+}
+
+// SetPricing godoc
+// @Summary Set event pricing
+// @Description Set the prices of an event (admin). A registration costs the price of its category if one matches, else male_price or female_price for its gender if set, else base_price; the early-bird window open at registration (the one ending soonest if several are) takes discount_percent off. E.g. {"base_price":150000,"categories":[{"category":"student","price":100000}],"early_bird":[{"name":"early bird","ends_at":"2026-01-31T23:59:59+07:00","discount_percent":20}]}. When categories are set, registrations must name one of them or leave category empty. installments splits the price into parts, e.g. [{"percent":50,"due_at":"2026-02-01T00:00:00+07:00"},{"percent":50,"due_at":"2026-03-01T00:00:00+07:00"}]; percents add up to 100 and due dates ascend. A registration's schedule is fixed when it becomes pending, with no installment due before its payment window ends, and its payment_due_at follows the next unpaid installment. New registrations get the resulting amount_due and installments; existing ones keep theirs.
+// @Tags pricing
+// @Accept json
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Param request body setPricingRequest true "Pricing"
+// @Success 200 {object} repository.EventPricing
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/pricing [put]
+func (h *EventsHandler) setPricing(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	var req setPricingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	params := repository.UpsertEventPricingParams{
+		EventID:      eventID,
+		BasePrice:    req.BasePrice,
+		MalePrice:    req.MalePrice,
+		FemalePrice:  req.FemalePrice,
+		Categories:   req.Categories,
+		EarlyBird:    req.EarlyBird,
+		Installments: req.Installments,
+	}
+	if err := params.Validate(); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	pricing, err := h.repo.UpsertEventPricing(ctx, params)
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(pricing)
+}
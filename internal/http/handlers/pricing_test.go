@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/importer"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+func (s *testServer) setPricing(body map[string]any) {
+	s.t.Helper()
+	expectStatus(s.t, s.call(admin, http.MethodPut, eventPath("/pricing"), body), http.StatusOK)
+}
+
+func TestEventPricing(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	path := eventPath("/pricing")
+
+	expectProblem(t, s.call(alice, http.MethodGet, path, nil), http.StatusNotFound)
+	// Without pricing nothing is due
+	if reg := s.register(newCaller(auth.RoleParticipant), nil); reg.AmountDue != nil {
+		t.Errorf("amount_due = %v, want none", *reg.AmountDue)
+	}
+
+	body := map[string]any{
+		"base_price": 150000,
+		"male_price": 175000,
+		"categories": []map[string]any{{"category": "student", "price": 100000}},
+		"early_bird": []map[string]any{
+			{"name": "super early", "ends_at": time.Now().Add(-time.Hour).Format(time.RFC3339), "discount_percent": 50},
+			{"name": "early bird", "ends_at": time.Now().Add(24 * time.Hour).Format(time.RFC3339), "discount_percent": 20},
+		},
+	}
+	pricing := decode[repository.EventPricing](t, s.call(admin, http.MethodPut, path, body), http.StatusOK)
+	if pricing.BasePrice != 150000 || len(pricing.Categories) != 1 || len(pricing.EarlyBird) != 2 {
+		t.Errorf("pricing = %+v", pricing)
+	}
+	decode[repository.EventPricing](t, s.call(alice, http.MethodGet, path, nil), http.StatusOK)
+
+	// The expired window is ignored, the open one takes 20% off
+	for _, tc := range []struct {
+		overrides map[string]any
+		want      float64
+	}{
+		{map[string]any{}, 120000},
+		{map[string]any{"gender": "male"}, 140000},
+		{map[string]any{"gender": "male", "category": "student"}, 80000},
+	} {
+		reg := s.register(newCaller(auth.RoleParticipant), tc.overrides)
+		if reg.AmountDue == nil || *reg.AmountDue != tc.want {
+			t.Errorf("%v: amount_due = %v, want %v", tc.overrides, reg.AmountDue, tc.want)
+		}
+	}
+	res := s.call(newCaller(auth.RoleParticipant), http.MethodPost, "/api/v1/registrations", registrationBody(map[string]any{"category": "vip"}))
+	expectFieldErrors(t, res, "category")
+
+	res = s.call(admin, http.MethodPut, path, map[string]any{
+		"base_price": -1,
+		"categories": []map[string]any{{"category": "", "price": 1}, {"category": "a", "price": 1}, {"category": "a", "price": 1}},
+		"early_bird": []map[string]any{{"name": "x", "discount_percent": 0}},
+	})
+	expectFieldErrors(t, res, "base_price", "categories[0].category", "categories[2].category", "early_bird[0].ends_at", "early_bird[0].discount_percent")
+	expectProblem(t, s.call(admin, http.MethodPut, path, "{"), http.StatusBadRequest)
+	expectProblem(t, s.call(finance, http.MethodPut, path, body), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/events/x/pricing", nil), http.StatusBadRequest)
+}
+
+func TestPaymentAmountStatus(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000})
+
+	for _, tc := range []struct {
+		amount float64
+		want   string
+	}{
+		{150000, repository.AmountExact},
+		{100000, repository.AmountUnderpaid},
+		{150000.01, repository.AmountOverpaid},
+	} {
+		alice := newCaller(auth.RoleParticipant)
+		reg := s.register(alice, nil)
+		res := s.call(alice, http.MethodPost, registrationPath(reg.RegistrationID, "/payment"), paymentBody(map[string]any{"amount": tc.amount}))
+		payment := decode[repository.Payment](t, res, http.StatusCreated)
+		if payment.AmountStatus == nil || *payment.AmountStatus != tc.want {
+			t.Errorf("amount %v: amount_status = %v, want %s", tc.amount, payment.AmountStatus, tc.want)
+		}
+	}
+
+	// Registrations without pricing are not compared
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, map[string]any{"event_id": uuid.New()})
+	if payment := s.pay(alice, reg.RegistrationID); payment.AmountStatus != nil {
+		t.Errorf("amount_status = %s, want none", *payment.AmountStatus)
+	}
+}
+
+func TestImportRegistrationsPricing(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000, "categories": []map[string]any{{"category": "student", "price": 100000}}})
+
+	file := "full_name,gender,phone,email,category\n" +
+		"Andi,male,081211112222,andi@example.com,student\n" +
+		"Budi,male,081211113333,budi@example.com,\n" +
+		"Citra,female,081211114444,citra@example.com,vip\n"
+	req := httptest.NewRequest(http.MethodPost, eventPath("/registrations/import"), strings.NewReader(file))
+	req.Header.Set(fiber.HeaderContentType, "text/csv")
+	report := decode[importer.Report](t, s.send(admin, req), http.StatusOK)
+	if report.Imported != 2 || len(report.Errors) != 1 || report.Errors[0].Row != 4 {
+		t.Errorf("report = %+v", report)
+	}
+
+	results := decode[[]repository.RegistrationSearchResult](t, s.call(admin, http.MethodGet, "/api/v1/registrations/search?q=andi", nil), http.StatusOK)
+	if len(results) != 1 {
+		t.Fatalf("results = %+v", results)
+	}
+	reg := s.registration(results[0].RegistrationID)
+	if reg.Category == nil || *reg.Category != "student" || reg.AmountDue == nil || *reg.AmountDue != 100000 {
+		t.Errorf("registration = %+v", reg)
+	}
+}
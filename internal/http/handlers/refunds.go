@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+// GetRefund godoc
+// @Summary Get refund
+// @Description Get the refund opened when a registration with an approved payment was cancelled
+// @Tags refunds
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Success 200 {object} repository.Refund
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/refund [get]
+func (h *RegistrationsHandler) getRefund(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	if _, err := h.loadRegistration(c, id, false); err != nil {
+		return repoError(c, err)
+	}
+	ctx := context.Background()
+	refund, err := h.refunds.GetRefundByRegistrationID(ctx, id)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if refund == nil {
+		return problem.Respond(c, http.StatusNotFound, "no refund found")
+	}
+	return c.JSON(refund)
+}
+
+type processRefundRequest struct {
+	RefundProofURL *string `json:"refund_proof_url"`
+	Notes          *string `json:"notes"`
+}
+
+// ProcessRefund godoc
+// @Summary Mark refund as processed
+// @Description Record that the pending refund of a registration was paid out (finance-verifier or admin), with proof of the transfer as a refund_proof_url or a multipart refund_proof file (JPEG, PNG or PDF). processed_by is taken from the token subject. Publishes payment.refunded.
+// @Tags refunds
+// @Accept json,mpfd
+// @Produce json
+// @Param id path string true "Registration ID"
+// @Param request body processRefundRequest false "Refund proof (JSON)"
+// @Param refund_proof formData file false "Refund proof file (multipart)"
+// @Param notes formData string false "Notes (multipart)"
+// @Success 200 {object} repository.Refund
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 413 {object} problem.Details
+// @Failure 415 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/refund/process [patch]
+func (h *RegistrationsHandler) processRefund(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	var req processRefundRequest
+	var proof *multipart.FileHeader
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		req.Notes = optionalFormValue(c, "notes")
+		if proof, err = c.FormFile("refund_proof"); err != nil {
+			return repoError(c, validation.Errors{{Field: "refund_proof", Message: "is required"}})
+		}
+	} else if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	if proof == nil {
+		var v validation.Validator
+		if req.RefundProofURL == nil || *req.RefundProofURL == "" {
+			v.Add("refund_proof_url", "is required unless a refund_proof file is uploaded")
+		} else {
+			v.MaxLen("refund_proof_url", *req.RefundProofURL, 500)
+		}
+		if err := v.Err(); err != nil {
+			return repoError(c, err)
+		}
+	}
+
+	params := repository.ProcessRefundParams{
+		RegistrationID: id,
+		RefundProofURL: req.RefundProofURL,
+		Notes:          req.Notes,
+	}
+	if p := auth.FromCtx(c); p != nil {
+		processorID, err := p.UserID()
+		if err != nil {
+			return problem.Respond(c, http.StatusForbidden, err.Error())
+		}
+		params.ProcessedBy = &processorID
+	}
+
+	ctx := requestContext(c)
+	pending, err := h.refunds.GetRefundByRegistrationID(ctx, id)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if pending == nil || pending.Status != "pending" {
+		return repoError(c, repository.ErrNoPendingRefund)
+	}
+	params.RefundID = pending.RefundID
+
+	// Checked above so refused requests leave no orphaned files
+	var proofKey string
+	if proof != nil {
+		key, url, status, err := storeProof(ctx, h.storage, h.cfg.UploadMaxBytes, "refund_proof", "refunds", id, proof)
+		if status >= http.StatusInternalServerError {
+			return problem.Internal(c, err)
+		}
+		if err != nil {
+			return problem.Respond(c, status, err.Error())
+		}
+		proofKey = key
+		params.RefundProofURL = &url
+		params.RefundProofFilename = &proof.Filename
+	}
+
+	processed := *pending
+	processed.RefundProofURL = params.RefundProofURL
+	processed.ProcessedBy = params.ProcessedBy
+	refunded := repository.RefundProcessedEvent(h.cfg.KafkaTopicPayRefunded, &processed)
+
+	refund, err := h.refunds.ProcessRefund(ctx, params, refunded)
+	if err != nil {
+		discardProof(ctx, h.storage, proofKey)
+		return repoError(c, err)
+	}
+	return c.JSON(refund)
+}
+
+type setRefundPolicyRequest struct {
+	EventStartsAt time.Time               `json:"event_starts_at"`
+	Rules         []repository.RefundRule `json:"rules"`
+}
+
+// GetRefundPolicy godoc
+// @Summary Get event refund policy
+// @Description Get how much of an approved payment is refunded when a registration of the event is cancelled
+// @Tags refunds
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Success 200 {object} repository.RefundPolicy
+// @Failure 400 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/refund-policy [get]
+func (h *EventsHandler) getRefundPolicy(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	ctx := context.Background()
+	policy, err := h.refunds.GetRefundPolicy(ctx, eventID)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if policy == nil {
+		return problem.Respond(c, http.StatusNotFound, "no refund policy configured for event")
+	}
+	return c.JSON(policy)
+}
+
+// SetRefundPolicy godoc
+// @Summary Set event refund policy
+// @Description Set the event start and the refund rules (admin). A cancellation at least days_before days before the start refunds percent of the approved payment; the applicable rule with the largest days_before wins and none applying refunds nothing. E.g. [{"days_before":7,"percent":100},{"days_before":0,"percent":50}]. Events without a policy refund in full.
+// @Tags refunds
+// @Accept json
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Param request body setRefundPolicyRequest true "Refund policy"
+// @Success 200 {object} repository.RefundPolicy
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/refund-policy [put]
+func (h *EventsHandler) setRefundPolicy(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	var req setRefundPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	params := repository.UpsertRefundPolicyParams{
+		EventID:       eventID,
+		EventStartsAt: req.EventStartsAt,
+		Rules:         req.Rules,
+	}
+	if err := params.Validate(); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	policy, err := h.refunds.UpsertRefundPolicy(ctx, params)
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(policy)
+}
+
+// ListRefunds godoc
+// @Summary List refunds of an event
+// @Description List an event's refunds, oldest first; status=pending gives finance the payout queue. Staff only.
+// @Tags refunds
+// @Produce json
+// @Param event_id path string true "Event ID"
+// @Param status query string false "pending or processed"
+// @Param limit query int false "Max results (max 100)" default(20)
+// @Success 200 {array} repository.Refund
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /events/{event_id}/refunds [get]
+func (h *EventsHandler) listRefunds(c *fiber.Ctx) error {
+	eventID, err := uuid.Parse(c.Params("event_id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid event_id")
+	}
+	status := c.Query("status")
+	if status != "" && status != "pending" && status != "processed" {
+		return problem.Respond(c, http.StatusBadRequest, "status must be pending or processed")
+	}
+	limit := c.QueryInt("limit", defaultPageSize)
+	if limit < 1 || limit > maxPageSize {
+		return problem.Respond(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+	}
+
+	ctx := context.Background()
+	refunds, err := h.refunds.ListRefunds(ctx, repository.RefundFilter{EventID: eventID, Status: status, Limit: limit})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(refunds)
+}
@@ -0,0 +1,140 @@
+package handlers_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// cancelPaid registers as, pays, has finance approve the payment and then
+// cancels, returning the registration.
+func (s *testServer) cancelPaid(as caller, eventID uuid.UUID) repository.Registration {
+	s.t.Helper()
+	reg := s.register(as, map[string]any{"event_id": eventID})
+	s.pay(as, reg.RegistrationID)
+	res := s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), map[string]any{"status": "approved"})
+	expectStatus(s.t, res, http.StatusOK)
+	res = s.call(as, http.MethodPost, registrationPath(reg.RegistrationID, "/cancel"), map[string]any{"reason": "cannot attend"})
+	expectStatus(s.t, res, http.StatusNoContent)
+	return reg
+}
+
+func refundPolicyPath(eventID uuid.UUID) string {
+	return "/api/v1/events/" + eventID.String() + "/refund-policy"
+}
+
+func TestRefundWithoutPolicy(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.cancelPaid(alice, uuid.New())
+	path := registrationPath(reg.RegistrationID, "/refund")
+
+	refund := decode[repository.Refund](t, s.call(alice, http.MethodGet, path, nil), http.StatusOK)
+	if refund.Status != "pending" || refund.Percent != 100 || refund.RefundType != "full" || refund.Amount != 150000 {
+		t.Errorf("refund = %+v", refund)
+	}
+	s.published()
+
+	res := s.call(finance, http.MethodPatch, path+"/process", map[string]any{"refund_proof_url": "https://example.com/transfer.pdf", "notes": "BCA"})
+	refund = decode[repository.Refund](t, res, http.StatusOK)
+	if refund.Status != "processed" || refund.ProcessedBy == nil || *refund.ProcessedBy != finance.userID() || refund.ProcessedAt == nil {
+		t.Errorf("refund = %+v", refund)
+	}
+	if topics := s.published(); !slices.Equal(topics, []string{"payment.refunded"}) {
+		t.Errorf("published %v", topics)
+	}
+	// Already processed
+	expectProblem(t, s.call(finance, http.MethodPatch, path+"/process", map[string]any{"refund_proof_url": "https://example.com/x.pdf"}), http.StatusNotFound)
+}
+
+func TestRefundPolicy(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	event := uuid.New()
+	path := refundPolicyPath(event)
+
+	expectProblem(t, s.call(alice, http.MethodGet, path, nil), http.StatusNotFound)
+	rules := []map[string]any{{"days_before": 7, "percent": 100}, {"days_before": 0, "percent": 50}}
+	body := map[string]any{"event_starts_at": time.Now().Add(72 * time.Hour).Format(time.RFC3339), "rules": rules}
+	policy := decode[repository.RefundPolicy](t, s.call(admin, http.MethodPut, path, body), http.StatusOK)
+	if len(policy.Rules) != 2 {
+		t.Errorf("policy = %+v", policy)
+	}
+	decode[repository.RefundPolicy](t, s.call(alice, http.MethodGet, path, nil), http.StatusOK)
+
+	// Three days before the start only the 50% rule applies
+	reg := s.cancelPaid(alice, event)
+	refund := decode[repository.Refund](t, s.call(alice, http.MethodGet, registrationPath(reg.RegistrationID, "/refund"), nil), http.StatusOK)
+	if refund.Percent != 50 || refund.RefundType != "partial" || refund.Amount != 75000 {
+		t.Errorf("refund = %+v", refund)
+	}
+
+	// After the start nothing is refunded
+	body["event_starts_at"] = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	expectStatus(t, s.call(admin, http.MethodPut, path, body), http.StatusOK)
+	late := s.cancelPaid(newCaller(auth.RoleParticipant), event)
+	expectProblem(t, s.call(admin, http.MethodGet, registrationPath(late.RegistrationID, "/refund"), nil), http.StatusNotFound)
+
+	res := s.call(admin, http.MethodPut, path, map[string]any{"rules": []map[string]any{{"days_before": -1, "percent": 101}, {"days_before": -1, "percent": 10}}})
+	expectFieldErrors(t, res, "event_starts_at", "rules[0].days_before", "rules[0].percent", "rules[1].days_before", "rules[1].days_before")
+	expectProblem(t, s.call(admin, http.MethodPut, path, map[string]any{"event_starts_at": "tomorrow"}), http.StatusBadRequest)
+	expectProblem(t, s.call(finance, http.MethodPut, path, body), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/events/x/refund-policy", nil), http.StatusBadRequest)
+}
+
+func TestProcessRefundErrors(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.cancelPaid(alice, uuid.New())
+	path := registrationPath(reg.RegistrationID, "/refund/process")
+
+	expectFieldErrors(t, s.call(finance, http.MethodPatch, path, map[string]any{}), "refund_proof_url")
+	expectProblem(t, s.call(finance, http.MethodPatch, path, "{"), http.StatusBadRequest)
+	expectProblem(t, s.call(alice, http.MethodPatch, path, map[string]any{"refund_proof_url": "https://example.com/x.pdf"}), http.StatusForbidden)
+	res := s.send(finance, multipartRequest(t, http.MethodPatch, path, nil, "", "", nil))
+	expectFieldErrors(t, res, "refund_proof")
+	res = s.send(finance, multipartRequest(t, http.MethodPatch, path, nil, "refund_proof", "proof.txt", []byte("plain text")))
+	expectProblem(t, res, http.StatusUnsupportedMediaType)
+
+	res = s.send(finance, multipartRequest(t, http.MethodPatch, path, map[string]string{"notes": "BCA"}, "refund_proof", "transfer.png", pngHeader))
+	refund := decode[repository.Refund](t, res, http.StatusOK)
+	if refund.RefundProofFilename == nil || *refund.RefundProofFilename != "transfer.png" || refund.Notes == nil {
+		t.Errorf("refund = %+v", refund)
+	}
+
+	// Cancelled before paying: nothing to refund
+	unpaid := s.register(alice, map[string]any{"event_id": uuid.New()})
+	expectStatus(t, s.call(alice, http.MethodPost, registrationPath(unpaid.RegistrationID, "/cancel"), map[string]any{"reason": "x"}), http.StatusNoContent)
+	expectProblem(t, s.call(alice, http.MethodGet, registrationPath(unpaid.RegistrationID, "/refund"), nil), http.StatusNotFound)
+	expectProblem(t, s.call(finance, http.MethodPatch, registrationPath(unpaid.RegistrationID, "/refund/process"), map[string]any{"refund_proof_url": "https://example.com/x.pdf"}), http.StatusNotFound)
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, registrationPath(reg.RegistrationID, "/refund"), nil), http.StatusForbidden)
+}
+
+func TestListRefunds(t *testing.T) {
+	s := newTestServer(t)
+	event := uuid.New()
+	first := s.cancelPaid(newCaller(auth.RoleParticipant), event)
+	second := s.cancelPaid(newCaller(auth.RoleParticipant), event)
+	s.cancelPaid(newCaller(auth.RoleParticipant), uuid.New()) // another event
+	res := s.call(finance, http.MethodPatch, registrationPath(first.RegistrationID, "/refund/process"), map[string]any{"refund_proof_url": "https://example.com/x.pdf"})
+	expectStatus(t, res, http.StatusOK)
+	path := "/api/v1/events/" + event.String() + "/refunds"
+
+	all := decode[[]repository.Refund](t, s.call(finance, http.MethodGet, path, nil), http.StatusOK)
+	if len(all) != 2 || all[0].RegistrationID != first.RegistrationID || all[1].RegistrationID != second.RegistrationID {
+		t.Errorf("refunds = %+v", all)
+	}
+	pending := decode[[]repository.Refund](t, s.call(admin, http.MethodGet, path+"?status=pending", nil), http.StatusOK)
+	if len(pending) != 1 || pending[0].RegistrationID != second.RegistrationID {
+		t.Errorf("pending refunds = %+v", pending)
+	}
+	expectProblem(t, s.call(admin, http.MethodGet, path+"?status=lost", nil), http.StatusBadRequest)
+	expectProblem(t, s.call(admin, http.MethodGet, path+"?limit=0", nil), http.StatusBadRequest)
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, path, nil), http.StatusForbidden)
+}
@@ -2,39 +2,58 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
 	"github.com/miftahulhidayati/registration-payment-service/internal/config"
-	"github.com/miftahulhidayati/registration-payment-service/internal/kafka"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/middleware"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
 	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/storage"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
 )
 
 type RegistrationsHandler struct {
-    repo     *repository.Postgres
-    producer *kafka.Producer
-    cfg      *config.Config
+    repo        repository.RegistrationStore
+    payments    repository.PaymentStore
+    refunds     repository.RefundStore
+    idempotency repository.IdempotencyStore
+    storage     storage.Storage
+    cfg         *config.Config
 }
 
-func NewRegistrationsHandler(repo *repository.Postgres, producer *kafka.Producer, cfg *config.Config) *RegistrationsHandler {
-    return &RegistrationsHandler{repo: repo, producer: producer, cfg: cfg}
+func NewRegistrationsHandler(repo repository.RegistrationStore, payments repository.PaymentStore, refunds repository.RefundStore, idempotency repository.IdempotencyStore, store storage.Storage, cfg *config.Config) *RegistrationsHandler {
+    return &RegistrationsHandler{repo: repo, payments: payments, refunds: refunds, idempotency: idempotency, storage: store, cfg: cfg}
 }
 
 func (h *RegistrationsHandler) Register(router fiber.Router) {
     g := router.Group("/registrations")
-    g.Post("/", h.createRegistration)
+    idempotent := middleware.Idempotency(h.idempotency, time.Duration(h.cfg.IdempotencyTTLHours)*time.Hour)
+    g.Post("/", idempotent, h.createRegistration)
     g.Get("/", h.listRegistrations)
+    g.Get("/search", requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin), h.searchRegistrations)
     g.Get(":id", h.getRegistration)
     g.Put(":id", h.updateRegistration)
     g.Post(":id/cancel", h.cancelRegistration)
+    g.Get(":id/history", requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin), h.getHistory)
 
-    // Payment endpoints (stubs/minimal)
-    g.Post(":id/payment", h.uploadPaymentProof)
+    // Payment endpoints
+    g.Post(":id/payment", idempotent, h.uploadPaymentProof)
     g.Get(":id/payment", h.getPaymentInfo)
-    g.Patch(":id/payment/verify", h.verifyPayment)
+    g.Get(":id/payment/history", h.listPayments)
+    g.Patch(":id/payment/verify", requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin), h.verifyPayment)
+
+    // Refund endpoints
+    g.Get(":id/refund", h.getRefund)
+    g.Patch(":id/refund/process", requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin), h.processRefund)
 }
 
 type createRegistrationRequest struct {
@@ -42,6 +61,7 @@ type createRegistrationRequest struct {
     UserID                *uuid.UUID `json:"user_id"`
     FullName              string     `json:"full_name"`
     Gender                string     `json:"gender"`
+    Category              string     `json:"category"`
     Phone                 string     `json:"phone"`
     Email                 string     `json:"email"`
     Address               *string    `json:"address"`
@@ -49,34 +69,43 @@ type createRegistrationRequest struct {
     EmergencyContactPhone *string    `json:"emergency_contact_phone"`
     EmergencyContactRelation *string `json:"emergency_contact_relation"`
     SpecialNeeds          *string    `json:"special_needs"`
+    VoucherCode           string     `json:"voucher_code"`
 }
 
 // CreateRegistration godoc
 // @Summary Create a new registration
-// @Description Register a user for an event
+// @Description Register a user for an event. When the event or the gender quota is full the registration is created with status waitlisted and a waitlist_position. If the event has pricing, amount_due is set from the category (e.g. student), gender and any open early-bird window; category must then be one the pricing offers, if it defines any. A voucher_code (case-insensitive) takes its discount off amount_due; each code is used once per email and no more than its max_uses.
 // @Tags registrations
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Replay-safe retry key"
 // @Param request body createRegistrationRequest true "Registration Request"
 // @Success 201 {object} repository.Registration
-// @Failure 400 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 400 {object} problem.Details
+// @Failure 409 {object} problem.Details "Request with the same Idempotency-Key in progress, or voucher used up"
+// @Failure 422 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
 // @Router /registrations [post]
 func (h *RegistrationsHandler) createRegistration(c *fiber.Ctx) error {
     var req createRegistrationRequest
     if err := c.BodyParser(&req); err != nil {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+        return problem.Respond(c, http.StatusBadRequest, "invalid payload")
     }
-    if req.FullName == "" || req.Gender == "" || req.Phone == "" || req.Email == "" || req.EventID == uuid.Nil {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "missing required fields"})
+    // Only admins register on behalf of someone else
+    if p := auth.FromCtx(c); p != nil && !p.HasRole(auth.RoleAdmin) {
+        userID, err := p.UserID()
+        if err != nil {
+            return problem.Respond(c, http.StatusForbidden, err.Error())
+        }
+        req.UserID = &userID
     }
-
-    ctx := context.Background()
-    reg, err := h.repo.CreateRegistration(ctx, repository.CreateRegistrationParams{
+    params := repository.CreateRegistrationParams{
         EventID:                 req.EventID,
         UserID:                  req.UserID,
         FullName:                req.FullName,
         Gender:                  req.Gender,
+        Category:                req.Category,
         Phone:                   req.Phone,
         Email:                   req.Email,
         Address:                 req.Address,
@@ -84,46 +113,191 @@ func (h *RegistrationsHandler) createRegistration(c *fiber.Ctx) error {
         EmergencyContactPhone:   req.EmergencyContactPhone,
         EmergencyContactRelation: req.EmergencyContactRelation,
         SpecialNeeds:            req.SpecialNeeds,
-    })
-    if err != nil {
-        return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+        VoucherCode:             req.VoucherCode,
+    }
+    if err := params.Validate(); err != nil {
+        return repoError(c, err)
     }
 
-    // Publish event (best-effort)
-    _ = h.publish(h.cfg.KafkaTopicRegCreated, reg.RegistrationID.String(), fiber.Map{
-        "event": "registration.created",
-        "data": fiber.Map{
-            "registration_id": reg.RegistrationID,
-            "event_id":        reg.EventID,
-            "user_id":         reg.UserID,
-            "full_name":       reg.FullName,
-            "gender":          reg.Gender,
-            "status":          reg.Status,
-            "timestamp":       time.Now().UTC().Format(time.RFC3339),
-        },
+    ctx := requestContext(c)
+    reg, err := h.repo.CreateRegistration(ctx, params, func(reg *repository.Registration) []repository.OutboxMessage {
+        // Written to the outbox in the same transaction as the insert
+        return []repository.OutboxMessage{repository.RegistrationCreatedEvent(h.cfg.KafkaTopicRegCreated, reg)}
     })
+    if err != nil {
+        return repoError(c, err)
+    }
 
     return c.Status(http.StatusCreated).JSON(reg)
 }
 
 // ListRegistrations godoc
 // @Summary List registrations
-// @Description Get a list of registrations with pagination
+// @Description List registrations with filters, sorting and cursor pagination. Participants only see their own and those of the orders they pay for.
 // @Tags registrations
 // @Produce json
-// @Success 200 {array} repository.Registration
-// @Failure 500 {object} map[string]interface{}
+// @Param event_id query string false "Event ID"
+// @Param user_id query string false "User ID"
+// @Param status query string false "Comma-separated statuses, e.g. pending,paid"
+// @Param gender query string false "male or female"
+// @Param registered_from query string false "Registered at or after (RFC3339 or YYYY-MM-DD)"
+// @Param registered_to query string false "Registered before (RFC3339), or on or before (YYYY-MM-DD)"
+// @Param payment_status query string false "Latest payment verification status: pending, approved, rejected or none"
+// @Param sort query string false "created_at, updated_at, registration_date or full_name; prefix with - for descending" default(-created_at)
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Success 200 {object} repository.RegistrationPage
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
 // @Router /registrations [get]
 func (h *RegistrationsHandler) listRegistrations(c *fiber.Ctx) error {
-    // Simple pagination defaults
-    limit := 20
-    offset := 0
+    filter, err := parseRegistrationFilter(c)
+    if err != nil {
+        return problem.Respond(c, http.StatusBadRequest, err.Error())
+    }
+    limit := c.QueryInt("limit", defaultPageSize)
+    if limit < 1 || limit > maxPageSize {
+        return problem.Respond(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+    }
+    // Participants are always scoped to their own registrations, and those
+    // they paid for through an order
+    if p := auth.FromCtx(c); p != nil && !p.IsStaff() {
+        userID, uerr := p.UserID()
+        if uerr != nil {
+            return problem.Respond(c, http.StatusForbidden, uerr.Error())
+        }
+        filter.OwnerID = &userID
+    }
+
+    ctx := context.Background()
+    page, err := h.repo.ListRegistrations(ctx, filter, repository.RegistrationPageRequest{
+        Sort:   c.Query("sort"),
+        Cursor: c.Query("cursor"),
+        Limit:  limit,
+    })
+    if err != nil {
+        return repoError(c, err)
+    }
+    return c.JSON(page)
+}
+
+const (
+    defaultPageSize = 20
+    maxPageSize     = 100
+)
+
+func parseRegistrationFilter(c *fiber.Ctx) (repository.RegistrationFilter, error) {
+    var f repository.RegistrationFilter
+    var err error
+    if f.EventID, err = optionalUUIDQuery(c, "event_id"); err != nil {
+        return f, err
+    }
+    if f.UserID, err = optionalUUIDQuery(c, "user_id"); err != nil {
+        return f, err
+    }
+    if v := c.Query("status"); v != "" {
+        for _, s := range strings.Split(v, ",") {
+            st, err := statemachine.Parse(strings.TrimSpace(s))
+            if err != nil {
+                return f, err
+            }
+            f.Statuses = append(f.Statuses, string(st))
+        }
+    }
+    switch g := c.Query("gender"); g {
+    case "", "male", "female":
+        f.Gender = g
+    default:
+        return f, errors.New("gender must be male or female")
+    }
+    if f.RegisteredFrom, err = optionalTimeQuery(c, "registered_from", false); err != nil {
+        return f, err
+    }
+    if f.RegisteredTo, err = optionalTimeQuery(c, "registered_to", true); err != nil {
+        return f, err
+    }
+    switch ps := c.Query("payment_status"); ps {
+    case "", "pending", "approved", "rejected", repository.PaymentStatusNone:
+        f.PaymentStatus = ps
+    default:
+        return f, errors.New("payment_status must be pending, approved, rejected or none")
+    }
+    return f, nil
+}
+
+func optionalUUIDQuery(c *fiber.Ctx, name string) (*uuid.UUID, error) {
+    v := c.Query(name)
+    if v == "" {
+        return nil, nil
+    }
+    id, err := uuid.Parse(v)
+    if err != nil {
+        return nil, fmt.Errorf("invalid %s", name)
+    }
+    return &id, nil
+}
+
+// optionalTimeQuery accepts RFC3339 or a plain date. A plain date used as an
+// exclusive upper bound is moved to the next day so the whole day matches.
+func optionalTimeQuery(c *fiber.Ctx, name string, upper bool) (*time.Time, error) {
+    v := c.Query(name)
+    if v == "" {
+        return nil, nil
+    }
+    if t, err := time.Parse(time.RFC3339, v); err == nil {
+        t = t.UTC()
+        return &t, nil
+    }
+    t, err := time.Parse("2006-01-02", v)
+    if err != nil {
+        return nil, fmt.Errorf("invalid %s, expected RFC3339 or YYYY-MM-DD", name)
+    }
+    if upper {
+        t = t.AddDate(0, 0, 1)
+    }
+    return &t, nil
+}
+
+// SearchRegistrations godoc
+// @Summary Search registrations
+// @Description Search participants by partial name, email or phone number (08xx and +628xx are equivalent), best match first. Staff only.
+// @Tags registrations
+// @Produce json
+// @Param q query string true "Search text, at least 2 characters"
+// @Param event_id query string false "Only search this event"
+// @Param limit query int false "Max results (max 100)" default(20)
+// @Success 200 {array} repository.RegistrationSearchResult
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/search [get]
+func (h *RegistrationsHandler) searchRegistrations(c *fiber.Ctx) error {
+    q := strings.TrimSpace(c.Query("q"))
+    if len([]rune(q)) < 2 {
+        return problem.Respond(c, http.StatusBadRequest, "q must be at least 2 characters")
+    }
+    eventID, err := optionalUUIDQuery(c, "event_id")
+    if err != nil {
+        return problem.Respond(c, http.StatusBadRequest, err.Error())
+    }
+    limit := c.QueryInt("limit", defaultPageSize)
+    if limit < 1 || limit > maxPageSize {
+        return problem.Respond(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+    }
+
     ctx := context.Background()
-    items, err := h.repo.ListRegistrations(ctx, limit, offset)
+    results, err := h.repo.SearchRegistrations(ctx, repository.RegistrationSearchParams{
+        Query:   q,
+        EventID: eventID,
+        Limit:   limit,
+    })
     if err != nil {
-        return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+        return repoError(c, err)
     }
-    return c.JSON(items)
+    return c.JSON(results)
 }
 
 // GetRegistration godoc
@@ -133,23 +307,21 @@ func (h *RegistrationsHandler) listRegistrations(c *fiber.Ctx) error {
 // @Produce json
 // @Param id path string true "Registration ID"
 // @Success 200 {object} repository.Registration
-// @Failure 400 {object} map[string]interface{}
-// @Failure 404 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
 // @Router /registrations/{id} [get]
 func (h *RegistrationsHandler) getRegistration(c *fiber.Ctx) error {
     idStr := c.Params("id")
     id, err := uuid.Parse(idStr)
     if err != nil {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+        return problem.Respond(c, http.StatusBadRequest, "invalid id")
     }
-    ctx := context.Background()
-    reg, err := h.repo.GetRegistrationByID(ctx, id)
+    reg, err := h.loadRegistration(c, id, false)
     if err != nil {
-        return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-    }
-    if reg == nil {
-        return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+        return repoError(c, err)
     }
     return c.JSON(reg)
 }
@@ -175,20 +347,22 @@ type updateRegistrationRequest struct {
 // @Param id path string true "Registration ID"
 // @Param request body updateRegistrationRequest true "Update Request"
 // @Success 200 {object} repository.Registration
-// @Failure 400 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
 // @Router /registrations/{id} [put]
 func (h *RegistrationsHandler) updateRegistration(c *fiber.Ctx) error {
     id, err := uuid.Parse(c.Params("id"))
     if err != nil {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+        return problem.Respond(c, http.StatusBadRequest, "invalid id")
     }
     var req updateRegistrationRequest
     if err := c.BodyParser(&req); err != nil {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+        return problem.Respond(c, http.StatusBadRequest, "invalid payload")
     }
-    ctx := context.Background()
-    reg, err := h.repo.UpdateRegistration(ctx, repository.UpdateRegistrationParams{
+    params := repository.UpdateRegistrationParams{
         RegistrationID:          id,
         FullName:                req.FullName,
         Phone:                   req.Phone,
@@ -199,9 +373,17 @@ func (h *RegistrationsHandler) updateRegistration(c *fiber.Ctx) error {
         EmergencyContactRelation: req.EmergencyContactRelation,
         SpecialNeeds:            req.SpecialNeeds,
         Notes:                   req.Notes,
-    })
+    }
+    if err := params.Validate(); err != nil {
+        return repoError(c, err)
+    }
+    if _, err := h.loadRegistration(c, id, true); err != nil {
+        return repoError(c, err)
+    }
+    ctx := requestContext(c)
+    reg, err := h.repo.UpdateRegistration(ctx, params)
     if err != nil {
-        return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+        return repoError(c, err)
     }
     return c.JSON(reg)
 }
@@ -212,122 +394,80 @@ type cancelRequest struct {
 
 // CancelRegistration godoc
 // @Summary Cancel a registration
-// @Description Cancel a registration with a reason
+// @Description Cancel a registration with a reason. If its payment was approved a pending refund is opened, sized by the event's refund policy.
 // @Tags registrations
 // @Accept json
 // @Produce json
 // @Param id path string true "Registration ID"
 // @Param request body cancelRequest true "Cancel Request"
 // @Success 204 "No Content"
-// @Failure 400 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 409 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
 // @Router /registrations/{id}/cancel [post]
 func (h *RegistrationsHandler) cancelRegistration(c *fiber.Ctx) error {
     id, err := uuid.Parse(c.Params("id"))
     if err != nil {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+        return problem.Respond(c, http.StatusBadRequest, "invalid id")
     }
     var req cancelRequest
-    if err := c.BodyParser(&req); err != nil || req.Reason == "" {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "reason required"})
+    if err := c.BodyParser(&req); err != nil {
+        return problem.Respond(c, http.StatusBadRequest, "invalid payload")
     }
-    ctx := context.Background()
-    if err := h.repo.CancelRegistration(ctx, id, req.Reason); err != nil {
-        return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-    }
-    _ = h.publish(h.cfg.KafkaTopicRegCancelled, id.String(), fiber.Map{
-        "event": "registration.cancelled",
-        "data": fiber.Map{
-            "registration_id": id,
-            "reason":          req.Reason,
-            "timestamp":       time.Now().UTC().Format(time.RFC3339),
-        },
+    var v validation.Validator
+    v.Required("reason", req.Reason)
+    if err := v.Err(); err != nil {
+        return repoError(c, err)
+    }
+    if _, err := h.loadRegistration(c, id, true); err != nil {
+        return repoError(c, err)
+    }
+    ctx := requestContext(c)
+    cancelled := outboxEvent(h.cfg.KafkaTopicRegCancelled, id.String(), "registration.cancelled", fiber.Map{
+        "registration_id": id,
+        "reason":          req.Reason,
+        "timestamp":       time.Now().UTC().Format(time.RFC3339),
     })
+    if err := h.repo.CancelRegistration(ctx, id, req.Reason, cancelled); err != nil {
+        return repoError(c, err)
+    }
     return c.SendStatus(http.StatusNoContent)
 }
 
-// Payment stubs (replace with your implementation later)
-// UploadPaymentProof godoc
-// @Summary Upload payment proof
-// @Description Upload proof of payment for a registration
-// @Tags payments
-// @Accept json
-// @Produce json
-// @Param id path string true "Registration ID"
-// @Param request body object{amount=float64,payment_proof_url=string} true "Payment Proof"
-// @Success 202 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Router /registrations/{id}/payment [post]
-func (h *RegistrationsHandler) uploadPaymentProof(c *fiber.Ctx) error {
-    // Accept minimal JSON for now
-    type reqT struct {
-        Amount float64 `json:"amount"`
-        Proof  string  `json:"payment_proof_url"`
-    }
-    var req reqT
-    if err := c.BodyParser(&req); err != nil {
-        return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
-    }
-    id := c.Params("id")
-    _ = h.publish(h.cfg.KafkaTopicPayUploaded, id, fiber.Map{
-        "event": "payment.uploaded",
-        "data": fiber.Map{
-            "registration_id": id,
-            "amount":          req.Amount,
-            "payment_proof_url": req.Proof,
-            "timestamp":       time.Now().UTC().Format(time.RFC3339),
-        },
-    })
-    return c.Status(http.StatusAccepted).JSON(fiber.Map{"status": "payment uploaded"})
-}
-
-// GetPaymentInfo godoc
-// @Summary Get payment info
-// @Description Get payment status and details
-// @Tags payments
-// @Produce json
-// @Param id path string true "Registration ID"
-// @Success 200 {object} map[string]interface{}
-// @Router /registrations/{id}/payment [get]
-func (h *RegistrationsHandler) getPaymentInfo(c *fiber.Ctx) error {
-    // Placeholder response
-    return c.JSON(fiber.Map{"registration_id": c.Params("id"), "payment": fiber.Map{"status": "pending"}})
-}
-
-// VerifyPayment godoc
-// @Summary Verify payment
-// @Description Verify and approve a payment
-// @Tags payments
+// GetHistory godoc
+// @Summary Get the change history of a registration
+// @Description Audit timeline of a registration and its payments, oldest first: who changed what (only changed fields, before and after), with request ID and IP. Staff only.
+// @Tags registrations
 // @Produce json
 // @Param id path string true "Registration ID"
-// @Success 200 {object} map[string]interface{}
-// @Router /registrations/{id}/payment/verify [patch]
-func (h *RegistrationsHandler) verifyPayment(c *fiber.Ctx) error {
-    id := c.Params("id")
-    // In real impl: update payments + set registration to confirmed
-    _ = h.publish(h.cfg.KafkaTopicPayVerified, id, fiber.Map{
-        "event": "payment.verified",
-        "data": fiber.Map{
-            "registration_id": id,
-            "verification_status": "approved",
-            "timestamp":       time.Now().UTC().Format(time.RFC3339),
-        },
-    })
-    _ = h.publish(h.cfg.KafkaTopicRegConfirmed, id, fiber.Map{
-        "event": "registration.confirmed",
-        "data": fiber.Map{
-            "registration_id": id,
-            "timestamp":       time.Now().UTC().Format(time.RFC3339),
-        },
-    })
-    return c.JSON(fiber.Map{"status": "verified"})
+// @Success 200 {array} repository.AuditEvent
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /registrations/{id}/history [get]
+func (h *RegistrationsHandler) getHistory(c *fiber.Ctx) error {
+    id, err := uuid.Parse(c.Params("id"))
+    if err != nil {
+        return problem.Respond(c, http.StatusBadRequest, "invalid id")
+    }
+    if _, err := h.loadRegistration(c, id, false); err != nil {
+        return repoError(c, err)
+    }
+    ctx := context.Background()
+    events, err := h.repo.ListAuditEvents(ctx, id)
+    if err != nil {
+        return repoError(c, err)
+    }
+    return c.JSON(events)
 }
 
-func (h *RegistrationsHandler) publish(topic, key string, payload any) error {
-    if h.producer == nil {
-        return nil
-    }
-    return h.producer.Publish(context.Background(), topic, key, payload)
+func outboxEvent(topic, key, name string, data fiber.Map) repository.OutboxMessage {
+    return repository.Event(topic, key, name, data)
 }
 
 
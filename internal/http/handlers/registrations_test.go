@@ -0,0 +1,319 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/middleware"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+func TestCreateRegistration(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+
+	// Participants always register themselves, whatever user_id they send
+	reg := s.register(alice, map[string]any{"user_id": uuid.New()})
+	if reg.Status != "pending" || reg.PaymentDueAt == nil {
+		t.Errorf("status = %s, payment_due_at = %v; want pending with a deadline", reg.Status, reg.PaymentDueAt)
+	}
+	if reg.UserID == nil || *reg.UserID != alice.userID() {
+		t.Errorf("user_id = %v, want %s", reg.UserID, alice.userID())
+	}
+	if got := s.published(); !slices.Equal(got, []string{"registration.created"}) {
+		t.Errorf("published %v, want [registration.created]", got)
+	}
+
+	// Admins may register someone else
+	bob := uuid.New()
+	reg = s.register(admin, map[string]any{"user_id": bob, "full_name": "Budi", "gender": "male"})
+	if reg.UserID == nil || *reg.UserID != bob {
+		t.Errorf("user_id = %v, want %s", reg.UserID, bob)
+	}
+}
+
+func TestCreateRegistrationErrors(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	path := "/api/v1/registrations"
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		expectProblem(t, s.call(anonymous, http.MethodPost, path, registrationBody(nil)), http.StatusUnauthorized)
+	})
+	t.Run("malformed body", func(t *testing.T) {
+		expectProblem(t, s.call(alice, http.MethodPost, path, "{"), http.StatusBadRequest)
+	})
+	t.Run("invalid fields", func(t *testing.T) {
+		res := s.call(alice, http.MethodPost, path, registrationBody(map[string]any{
+			"gender": "other",
+			"phone":  "12345",
+			"email":  "not-an-email",
+		}))
+		expectFieldErrors(t, res, "gender", "phone", "email")
+	})
+	t.Run("phone too long", func(t *testing.T) {
+		// Valid once separators are stripped, but longer than the column
+		long := "+62 (812) 345-678-901"
+		res := s.call(alice, http.MethodPost, path, registrationBody(map[string]any{"phone": long, "emergency_contact_phone": long}))
+		expectFieldErrors(t, res, "phone", "emergency_contact_phone")
+	})
+	t.Run("missing fields", func(t *testing.T) {
+		res := s.call(alice, http.MethodPost, path, map[string]any{})
+		expectFieldErrors(t, res, "event_id", "full_name", "gender", "phone", "email")
+	})
+	t.Run("already registered", func(t *testing.T) {
+		s.register(alice, nil)
+		p := expectProblem(t, s.call(alice, http.MethodPost, path, registrationBody(nil)), http.StatusConflict)
+		if len(p.Errors) != 1 || p.Errors[0]["field"] != "user_id" {
+			t.Errorf("errors = %v, want user_id", p.Errors)
+		}
+	})
+}
+
+func TestCreateRegistrationWaitlist(t *testing.T) {
+	s := newTestServer(t)
+	s.setCapacity(map[string]any{"total_quota": 1})
+
+	s.register(newCaller(auth.RoleParticipant), nil)
+	reg := s.register(newCaller(auth.RoleParticipant), nil)
+	if reg.Status != "waitlisted" || reg.WaitlistPosition == nil || *reg.WaitlistPosition != 1 {
+		t.Errorf("status = %s, waitlist_position = %v; want waitlisted at 1", reg.Status, reg.WaitlistPosition)
+	}
+	if reg.PaymentDueAt != nil {
+		t.Errorf("waitlisted registration has payment_due_at %v", reg.PaymentDueAt)
+	}
+}
+
+func TestCreateRegistrationIdempotency(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+
+	post := func(body map[string]any, key string) *response {
+		req := jsonRequest(t, http.MethodPost, "/api/v1/registrations", body)
+		req.Header.Set(middleware.HeaderIdempotencyKey, key)
+		return s.send(alice, req)
+	}
+
+	first := decode[repository.Registration](t, post(registrationBody(nil), "k1"), http.StatusCreated)
+	res := post(registrationBody(nil), "k1")
+	replayed := decode[repository.Registration](t, res, http.StatusCreated)
+	if replayed.RegistrationID != first.RegistrationID || res.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry was not replayed: got %s, header %q", replayed.RegistrationID, res.Header.Get("Idempotent-Replayed"))
+	}
+	expectProblem(t, post(registrationBody(map[string]any{"full_name": "Other"}), "k1"), http.StatusUnprocessableEntity)
+
+	// A reservation whose request died is taken over once its lease runs out
+	ctx := context.Background()
+	if _, reserved, err := s.store.ReserveIdempotencyKey(ctx, "k2", "hash", time.Hour, -time.Second); err != nil || !reserved {
+		t.Fatalf("reserve: reserved=%v, err=%v", reserved, err)
+	}
+	if _, reserved, err := s.store.ReserveIdempotencyKey(ctx, "k2", "hash", time.Hour, time.Minute); err != nil || !reserved {
+		t.Errorf("stale reservation was not taken over: reserved=%v, err=%v", reserved, err)
+	}
+	if rec, reserved, err := s.store.ReserveIdempotencyKey(ctx, "k2", "hash", time.Hour, time.Minute); err != nil || reserved || rec.CompletedAt != nil {
+		t.Errorf("live reservation was taken over: reserved=%v, err=%v", reserved, err)
+	}
+
+	// Keys past their TTL are purged, after which a retry is not replayed
+	if n, err := s.store.PurgeIdempotencyKeys(ctx, time.Hour, 10); err != nil || n != 0 {
+		t.Errorf("purged %d live keys, %v", n, err)
+	}
+	if n, err := s.store.PurgeIdempotencyKeys(ctx, 0, 10); err != nil || n != 2 {
+		t.Errorf("purged %d expired keys, want 2: %v", n, err)
+	}
+	expectProblem(t, post(registrationBody(nil), "k1"), http.StatusConflict)
+}
+
+func TestListRegistrations(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	s.register(alice, nil)
+	for _, name := range []string{"Budi", "Citra"} {
+		s.register(admin, map[string]any{"user_id": uuid.New(), "full_name": name})
+	}
+	path := "/api/v1/registrations"
+
+	page := decode[repository.RegistrationPage](t, s.call(alice, http.MethodGet, path, nil), http.StatusOK)
+	if page.Total != 1 || len(page.Items) != 1 || *page.Items[0].UserID != alice.userID() {
+		t.Errorf("participant sees %d registrations, want only their own", page.Total)
+	}
+
+	// Walk all pages sorted by name
+	var names []string
+	next := path + "?sort=full_name&limit=2"
+	for next != "" {
+		page := decode[repository.RegistrationPage](t, s.call(finance, http.MethodGet, next, nil), http.StatusOK)
+		if page.Total != 3 {
+			t.Fatalf("total = %d, want 3", page.Total)
+		}
+		for _, reg := range page.Items {
+			names = append(names, reg.FullName)
+		}
+		next = ""
+		if page.NextCursor != nil {
+			next = path + "?sort=full_name&limit=2&cursor=" + url.QueryEscape(*page.NextCursor)
+		}
+	}
+	if !slices.Equal(names, []string{"Budi", "Citra", "Siti Aminah"}) {
+		t.Errorf("names = %v", names)
+	}
+
+	page = decode[repository.RegistrationPage](t, s.call(admin, http.MethodGet, path+"?payment_status=none&status=pending,paid", nil), http.StatusOK)
+	if page.Total != 3 {
+		t.Errorf("filtered total = %d, want 3", page.Total)
+	}
+
+	for _, query := range []string{
+		"?sort=bogus",
+		"?cursor=not-a-cursor",
+		"?limit=0",
+		"?limit=101",
+		"?status=unknown",
+		"?gender=x",
+		"?event_id=nope",
+		"?registered_from=yesterday",
+		"?payment_status=lost",
+	} {
+		expectProblem(t, s.call(admin, http.MethodGet, path+query, nil), http.StatusBadRequest)
+	}
+}
+
+func TestSearchRegistrations(t *testing.T) {
+	s := newTestServer(t)
+	s.register(admin, map[string]any{"user_id": uuid.New(), "full_name": "Ahmad Fauzi", "gender": "male", "phone": "0812-1111-2222"})
+	s.register(admin, map[string]any{"user_id": uuid.New(), "full_name": "Dewi Lestari", "phone": "081233334444"})
+	path := "/api/v1/registrations/search?q="
+
+	results := decode[[]repository.RegistrationSearchResult](t, s.call(finance, http.MethodGet, path+"fauz", nil), http.StatusOK)
+	if len(results) != 1 || results[0].FullName != "Ahmad Fauzi" {
+		t.Errorf("search by name: %+v", results)
+	}
+	results = decode[[]repository.RegistrationSearchResult](t, s.call(finance, http.MethodGet, path+url.QueryEscape("+6281233334444"), nil), http.StatusOK)
+	if len(results) != 1 || results[0].FullName != "Dewi Lestari" {
+		t.Errorf("search by phone: %+v", results)
+	}
+
+	expectProblem(t, s.call(finance, http.MethodGet, path+"a", nil), http.StatusBadRequest)
+	expectProblem(t, s.call(finance, http.MethodGet, path+"ahmad&limit=500", nil), http.StatusBadRequest)
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, path+"ahmad", nil), http.StatusForbidden)
+}
+
+func TestGetRegistration(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	path := registrationPath(reg.RegistrationID, "")
+
+	for _, as := range []caller{alice, finance, admin} {
+		got := decode[repository.Registration](t, s.call(as, http.MethodGet, path, nil), http.StatusOK)
+		if got.RegistrationID != reg.RegistrationID {
+			t.Errorf("got registration %s, want %s", got.RegistrationID, reg.RegistrationID)
+		}
+	}
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, path, nil), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, registrationPath(uuid.New(), ""), nil), http.StatusNotFound)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/registrations/not-a-uuid", nil), http.StatusBadRequest)
+}
+
+func TestUpdateRegistration(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	path := registrationPath(reg.RegistrationID, "")
+
+	got := decode[repository.Registration](t, s.call(alice, http.MethodPut, path, map[string]any{"phone": "+6285712345678"}), http.StatusOK)
+	if got.Phone != "+6285712345678" || got.FullName != reg.FullName {
+		t.Errorf("phone = %q, full_name = %q", got.Phone, got.FullName)
+	}
+
+	expectFieldErrors(t, s.call(alice, http.MethodPut, path, map[string]any{"email": "x", "full_name": ""}), "full_name", "email")
+	expectFieldErrors(t, s.call(alice, http.MethodPut, path, map[string]any{"phone": "+62 (812) 345-678-901"}), "phone")
+	expectProblem(t, s.call(alice, http.MethodPut, path, "{"), http.StatusBadRequest)
+	// Finance verifiers may read but not change other people's registrations
+	expectProblem(t, s.call(finance, http.MethodPut, path, map[string]any{"notes": "x"}), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodPut, registrationPath(uuid.New(), ""), map[string]any{"notes": "x"}), http.StatusNotFound)
+}
+
+func TestCancelRegistration(t *testing.T) {
+	s := newTestServer(t)
+	s.setCapacity(map[string]any{"total_quota": 1})
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	waiting := s.register(newCaller(auth.RoleParticipant), nil)
+	s.published()
+	path := registrationPath(reg.RegistrationID, "/cancel")
+
+	expectFieldErrors(t, s.call(alice, http.MethodPost, path, map[string]any{}), "reason")
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodPost, path, map[string]any{"reason": "x"}), http.StatusForbidden)
+
+	expectStatus(t, s.call(alice, http.MethodPost, path, map[string]any{"reason": "cannot attend"}), http.StatusNoContent)
+	got := decode[repository.Registration](t, s.call(admin, http.MethodGet, registrationPath(reg.RegistrationID, ""), nil), http.StatusOK)
+	if got.Status != "cancelled" || got.CancellationReason == nil || *got.CancellationReason != "cannot attend" {
+		t.Errorf("status = %s, reason = %v", got.Status, got.CancellationReason)
+	}
+
+	// The freed seat goes to the waitlist
+	got = decode[repository.Registration](t, s.call(admin, http.MethodGet, registrationPath(waiting.RegistrationID, ""), nil), http.StatusOK)
+	if got.Status != "pending" || got.WaitlistPosition != nil {
+		t.Errorf("waitlisted registration: status = %s, position = %v; want promoted", got.Status, got.WaitlistPosition)
+	}
+	if topics := s.published(); !slices.Equal(topics, []string{"registration.cancelled", "registration.promoted"}) {
+		t.Errorf("published %v", topics)
+	}
+
+	p := expectProblem(t, s.call(alice, http.MethodPost, path, map[string]any{"reason": "again"}), http.StatusConflict)
+	if p.CurrentStatus != "cancelled" {
+		t.Errorf("current_status = %q, want cancelled", p.CurrentStatus)
+	}
+	expectProblem(t, s.call(admin, http.MethodPost, registrationPath(uuid.New(), "/cancel"), map[string]any{"reason": "x"}), http.StatusNotFound)
+}
+
+func TestRegistrationHistory(t *testing.T) {
+	s := newTestServer(t)
+	alice := newCaller(auth.RoleParticipant)
+	reg := s.register(alice, nil)
+	// Clients choose their own X-Request-ID; an oversized one is cut to fit
+	update := jsonRequest(t, http.MethodPut, registrationPath(reg.RegistrationID, ""), map[string]any{"notes": "vegetarian"})
+	update.Header.Set(fiber.HeaderXRequestID, strings.Repeat("r", 300))
+	expectStatus(t, s.send(alice, update), http.StatusOK)
+	path := registrationPath(reg.RegistrationID, "/history")
+
+	events := decode[[]repository.AuditEvent](t, s.call(finance, http.MethodGet, path, nil), http.StatusOK)
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action)
+		if e.Actor != alice.Subject {
+			t.Errorf("%s recorded actor %q, want %q", e.Action, e.Actor, alice.Subject)
+		}
+	}
+	if !slices.Equal(actions, []string{"registration.created", "registration.updated"}) {
+		t.Errorf("actions = %v", actions)
+	}
+	if string(events[1].After) != `{"notes":"vegetarian"}` {
+		t.Errorf("update diff = %s", events[1].After)
+	}
+	if id := events[1].RequestID; id == nil || *id != strings.Repeat("r", 255) {
+		t.Errorf("request_id = %v, want the first 255 characters", id)
+	}
+
+	expectProblem(t, s.call(alice, http.MethodGet, path, nil), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, registrationPath(uuid.New(), "/history"), nil), http.StatusNotFound)
+}
+
+func TestAuthDisabled(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.AuthEnabled = false })
+
+	reg := s.register(anonymous, map[string]any{"user_id": uuid.New()})
+	expectStatus(t, s.call(anonymous, http.MethodGet, registrationPath(reg.RegistrationID, "/history"), nil), http.StatusOK)
+	expectStatus(t, s.call(anonymous, http.MethodPut, "/api/v1/events/"+eventID.String()+"/capacity", map[string]any{}), http.StatusOK)
+}
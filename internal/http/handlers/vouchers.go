@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+type VouchersHandler struct {
+	repo repository.VoucherStore
+	cfg  *config.Config
+}
+
+func NewVouchersHandler(repo repository.VoucherStore, cfg *config.Config) *VouchersHandler {
+	return &VouchersHandler{repo: repo, cfg: cfg}
+}
+
+func (h *VouchersHandler) Register(router fiber.Router) {
+	g := router.Group("/vouchers")
+	staff := requireRole(h.cfg, auth.RoleFinanceVerifier, auth.RoleAdmin)
+	g.Post("/", requireRole(h.cfg, auth.RoleAdmin), h.createVoucher)
+	g.Get("/", staff, h.listVouchers)
+	g.Get(":id", staff, h.getVoucher)
+	g.Patch(":id", requireRole(h.cfg, auth.RoleAdmin), h.updateVoucher)
+}
+
+type createVoucherRequest struct {
+	Code          string     `json:"code"`
+	EventID       *uuid.UUID `json:"event_id"`
+	DiscountType  string     `json:"discount_type"`
+	DiscountValue float64    `json:"discount_value"`
+	MaxUses       *int       `json:"max_uses"`
+	ValidFrom     *time.Time `json:"valid_from"`
+	ValidUntil    *time.Time `json:"valid_until"`
+	Description   *string    `json:"description"`
+}
+
+// CreateVoucher godoc
+// @Summary Create voucher
+// @Description Create a promo code (admin). discount_type percent takes discount_value percent off amount_due, fixed takes discount_value off (never below zero). Without event_id the code is valid for every event; max_uses, valid_from and valid_until are optional limits. Codes are stored upper-case and matched case-insensitively.
+// @Tags vouchers
+// @Accept json
+// @Produce json
+// @Param request body createVoucherRequest true "Voucher"
+// @Success 201 {object} repository.Voucher
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 409 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /vouchers [post]
+func (h *VouchersHandler) createVoucher(c *fiber.Ctx) error {
+	var req createVoucherRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	params := repository.CreateVoucherParams{
+		Code:          repository.NormalizeVoucherCode(req.Code),
+		EventID:       req.EventID,
+		DiscountType:  req.DiscountType,
+		DiscountValue: req.DiscountValue,
+		MaxUses:       req.MaxUses,
+		ValidFrom:     req.ValidFrom,
+		ValidUntil:    req.ValidUntil,
+		Description:   req.Description,
+	}
+	if err := params.Validate(); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	voucher, err := h.repo.CreateVoucher(ctx, params)
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(voucher)
+}
+
+// ListVouchers godoc
+// @Summary List vouchers
+// @Description List promo codes with their usage, newest first. With event_id, codes valid for every event are included. Staff only.
+// @Tags vouchers
+// @Produce json
+// @Param event_id query string false "Event ID"
+// @Param limit query int false "Max results (max 100)" default(20)
+// @Success 200 {array} repository.Voucher
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /vouchers [get]
+func (h *VouchersHandler) listVouchers(c *fiber.Ctx) error {
+	eventID, err := optionalUUIDQuery(c, "event_id")
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	limit := c.QueryInt("limit", defaultPageSize)
+	if limit < 1 || limit > maxPageSize {
+		return problem.Respond(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+	}
+
+	ctx := context.Background()
+	vouchers, err := h.repo.ListVouchers(ctx, repository.VoucherFilter{EventID: eventID, Limit: limit})
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(vouchers)
+}
+
+// GetVoucher godoc
+// @Summary Get voucher
+// @Description Get a promo code and how often it has been used. Staff only.
+// @Tags vouchers
+// @Produce json
+// @Param id path string true "Voucher ID"
+// @Success 200 {object} repository.Voucher
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /vouchers/{id} [get]
+func (h *VouchersHandler) getVoucher(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	ctx := context.Background()
+	voucher, err := h.repo.GetVoucher(ctx, id)
+	if err != nil {
+		return repoError(c, err)
+	}
+	if voucher == nil {
+		return problem.Respond(c, http.StatusNotFound, "not found")
+	}
+	return c.JSON(voucher)
+}
+
+type updateVoucherRequest struct {
+	Active      *bool      `json:"active"`
+	MaxUses     *int       `json:"max_uses"`
+	ValidFrom   *time.Time `json:"valid_from"`
+	ValidUntil  *time.Time `json:"valid_until"`
+	Description *string    `json:"description"`
+}
+
+// UpdateVoucher godoc
+// @Summary Update voucher
+// @Description Deactivate a promo code or change its limits (admin). Omitted fields are left unchanged; the code and discount cannot be changed. max_uses cannot go below used_count.
+// @Tags vouchers
+// @Accept json
+// @Produce json
+// @Param id path string true "Voucher ID"
+// @Param request body updateVoucherRequest true "Changes"
+// @Success 200 {object} repository.Voucher
+// @Failure 400 {object} problem.Details
+// @Failure 403 {object} problem.Details
+// @Failure 404 {object} problem.Details
+// @Failure 500 {object} problem.Details
+// @Security BearerAuth
+// @Router /vouchers/{id} [patch]
+func (h *VouchersHandler) updateVoucher(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid id")
+	}
+	var req updateVoucherRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+	}
+	params := repository.UpdateVoucherParams{
+		VoucherID:   id,
+		Active:      req.Active,
+		MaxUses:     req.MaxUses,
+		ValidFrom:   req.ValidFrom,
+		ValidUntil:  req.ValidUntil,
+		Description: req.Description,
+	}
+	if err := params.Validate(); err != nil {
+		return repoError(c, err)
+	}
+
+	ctx := requestContext(c)
+	voucher, err := h.repo.UpdateVoucher(ctx, params)
+	if err != nil {
+		return repoError(c, err)
+	}
+	return c.JSON(voucher)
+}
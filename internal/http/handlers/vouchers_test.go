@@ -0,0 +1,188 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+func (s *testServer) createVoucher(body map[string]any) repository.Voucher {
+	s.t.Helper()
+	return decode[repository.Voucher](s.t, s.call(admin, http.MethodPost, "/api/v1/vouchers", body), http.StatusCreated)
+}
+
+// redeem registers a new participant with email and voucher code.
+func (s *testServer) redeem(email, code string) *response {
+	s.t.Helper()
+	body := registrationBody(map[string]any{"email": email, "voucher_code": code})
+	return s.call(newCaller(auth.RoleParticipant), http.MethodPost, "/api/v1/registrations", body)
+}
+
+func TestVoucherRedemption(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 150000})
+	percent := s.createVoucher(map[string]any{"code": " sponsor10 ", "event_id": eventID, "discount_type": "percent", "discount_value": 10})
+	if percent.Code != "SPONSOR10" || !percent.Active || percent.UsedCount != 0 {
+		t.Errorf("voucher = %+v", percent)
+	}
+	s.createVoucher(map[string]any{"code": "GRATIS", "discount_type": "fixed", "discount_value": 200000})
+
+	reg := decode[repository.Registration](t, s.redeem("a@example.com", "Sponsor10"), http.StatusCreated)
+	if reg.VoucherCode == nil || *reg.VoucherCode != "SPONSOR10" || *reg.DiscountAmount != 15000 || *reg.AmountDue != 135000 {
+		t.Errorf("registration = %+v", reg)
+	}
+	// A fixed discount never makes the amount negative
+	reg = decode[repository.Registration](t, s.redeem("a@example.com", "GRATIS"), http.StatusCreated)
+	if *reg.DiscountAmount != 150000 || *reg.AmountDue != 0 {
+		t.Errorf("registration = %+v", reg)
+	}
+
+	// Once per email, whatever its case
+	p := expectProblem(t, s.redeem("A@Example.com", "SPONSOR10"), http.StatusConflict)
+	if p.Code != "voucher_unavailable" {
+		t.Errorf("code = %q", p.Code)
+	}
+	voucher := decode[repository.Voucher](t, s.call(finance, http.MethodGet, "/api/v1/vouchers/"+percent.VoucherID.String(), nil), http.StatusOK)
+	if voucher.UsedCount != 1 {
+		t.Errorf("used_count = %d, want 1", voucher.UsedCount)
+	}
+
+	expectFieldErrors(t, s.redeem("b@example.com", "NOPE"), "voucher_code")
+	// Scoped to another event
+	other := registrationBody(map[string]any{"event_id": uuid.New(), "email": "b@example.com", "voucher_code": "SPONSOR10"})
+	expectFieldErrors(t, s.call(newCaller(auth.RoleParticipant), http.MethodPost, "/api/v1/registrations", other), "voucher_code")
+	// Valid for every event, but this one has no pricing
+	other["voucher_code"] = "GRATIS"
+	expectFieldErrors(t, s.call(newCaller(auth.RoleParticipant), http.MethodPost, "/api/v1/registrations", other), "voucher_code")
+}
+
+func TestVoucherLimits(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 100000})
+	limited := s.createVoucher(map[string]any{"code": "FIRST3", "discount_type": "fixed", "discount_value": 25000, "max_uses": 3})
+
+	// Concurrent registrations never use it more than max_uses times
+	var wg sync.WaitGroup
+	statuses := make([]int, 10)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = s.redeem(fmt.Sprintf("user%d@example.com", i), "FIRST3").Status
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("status = %d", status)
+		}
+	}
+	if created != 3 {
+		t.Errorf("%d registrations used the voucher, want 3", created)
+	}
+
+	path := "/api/v1/vouchers/" + limited.VoucherID.String()
+	expectFieldErrors(t, s.call(admin, http.MethodPatch, path, map[string]any{"max_uses": 2}), "max_uses")
+	voucher := decode[repository.Voucher](t, s.call(admin, http.MethodPatch, path, map[string]any{"max_uses": 4}), http.StatusOK)
+	if *voucher.MaxUses != 4 || voucher.UsedCount != 3 {
+		t.Errorf("voucher = %+v", voucher)
+	}
+	expectStatus(t, s.call(admin, http.MethodPatch, path, map[string]any{"active": false}), http.StatusOK)
+	expectFieldErrors(t, s.redeem("late@example.com", "FIRST3"), "voucher_code")
+
+	window := s.createVoucher(map[string]any{
+		"code": "LATER", "discount_type": "percent", "discount_value": 50,
+		"valid_from": time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+	expectFieldErrors(t, s.redeem("x@example.com", "LATER"), "voucher_code")
+	res := s.call(admin, http.MethodPatch, "/api/v1/vouchers/"+window.VoucherID.String(), map[string]any{"valid_until": time.Now().Format(time.RFC3339)})
+	expectFieldErrors(t, res, "valid_until")
+}
+
+func TestVoucherReleased(t *testing.T) {
+	s := newTestServer(t)
+	s.setPricing(map[string]any{"base_price": 100000})
+	s.setCapacity(map[string]any{"total_quota": 1})
+	voucher := s.createVoucher(map[string]any{"code": "ONCE", "discount_type": "fixed", "discount_value": 25000, "max_uses": 1})
+	expectUsed := func(want int) {
+		t.Helper()
+		v := decode[repository.Voucher](t, s.call(finance, http.MethodGet, "/api/v1/vouchers/"+voucher.VoucherID.String(), nil), http.StatusOK)
+		if v.UsedCount != want {
+			t.Errorf("used_count = %d, want %d", v.UsedCount, want)
+		}
+	}
+	redeem := func(as caller, email string) repository.Registration {
+		t.Helper()
+		body := registrationBody(map[string]any{"email": email, "voucher_code": "ONCE"})
+		return decode[repository.Registration](t, s.call(as, http.MethodPost, "/api/v1/registrations", body), http.StatusCreated)
+	}
+
+	// A rejected registration gives the code back
+	carol := newCaller(auth.RoleParticipant)
+	reg := redeem(carol, "carol@example.com")
+	expectProblem(t, s.redeem("bob@example.com", "ONCE"), http.StatusConflict)
+	s.pay(carol, reg.RegistrationID)
+	body := map[string]any{"status": "rejected", "rejection_reason": "forged receipt", "reject_registration": true}
+	expectStatus(t, s.call(finance, http.MethodPatch, registrationPath(reg.RegistrationID, "/payment/verify"), body), http.StatusOK)
+	if got := s.registration(reg.RegistrationID); got.Status != "rejected" || *got.VoucherCode != "ONCE" {
+		t.Errorf("registration = %+v", got)
+	}
+	expectUsed(0)
+
+	// So does a waitlisted one that is cancelled
+	s.register(newCaller(auth.RoleParticipant), nil)
+	alice := newCaller(auth.RoleParticipant)
+	reg = redeem(alice, "alice@example.com")
+	if reg.Status != "waitlisted" {
+		t.Fatalf("status = %s, want waitlisted", reg.Status)
+	}
+	expectUsed(1)
+	expectStatus(t, s.call(alice, http.MethodPost, registrationPath(reg.RegistrationID, "/cancel"), map[string]any{"reason": "plans changed"}), http.StatusNoContent)
+	expectUsed(0)
+
+	// The email of a released use may redeem the code again
+	redeem(newCaller(auth.RoleParticipant), "carol@example.com")
+	expectUsed(1)
+}
+
+func TestManageVouchers(t *testing.T) {
+	s := newTestServer(t)
+	s.createVoucher(map[string]any{"code": "ALL", "discount_type": "fixed", "discount_value": 10000})
+	s.createVoucher(map[string]any{"code": "THIS", "event_id": eventID, "discount_type": "fixed", "discount_value": 10000})
+	s.createVoucher(map[string]any{"code": "OTHER", "event_id": uuid.New(), "discount_type": "fixed", "discount_value": 10000})
+
+	vouchers := decode[[]repository.Voucher](t, s.call(finance, http.MethodGet, "/api/v1/vouchers?event_id="+eventID.String(), nil), http.StatusOK)
+	if len(vouchers) != 2 || vouchers[0].Code != "THIS" || vouchers[1].Code != "ALL" {
+		t.Errorf("vouchers = %+v", vouchers)
+	}
+	all := decode[[]repository.Voucher](t, s.call(admin, http.MethodGet, "/api/v1/vouchers?limit=2", nil), http.StatusOK)
+	if len(all) != 2 {
+		t.Errorf("vouchers = %+v", all)
+	}
+
+	res := s.call(admin, http.MethodPost, "/api/v1/vouchers", map[string]any{"code": "all", "discount_type": "fixed", "discount_value": 1})
+	expectProblem(t, res, http.StatusConflict)
+	res = s.call(admin, http.MethodPost, "/api/v1/vouchers", map[string]any{
+		"code": "no spaces", "discount_type": "percent", "discount_value": 150, "max_uses": 0,
+		"valid_from": "2026-02-01T00:00:00Z", "valid_until": "2026-01-01T00:00:00Z",
+	})
+	expectFieldErrors(t, res, "code", "discount_value", "max_uses", "valid_until")
+	expectFieldErrors(t, s.call(admin, http.MethodPost, "/api/v1/vouchers", map[string]any{}), "code", "discount_type", "discount_value")
+	expectProblem(t, s.call(finance, http.MethodPost, "/api/v1/vouchers", map[string]any{}), http.StatusForbidden)
+	expectProblem(t, s.call(newCaller(auth.RoleParticipant), http.MethodGet, "/api/v1/vouchers", nil), http.StatusForbidden)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/vouchers/"+uuid.NewString(), nil), http.StatusNotFound)
+	expectProblem(t, s.call(admin, http.MethodPatch, "/api/v1/vouchers/"+uuid.NewString(), map[string]any{"active": false}), http.StatusNotFound)
+	expectProblem(t, s.call(admin, http.MethodGet, "/api/v1/vouchers?event_id=x", nil), http.StatusBadRequest)
+}
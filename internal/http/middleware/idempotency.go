@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/auth"
+	"github.com/miftahulhidayati/registration-payment-service/internal/http/problem"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	headerReplayed       = "Idempotent-Replayed"
+	maxKeyLength         = 200
+	// reservationLease is how long a request holds its key before a retry
+	// may take it over, in case the request died without releasing it. It
+	// is well beyond the time any request takes.
+	reservationLease = 2 * time.Minute
+)
+
+// Idempotency makes a route safe to retry. Requests carrying an
+// Idempotency-Key header run once; retries with the same key and body get
+// the stored response back, and reusing a key for a different request is
+// rejected with 422. Server errors release the key so the client can retry,
+// and a key whose request never finished is freed after reservationLease.
+func Idempotency(repo repository.IdempotencyStore, ttl time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxKeyLength {
+			return problem.Respond(c, http.StatusBadRequest, "Idempotency-Key too long")
+		}
+		key = storedKey(auth.FromCtx(c), key)
+
+		hash, err := requestHash(c)
+		if err != nil {
+			return problem.Respond(c, http.StatusBadRequest, "invalid payload")
+		}
+
+		ctx := context.Background()
+		rec, reserved, err := repo.ReserveIdempotencyKey(ctx, key, hash, ttl, reservationLease)
+		if err != nil {
+			return problem.Internal(c, err)
+		}
+		if !reserved {
+			return replay(c, rec, hash)
+		}
+
+		if err := c.Next(); err != nil {
+			_ = repo.ReleaseIdempotencyKey(ctx, key)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= http.StatusInternalServerError {
+			_ = repo.ReleaseIdempotencyKey(ctx, key)
+			return nil
+		}
+		contentType := string(c.Response().Header.ContentType())
+		if err := repo.CompleteIdempotencyKey(ctx, key, status, contentType, c.Response().Body()); err != nil {
+			// The request succeeded; a failed store only costs us replay on retry
+			_ = repo.ReleaseIdempotencyKey(ctx, key)
+		}
+		return nil
+	}
+}
+
+// storedKey is what key is stored under: a hash of the caller's subject and
+// key, so one user cannot replay another's response and subjects of any
+// length fit the column.
+func storedKey(p *auth.Principal, key string) string {
+	h := sha256.New()
+	if p != nil {
+		io.WriteString(h, p.Subject)
+	}
+	// The separator keeps subject and key from running into each other
+	io.WriteString(h, "\x00"+key)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(c *fiber.Ctx, rec *repository.IdempotencyRecord, hash string) error {
+	if rec.RequestHash != hash {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+	}
+	if rec.CompletedAt == nil || rec.StatusCode == nil {
+		return problem.Respond(c, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+	}
+	if rec.ContentType != nil {
+		c.Set(fiber.HeaderContentType, *rec.ContentType)
+	}
+	c.Set(headerReplayed, "true")
+	return c.Status(*rec.StatusCode).Send(rec.ResponseBody)
+}
+
+// requestHash fingerprints method, path and body. Multipart bodies are hashed
+// by field and file content, since clients pick a new boundary on each retry.
+func requestHash(c *fiber.Ctx) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, c.Method()+" "+c.Path()+"\n")
+
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		h.Write(c.Body())
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range sortedKeys(form.Value) {
+		for _, v := range form.Value[name] {
+			io.WriteString(h, "value:"+name+"="+v+"\n")
+		}
+	}
+	for _, name := range sortedKeys(form.File) {
+		for _, fh := range form.File[name] {
+			io.WriteString(h, "file:"+name+"="+fh.Filename+"\n")
+			f, err := fh.Open()
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+// Package problem writes error responses as RFC 7807 problem details
+// (application/problem+json).
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+const ContentType = "application/problem+json"
+
+// TypeValidation identifies responses listing invalid fields.
+const TypeValidation = "/problems/validation"
+
+// Details is an RFC 7807 problem. Extensions are merged into the top-level
+// JSON object.
+type Details struct {
+	Type       string                  `json:"type"`
+	Title      string                  `json:"title"`
+	Status     int                     `json:"status"`
+	Detail     string                  `json:"detail,omitempty"`
+	Instance   string                  `json:"instance,omitempty"`
+	Errors     []validation.FieldError `json:"errors,omitempty"`
+	Extensions map[string]any          `json:"-"`
+}
+
+// New returns a problem of the generic "about:blank" type for status.
+func New(status int, detail string) *Details {
+	return &Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With adds an extension member and returns d.
+func (d *Details) With(key string, value any) *Details {
+	if d.Extensions == nil {
+		d.Extensions = map[string]any{}
+	}
+	d.Extensions[key] = value
+	return d
+}
+
+func (d *Details) MarshalJSON() ([]byte, error) {
+	type plain Details
+	base, err := json.Marshal((*plain)(d))
+	if err != nil || len(d.Extensions) == 0 {
+		return base, err
+	}
+	merged := map[string]any{}
+	for k, v := range d.Extensions {
+		merged[k] = v
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(base, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
+
+// Write sends d as the response.
+func Write(c *fiber.Ctx, d *Details) error {
+	if d.Instance == "" {
+		d.Instance = c.OriginalURL()
+	}
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, ContentType)
+	return c.Status(d.Status).Send(body)
+}
+
+// Respond sends a generic problem with the given status and detail.
+func Respond(c *fiber.Ctx, status int, detail string) error {
+	return Write(c, New(status, detail))
+}
+
+// Validation sends a 400 listing every invalid field.
+func Validation(c *fiber.Ctx, errs validation.Errors) error {
+	d := New(http.StatusBadRequest, "one or more fields are invalid")
+	d.Type = TypeValidation
+	d.Title = "Validation failed"
+	d.Errors = errs
+	return Write(c, d)
+}
+
+// Internal logs err and sends a 500 without exposing its text.
+func Internal(c *fiber.Ctx, err error) error {
+	log.Printf("%s %s: %v", c.Method(), c.OriginalURL(), err)
+	return Respond(c, http.StatusInternalServerError, "internal server error")
+}
+
+// ErrorHandler is a fiber.Config ErrorHandler that renders errors reaching
+// fiber (unknown routes, oversized bodies, panics turned into errors) as
+// problems.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return Respond(c, fe.Code, fe.Message)
+	}
+	return Internal(c, err)
+}
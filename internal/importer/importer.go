@@ -0,0 +1,271 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// MaxRows caps the data rows of a single import.
+const MaxRows = 5000
+
+// ErrInvalidFile is returned when the CSV as a whole cannot be used, as
+// opposed to individual rows failing validation.
+var ErrInvalidFile = errors.New("invalid import file")
+
+// Columns accepted in the CSV header, named like the createRegistration
+// request fields. Order in the file does not matter.
+var (
+	requiredColumns = []string{"full_name", "gender", "phone", "email"}
+	optionalColumns = []string{
+		"user_id", "address", "emergency_contact_name", "emergency_contact_phone",
+		"emergency_contact_relation", "special_needs", "category",
+	}
+)
+
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type Report struct {
+	DryRun      bool       `json:"dry_run"`
+	TotalRows   int        `json:"total_rows"`
+	ValidRows   int        `json:"valid_rows"`
+	InvalidRows int        `json:"invalid_rows"`
+	Imported    int        `json:"imported"`
+	Waitlisted  int        `json:"waitlisted"`
+	Errors      []RowError `json:"errors"`
+}
+
+// Importer bulk-loads registrations for an event from CSV.
+type Importer struct {
+	repo         repository.ImportStore
+	createdTopic string
+}
+
+func New(repo repository.ImportStore, createdTopic string) *Importer {
+	return &Importer{repo: repo, createdTopic: createdTopic}
+}
+
+type row struct {
+	line   int
+	params repository.CreateRegistrationParams
+}
+
+// Import validates every row of the CSV in r and, unless dryRun is set,
+// inserts the valid ones in one transaction, publishing registration.created
+// for each through the outbox. Invalid rows are skipped and listed in the
+// report with their line number.
+func (im *Importer) Import(ctx context.Context, eventID uuid.UUID, r io.Reader, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, Errors: []RowError{}}
+	pricing, err := im.repo.GetEventPricing(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := parse(eventID, pricing, r, report)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = im.rejectDuplicates(ctx, eventID, rows, report)
+	if err != nil {
+		return nil, err
+	}
+	report.ValidRows = len(rows)
+	report.InvalidRows = report.TotalRows - report.ValidRows
+	if dryRun || len(rows) == 0 {
+		return report, nil
+	}
+
+	params := make([]repository.CreateRegistrationParams, len(rows))
+	for i, row := range rows {
+		params[i] = row.params
+	}
+	regs, err := im.repo.ImportRegistrations(ctx, eventID, params, func(reg *repository.Registration) []repository.OutboxMessage {
+		return []repository.OutboxMessage{repository.RegistrationCreatedEvent(im.createdTopic, reg)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Imported = len(regs)
+	for _, reg := range regs {
+		if reg.WaitlistPosition != nil {
+			report.Waitlisted++
+		}
+	}
+	return report, nil
+}
+
+// parse reads the header and data rows, recording rows that fail validation
+// or name a category the event's pricing does not offer in report and
+// returning the rest.
+func parse(eventID uuid.UUID, pricing *repository.EventPricing, r io.Reader, report *Report) ([]row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	index, err := columnIndex(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []row
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		line, _ := cr.FieldPos(0)
+		if isBlank(record) {
+			continue
+		}
+		report.TotalRows++
+		if report.TotalRows > MaxRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidFile, MaxRows)
+		}
+		if len(record) != len(header) {
+			report.Errors = append(report.Errors, RowError{Row: line, Error: fmt.Sprintf("expected %d fields, got %d", len(header), len(record))})
+			continue
+		}
+
+		params, err := rowParams(eventID, record, index)
+		if err == nil {
+			err = params.Validate()
+		}
+		if err == nil {
+			_, err = pricing.AmountDue(params.Category, params.Gender, time.Now())
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, RowError{Row: line, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, row{line: line, params: params})
+	}
+	return rows, nil
+}
+
+// rejectDuplicates drops rows whose user_id appears earlier in the file or
+// is already registered for the event.
+func (im *Importer) rejectDuplicates(ctx context.Context, eventID uuid.UUID, rows []row, report *Report) ([]row, error) {
+	var userIDs []uuid.UUID
+	for _, row := range rows {
+		if row.params.UserID != nil {
+			userIDs = append(userIDs, *row.params.UserID)
+		}
+	}
+	registered, err := im.repo.RegisteredUserIDs(ctx, eventID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	firstLine := make(map[uuid.UUID]int)
+	kept := rows[:0]
+	for _, row := range rows {
+		if id := row.params.UserID; id != nil {
+			if registered[*id] {
+				report.Errors = append(report.Errors, RowError{Row: row.line, Error: "user_id is already registered for this event"})
+				continue
+			}
+			if first, dup := firstLine[*id]; dup {
+				report.Errors = append(report.Errors, RowError{Row: row.line, Error: fmt.Sprintf("duplicate user_id, first seen on row %d", first)})
+				continue
+			}
+			firstLine[*id] = row.line
+		}
+		kept = append(kept, row)
+	}
+	return kept, nil
+}
+
+func columnIndex(header []string) (map[string]int, error) {
+	known := make(map[string]bool)
+	for _, name := range append(append([]string{}, requiredColumns...), optionalColumns...) {
+		known[name] = true
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // BOM written by Excel
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidFile, name)
+		}
+		if _, dup := index[name]; dup {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidFile, name)
+		}
+		index[name] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidFile, name)
+		}
+	}
+	return index, nil
+}
+
+func rowParams(eventID uuid.UUID, record []string, index map[string]int) (repository.CreateRegistrationParams, error) {
+	get := func(name string) string {
+		if i, ok := index[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	optional := func(name string) *string {
+		if v := get(name); v != "" {
+			return &v
+		}
+		return nil
+	}
+
+	params := repository.CreateRegistrationParams{
+		EventID:                  eventID,
+		FullName:                 get("full_name"),
+		Gender:                   strings.ToLower(get("gender")),
+		Phone:                    get("phone"),
+		Email:                    get("email"),
+		Address:                  optional("address"),
+		EmergencyContactName:     optional("emergency_contact_name"),
+		EmergencyContactPhone:    optional("emergency_contact_phone"),
+		EmergencyContactRelation: optional("emergency_contact_relation"),
+		SpecialNeeds:             optional("special_needs"),
+		Category:                 get("category"),
+	}
+	if v := get("user_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return params, errors.New("invalid user_id")
+		}
+		params.UserID = &id
+	}
+	return params, nil
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
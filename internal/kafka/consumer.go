@@ -3,59 +3,119 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
-	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
 )
 
 type EventStatusChanged struct {
-    RegistrationID string `json:"registration_id"`
-    Status         string `json:"status"`
-    Timestamp      string `json:"timestamp"`
+	RegistrationID string `json:"registration_id"`
+	Status         string `json:"status"`
+	Timestamp      string `json:"timestamp"`
 }
 
+// errSkip marks messages that can never be applied (malformed payloads,
+// unknown registrations, illegal transitions, and promotions off the
+// waitlist, which only a freed seat may trigger). They are logged and
+// committed so they do not block the partition.
+var errSkip = errors.New("skipping message")
+
 // StartConsumer starts a Kafka consumer for the event.status.changed topic.
-// It reads messages, unmarshals them into EventStatusChanged, and updates the registration status in the database.
-func StartConsumer(brokers string, topic string, groupID string, repo *repository.Postgres) error {
-    r := kafka.NewReader(kafka.ReaderConfig{
-        Brokers:   []string{brokers},
-        Topic:     topic,
-        GroupID:   groupID,
-        MinBytes:  10e3, // 10KB
-        MaxBytes:  10e6, // 10MB
-        CommitInterval: time.Second,
-    })
-    defer r.Close()
-
-    ctx := context.Background()
-    for {
-        m, err := r.ReadMessage(ctx)
-        if err != nil {
-            log.Printf("error reading kafka message: %v", err)
-            return err
-        }
-        var evt EventStatusChanged
-        if err := json.Unmarshal(m.Value, &evt); err != nil {
-            log.Printf("failed to unmarshal event.status.changed: %v", err)
-            continue
-        }
-        // Example: update registration status in DB (implementation placeholder)
-        if err := updateRegistrationStatus(ctx, repo, evt); err != nil {
-            log.Printf("failed to update registration status: %v", err)
-        } else {
-            log.Printf("processed event.status.changed for registration %s, status %s", evt.RegistrationID, evt.Status)
-        }
-    }
+// Each message updates the registration status in the database, and its
+// offset is committed only after that write succeeds. Transient database
+// errors are retried until they succeed or ctx is cancelled.
+func StartConsumer(ctx context.Context, brokers string, topic string, groupID string, repo *repository.Postgres) error {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  []string{brokers},
+		Topic:    topic,
+		GroupID:  groupID,
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+	})
+	defer r.Close()
+
+	for {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("error reading kafka message: %v", err)
+			return err
+		}
+
+		// Status changes are attributed to the topic in the audit log
+		msgCtx := repository.WithActor(ctx, repository.Actor{ID: "kafka:" + topic})
+		if err := handleWithRetry(msgCtx, repo, m); err != nil {
+			// Only reachable when ctx is cancelled; leave the offset uncommitted
+			return nil
+		}
+		if err := r.CommitMessages(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("failed to commit kafka offset %d: %v", m.Offset, err)
+			return err
+		}
+	}
 }
 
-func updateRegistrationStatus(ctx context.Context, repo *repository.Postgres, evt EventStatusChanged) error {
-    // Placeholder implementation – you should replace this with actual DB logic.
-    // For example, you might have a method repo.UpdateRegistrationStatus(id, status).
-    // Here we just log the intention.
-    log.Printf("[DB] Update registration %s to status %s (timestamp %s)", evt.RegistrationID, evt.Status, evt.Timestamp)
-    return nil
+func handleWithRetry(ctx context.Context, repo *repository.Postgres, m kafka.Message) error {
+	backoff := 500 * time.Millisecond
+	for {
+		err := handleMessage(ctx, repo, m)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errSkip) {
+			log.Printf("%v (offset %d)", err, m.Offset)
+			return nil
+		}
+
+		log.Printf("failed to update registration status, retrying in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
 }
 
+func handleMessage(ctx context.Context, repo *repository.Postgres, m kafka.Message) error {
+	var evt EventStatusChanged
+	if err := json.Unmarshal(m.Value, &evt); err != nil {
+		return fmt.Errorf("%w: invalid event.status.changed payload: %v", errSkip, err)
+	}
+	id, err := uuid.Parse(evt.RegistrationID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid registration_id %q", errSkip, evt.RegistrationID)
+	}
+	status, err := statemachine.Parse(evt.Status)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errSkip, err)
+	}
 
+	err = repo.UpdateRegistrationStatus(ctx, id, status, repository.StatusChangeCancelReason)
+	var transitionErr *statemachine.TransitionError
+	switch {
+	case errors.Is(err, repository.ErrRegistrationNotFound):
+		return fmt.Errorf("%w: unknown registration %s", errSkip, id)
+	case errors.As(err, &transitionErr), errors.Is(err, repository.ErrWaitlistPromotion):
+		return fmt.Errorf("%w: registration %s: %v", errSkip, id, err)
+	case err != nil:
+		return err
+	}
+
+	log.Printf("processed event.status.changed for registration %s, status %s", id, status)
+	return nil
+}
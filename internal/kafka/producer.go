@@ -16,9 +16,13 @@ func NewProducer(brokers string) (*Producer, error) {
     if brokers == "" {
         return nil, nil
     }
+    // Hash keeps each registration's events on one partition, in order. The
+    // outbox relay writes one message at a time and must know it was stored.
     w := &kgo.Writer{
-        Addr:     kgo.TCP(brokers),
-        Balancer: &kgo.LeastBytes{},
+        Addr:         kgo.TCP(brokers),
+        Balancer:     &kgo.Hash{},
+        RequiredAcks: kgo.RequireAll,
+        BatchTimeout: 10 * time.Millisecond,
     }
     return &Producer{writer: w}, nil
 }
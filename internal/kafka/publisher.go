@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// EventPublisher sends one JSON-encoded message to a topic. Producer
+// implements it for Kafka and MemoryPublisher for tests.
+type EventPublisher interface {
+	Publish(ctx context.Context, topic string, key string, data any) error
+}
+
+var (
+	_ EventPublisher = (*Producer)(nil)
+	_ EventPublisher = (*MemoryPublisher)(nil)
+)
+
+// Message is a message recorded by MemoryPublisher.
+type Message struct {
+	Topic string
+	Key   string
+	Value json.RawMessage
+}
+
+// MemoryPublisher records published messages instead of sending them. Err,
+// if set, is returned by Publish and nothing is recorded.
+type MemoryPublisher struct {
+	Err error
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, topic string, key string, data any) error {
+	if p.Err != nil {
+		return p.Err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, Message{Topic: topic, Key: key, Value: b})
+	return nil
+}
+
+// Messages returns the messages published so far, oldest first.
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/miftahulhidayati/registration-payment-service/migrations"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migs, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migs {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: want version %d", m.Version, m.Name, i+1)
+		}
+		if m.Down == "" || len(m.Checksum) != 64 {
+			t.Errorf("migration %d_%s: missing down script or checksum", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"no up script":      {"0001_a.down.sql": {Data: []byte("x")}},
+		"duplicate version": {"0001_a.up.sql": {Data: []byte("x")}, "0001_b.up.sql": {Data: []byte("y")}},
+	}
+	for name, fsys := range tests {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	migs, err := Load(fstest.MapFS{
+		"0002_b.up.sql": {Data: []byte("b")},
+		"0001_a.up.sql": {Data: []byte("a")},
+		"README.md":     {Data: []byte("ignored")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 || migs[0].Name != "a" || migs[1].Name != "b" {
+		t.Errorf("migrations = %+v", migs)
+	}
+}
@@ -0,0 +1,59 @@
+// Package outbox relays events stored in the outbox table to Kafka.
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/kafka"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+type Relay struct {
+	repo        repository.OutboxStore
+	producer    kafka.EventPublisher
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func NewRelay(repo repository.OutboxStore, producer kafka.EventPublisher, interval time.Duration, batchSize, maxAttempts int) *Relay {
+	return &Relay{repo: repo, producer: producer, interval: interval, batchSize: batchSize, maxAttempts: maxAttempts}
+}
+
+// Run polls the outbox until ctx is cancelled. Full batches are followed
+// immediately by another poll so a backlog drains without waiting. Messages
+// given up on after maxAttempts are parked and logged; parked messages left
+// from earlier runs are counted at startup.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	if n, err := r.repo.CountParkedOutbox(ctx); err != nil {
+		log.Printf("outbox relay: failed to count parked messages: %v", err)
+	} else if n > 0 {
+		log.Printf("WARNING: outbox relay: %d parked messages are waiting to be requeued", n)
+	}
+
+	for {
+		result, err := r.repo.ProcessOutbox(ctx, r.batchSize, r.maxAttempts, func(rec repository.OutboxRecord) error {
+			return r.producer.Publish(ctx, rec.Topic, rec.Key, rec.Payload)
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox relay error: %v", err)
+		}
+		for _, rec := range result.Parked {
+			log.Printf("WARNING: outbox relay: parked message %d (topic %s, key %s) after %d attempts: %s", rec.ID, rec.Topic, rec.Key, rec.Attempts, rec.LastError)
+		}
+		if result.Sent == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/kafka"
+	"github.com/miftahulhidayati/registration-payment-service/internal/repository"
+)
+
+// fakeOutbox hands out one prepared batch per poll.
+type fakeOutbox struct {
+	mu          sync.Mutex
+	batches     [][]repository.OutboxRecord
+	maxAttempts []int
+	drained     chan struct{}
+}
+
+func (f *fakeOutbox) ProcessOutbox(ctx context.Context, limit, maxAttempts int, send func(repository.OutboxRecord) error) (repository.OutboxResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxAttempts = append(f.maxAttempts, maxAttempts)
+	var result repository.OutboxResult
+	if len(f.batches) == 0 {
+		if f.drained != nil {
+			close(f.drained)
+			f.drained = nil
+		}
+		return result, nil
+	}
+	batch := f.batches[0]
+	f.batches = f.batches[1:]
+	for _, rec := range batch {
+		if err := send(rec); err != nil {
+			return result, err
+		}
+		result.Sent++
+	}
+	return result, nil
+}
+
+func (f *fakeOutbox) CountParkedOutbox(ctx context.Context) (int, error) { return 0, nil }
+
+func record(id int64, key string) repository.OutboxRecord {
+	return repository.OutboxRecord{ID: id, Topic: "topic", Key: key, Payload: json.RawMessage(`{}`)}
+}
+
+func TestRelayDrainsBacklog(t *testing.T) {
+	store := &fakeOutbox{
+		batches: [][]repository.OutboxRecord{
+			{record(1, "a"), record(2, "b")},
+			{record(3, "a")},
+		},
+		drained: make(chan struct{}),
+	}
+	drained := store.drained
+	pub := &kafka.MemoryPublisher{}
+	// The interval is far off: only the backlog rule can trigger the polls
+	relay := NewRelay(store, pub, time.Hour, 2, 7)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("polled again after a short batch without waiting for the interval")
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	<-done
+
+	var keys []string
+	for _, m := range pub.Messages() {
+		keys = append(keys, m.Key)
+	}
+	if !slices.Equal(keys, []string{"a", "b", "a"}) {
+		t.Errorf("published keys %v", keys)
+	}
+	if !slices.Equal(store.maxAttempts, []int{7, 7}) {
+		t.Errorf("polls with max attempts %v, want two polls with 7", store.maxAttempts)
+	}
+}
+
+func TestRelayWaitsAfterFailedPublish(t *testing.T) {
+	store := &fakeOutbox{batches: [][]repository.OutboxRecord{{record(1, "a")}}}
+	pub := &kafka.MemoryPublisher{Err: errors.New("broker unavailable")}
+	relay := NewRelay(store, pub, time.Hour, 1, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	relay.Run(ctx)
+	if len(pub.Messages()) != 0 || len(store.maxAttempts) != 1 {
+		t.Errorf("published %d messages in %d polls", len(pub.Messages()), len(store.maxAttempts))
+	}
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SystemActor is recorded for changes made without a request context, such
+// as background jobs.
+const SystemActor = "system"
+
+// Actor identifies who caused a change, for the audit log.
+type Actor struct {
+	ID        string
+	RequestID string
+	IP        string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose mutations are attributed to actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) Actor {
+	if a, ok := ctx.Value(actorKey{}).(Actor); ok && a.ID != "" {
+		return a
+	}
+	return Actor{ID: SystemActor}
+}
+
+// AuditEvent is one entry of a registration's change history. Before and
+// After hold only the fields that changed.
+type AuditEvent struct {
+	ID             int64           `json:"id"`
+	RegistrationID uuid.UUID       `json:"registration_id"`
+	EntityType     string          `json:"entity_type"`
+	EntityID       uuid.UUID       `json:"entity_id"`
+	Action         string          `json:"action"`
+	Actor          string          `json:"actor"`
+	Before         json.RawMessage `json:"before" swaggertype:"object"`
+	After          json.RawMessage `json:"after" swaggertype:"object"`
+	RequestID      *string         `json:"request_id"`
+	IP             *string         `json:"ip"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// auditIgnored are fields that change on every write and would only add
+// noise to a diff.
+var auditIgnored = map[string]bool{"updated_at": true}
+
+// auditRegistration records a change to a registration. before is nil for
+// newly created registrations.
+func auditRegistration(ctx context.Context, q querier, action string, before, after *Registration) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return writeAudit(ctx, q, after.RegistrationID, "registration", after.RegistrationID, action, b, after)
+}
+
+// auditPayment records a change to a payment. before is nil for new payments.
+func auditPayment(ctx context.Context, q querier, action string, before, after *Payment) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return writeAudit(ctx, q, after.RegistrationID, "payment", after.PaymentID, action, b, after)
+}
+
+// auditRefund records a change to a refund. before is nil for new refunds.
+func auditRefund(ctx context.Context, q querier, action string, before, after *Refund) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return writeAudit(ctx, q, after.RegistrationID, "refund", after.RefundID, action, b, after)
+}
+
+func writeAudit(ctx context.Context, q querier, registrationID uuid.UUID, entityType string, entityID uuid.UUID, action string, before, after any) error {
+	b, a, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 && len(a) == 0 {
+		return nil
+	}
+	beforeJSON, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit diff: %w", err)
+	}
+	afterJSON, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit diff: %w", err)
+	}
+
+	actor := actorFrom(ctx)
+	_, err = q.Exec(ctx, `
+		INSERT INTO audit_events (
+			registration_id, entity_type, entity_id, action, actor,
+			before, after, request_id, ip
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''))
+	`, registrationID, entityType, entityID, action, actor.ID, beforeJSON, afterJSON, actor.RequestID, actor.IP)
+	return err
+}
+
+// auditDiff compares the JSON forms of before and after and returns the
+// fields whose values differ, as they were and as they are now.
+func auditDiff(before, after any) (map[string]any, map[string]any, error) {
+	bm, err := toJSONMap(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	am, err := toJSONMap(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, a := map[string]any{}, map[string]any{}
+	for k, av := range am {
+		if auditIgnored[k] {
+			continue
+		}
+		if bv, ok := bm[k]; !ok || !reflect.DeepEqual(bv, av) {
+			if ok {
+				b[k] = bv
+			}
+			a[k] = av
+		}
+	}
+	for k, bv := range bm {
+		if _, ok := am[k]; !ok && !auditIgnored[k] {
+			b[k] = bv
+		}
+	}
+	return b, a, nil
+}
+
+func toJSONMap(v any) (map[string]any, error) {
+	m := map[string]any{}
+	if v == nil {
+		return m, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit snapshot: %w", err)
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("failed to marshal audit snapshot: %w", err)
+	}
+	return m, nil
+}
+
+// lockRegistration reads a registration and locks it for the rest of tx, so
+// the audit snapshot matches what the following update changes. It returns
+// nil if the registration does not exist.
+func lockRegistration(ctx context.Context, tx pgx.Tx, registrationID uuid.UUID) (*Registration, error) {
+	reg, err := scanRegistration(tx.QueryRow(ctx, `
+		SELECT `+registrationColumns+`
+		FROM registrations
+		WHERE registration_id = $1
+		FOR UPDATE
+	`, registrationID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return reg, err
+}
+
+// ListAuditEvents returns the change history of a registration and its
+// payments, oldest first.
+func (r *Postgres) ListAuditEvents(ctx context.Context, registrationID uuid.UUID) ([]*AuditEvent, error) {
+	rows, err := r.Pool.Query(ctx, `
+		SELECT id, registration_id, entity_type, entity_id, action, actor,
+			before, after, request_id, ip, created_at
+		FROM audit_events
+		WHERE registration_id = $1
+		ORDER BY id
+	`, registrationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		err := rows.Scan(&e.ID, &e.RegistrationID, &e.EntityType, &e.EntityID, &e.Action, &e.Actor,
+			&e.Before, &e.After, &e.RequestID, &e.IP, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrEventFull is returned when an event has no seats left.
+	ErrEventFull = errors.New("event is full")
+	// ErrGenderQuotaFull is returned when the seats for the registrant's gender are taken.
+	ErrGenderQuotaFull = errors.New("quota for this gender is full")
+)
+
+// paymentDueAt returns an SQL expression for the payment deadline of a
+// registration of the event in eventIDExpr: now plus the event's
+// payment_window_hours, or defaultHoursExpr hours if the event sets none.
+func paymentDueAt(eventIDExpr, defaultHoursExpr string) string {
+	return `CURRENT_TIMESTAMP + make_interval(hours => COALESCE(
+		(SELECT ec.payment_window_hours FROM event_capacity ec WHERE ec.event_id = ` + eventIDExpr + `),
+		` + defaultHoursExpr + `::int))`
+}
+
+// seatHoldingStatuses are the registration statuses that occupy a seat.
+var seatHoldingStatuses = []string{"pending", "paid", "partially_paid", "confirmed"}
+
+type EventCapacity struct {
+	EventID            uuid.UUID `json:"event_id"`
+	TotalQuota         *int      `json:"total_quota"`
+	MaleQuota          *int      `json:"male_quota"`
+	FemaleQuota        *int      `json:"female_quota"`
+	PaymentWindowHours *int      `json:"payment_window_hours"`
+	RegisteredTotal    int       `json:"registered_total"`
+	RegisteredMale     int       `json:"registered_male"`
+	RegisteredFemale   int       `json:"registered_female"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type UpsertEventCapacityParams struct {
+	EventID            uuid.UUID
+	TotalQuota         *int
+	MaleQuota          *int
+	FemaleQuota        *int
+	PaymentWindowHours *int
+}
+
+// UpsertEventCapacity sets an event's quotas. Raising them promotes
+// waitlisted registrants into the new seats.
+func (r *Postgres) UpsertEventCapacity(ctx context.Context, params UpsertEventCapacityParams) (*EventCapacity, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO event_capacity (event_id, total_quota, male_quota, female_quota, payment_window_hours)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (event_id) DO UPDATE
+		SET total_quota = EXCLUDED.total_quota,
+			male_quota = EXCLUDED.male_quota,
+			female_quota = EXCLUDED.female_quota,
+			payment_window_hours = EXCLUDED.payment_window_hours,
+			updated_at = CURRENT_TIMESTAMP
+	`, params.EventID, params.TotalQuota, params.MaleQuota, params.FemaleQuota, params.PaymentWindowHours)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.promoteWaitlisted(ctx, tx, params.EventID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return r.GetEventCapacity(ctx, params.EventID)
+}
+
+// GetEventCapacity returns the quotas of an event together with the seats
+// currently taken, or nil if the event has no capacity configured.
+func (r *Postgres) GetEventCapacity(ctx context.Context, eventID uuid.UUID) (*EventCapacity, error) {
+	return getEventCapacity(ctx, r.Pool, eventID, false)
+}
+
+func getEventCapacity(ctx context.Context, q querier, eventID uuid.UUID, forUpdate bool) (*EventCapacity, error) {
+	query := `
+		SELECT event_id, total_quota, male_quota, female_quota, payment_window_hours, updated_at
+		FROM event_capacity
+		WHERE event_id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var ec EventCapacity
+	err := q.QueryRow(ctx, query, eventID).Scan(&ec.EventID, &ec.TotalQuota, &ec.MaleQuota, &ec.FemaleQuota, &ec.PaymentWindowHours, &ec.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = q.QueryRow(ctx, `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE gender = 'male'),
+			COUNT(*) FILTER (WHERE gender = 'female')
+		FROM registrations
+		WHERE event_id = $1 AND status = ANY($2::registration_status[])
+	`, eventID, seatHoldingStatuses).Scan(&ec.RegisteredTotal, &ec.RegisteredMale, &ec.RegisteredFemale)
+	if err != nil {
+		return nil, err
+	}
+	return &ec, nil
+}
+
+// checkSeat locks the event's capacity row for the rest of the transaction
+// and verifies a seat is free for gender. Concurrent sign-ups for the same
+// event queue on the lock, so the count they see cannot be stale.
+func checkSeat(ctx context.Context, tx pgx.Tx, eventID uuid.UUID, gender string) error {
+	ec, err := getEventCapacity(ctx, tx, eventID, true)
+	if err != nil || ec == nil {
+		return err
+	}
+	return ec.seatAvailable(gender)
+}
+
+func (ec *EventCapacity) seatAvailable(gender string) error {
+	if ec.TotalQuota != nil && ec.RegisteredTotal >= *ec.TotalQuota {
+		return ErrEventFull
+	}
+	switch gender {
+	case "male":
+		if ec.MaleQuota != nil && ec.RegisteredMale >= *ec.MaleQuota {
+			return ErrGenderQuotaFull
+		}
+	case "female":
+		if ec.FemaleQuota != nil && ec.RegisteredFemale >= *ec.FemaleQuota {
+			return ErrGenderQuotaFull
+		}
+	}
+	return nil
+}
+
+// takeSeat counts a seat handed out within the current transaction.
+func (ec *EventCapacity) takeSeat(gender string) {
+	ec.RegisteredTotal++
+	switch gender {
+	case "male":
+		ec.RegisteredMale++
+	case "female":
+		ec.RegisteredFemale++
+	}
+}
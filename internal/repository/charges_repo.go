@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+)
+
+var (
+	// ErrChargeNotFound is returned for a webhook about a charge this
+	// service did not create.
+	ErrChargeNotFound = errors.New("charge not found")
+	// ErrNoAmountDue is returned when a gateway charge is requested for a
+	// registration that owes nothing, or has no amount_due at all.
+	ErrNoAmountDue = errors.New("registration has no amount due to charge")
+)
+
+// Charge is a payment requested through a payment gateway. It stays pending
+// until the gateway reports it paid, expired or failed; a paid charge links
+// the approved payment it created.
+type Charge struct {
+	ChargeID         uuid.UUID  `json:"charge_id"`
+	RegistrationID   uuid.UUID  `json:"registration_id"`
+	Provider         string     `json:"provider"`
+	ProviderChargeID string     `json:"provider_charge_id"`
+	PaymentMethod    string     `json:"payment_method"`
+	Amount           float64    `json:"amount"`
+	PaymentCode      string     `json:"payment_code"`
+	Status           string     `json:"status"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	PaymentID        *uuid.UUID `json:"payment_id"`
+	PaidAt           *time.Time `json:"paid_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+type CreateChargeParams struct {
+	ChargeID         uuid.UUID
+	RegistrationID   uuid.UUID
+	Provider         string
+	ProviderChargeID string
+	PaymentMethod    string
+	Amount           float64
+	PaymentCode      string
+	ExpiresAt        *time.Time
+}
+
+// ChargeWebhookParams is a verified webhook event. Payload is the raw body,
+// kept with the event.
+type ChargeWebhookParams struct {
+	Provider         string
+	EventID          string
+	ProviderChargeID string
+	Status           string
+	Amount           float64
+	PaidAt           *time.Time
+	Payload          []byte
+}
+
+const chargeColumns = `charge_id, registration_id, provider, provider_charge_id, payment_method,
+			amount, payment_code, status, expires_at, payment_id, paid_at, created_at, updated_at`
+
+func scanCharge(row pgx.Row) (*Charge, error) {
+	var c Charge
+	err := row.Scan(
+		&c.ChargeID, &c.RegistrationID, &c.Provider, &c.ProviderChargeID, &c.PaymentMethod,
+		&c.Amount, &c.PaymentCode, &c.Status, &c.ExpiresAt, &c.PaymentID, &c.PaidAt, &c.CreatedAt, &c.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// auditCharge records a change to a charge. before is nil for new charges.
+func auditCharge(ctx context.Context, q querier, action string, before, after *Charge) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return writeAudit(ctx, q, after.RegistrationID, "charge", after.ChargeID, action, b, after)
+}
+
+// CreateCharge stores a charge the gateway created. It follows the rules of
+// CreatePayment: charges are refused once the registration has been
+// confirmed, cancelled or rejected, and for members of an order. The
+// registration's status is left alone until the charge is paid.
+func (r *Postgres) CreateCharge(ctx context.Context, params CreateChargeParams) (*Charge, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	reg, err := lockRegistration(ctx, tx, params.RegistrationID)
+	if err != nil {
+		return nil, err
+	}
+	if reg == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	if err := checkPayable(reg); err != nil {
+		return nil, err
+	}
+	if reg.OrderID != nil {
+		return nil, ErrPaidByOrder
+	}
+
+	charge, err := scanCharge(tx.QueryRow(ctx, `
+		INSERT INTO payment_charges (
+			charge_id, registration_id, provider, provider_charge_id, payment_method,
+			amount, payment_code, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+chargeColumns,
+		params.ChargeID, params.RegistrationID, params.Provider, params.ProviderChargeID, params.PaymentMethod,
+		params.Amount, params.PaymentCode, params.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+	if err := auditCharge(ctx, tx, "charge.created", nil, charge); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return charge, nil
+}
+
+// ListChargesByRegistrationID returns the gateway charges of a registration,
+// newest first.
+func (r *Postgres) ListChargesByRegistrationID(ctx context.Context, registrationID uuid.UUID) ([]*Charge, error) {
+	rows, err := r.Pool.Query(ctx, `
+		SELECT `+chargeColumns+`
+		FROM payment_charges
+		WHERE registration_id = $1
+		ORDER BY created_at DESC
+	`, registrationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var charges []*Charge
+	for rows.Next() {
+		c, err := scanCharge(rows)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, c)
+	}
+	return charges, rows.Err()
+}
+
+// ApplyChargeWebhook applies a gateway's report on one of its charges and
+// reports whether it changed anything. An event seen before, or one about a
+// charge that is no longer pending, is acknowledged without effect. A paid
+// charge records an approved payment of the amount paid: it is credited to
+// the registration, which settles as on a verifier's approval, and the events
+// built by events from the payment and registration are enqueued, all in one
+// transaction.
+func (r *Postgres) ApplyChargeWebhook(ctx context.Context, params ChargeWebhookParams, events func(*Payment, *Registration) []OutboxMessage) (*Charge, bool, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO payment_webhooks (provider, event_id, provider_charge_id, status, payload)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider, event_id) DO NOTHING
+	`, params.Provider, params.EventID, params.ProviderChargeID, params.Status, params.Payload)
+	if err != nil {
+		return nil, false, err
+	}
+	before, err := scanCharge(tx.QueryRow(ctx, `
+		SELECT `+chargeColumns+`
+		FROM payment_charges
+		WHERE provider = $1 AND provider_charge_id = $2
+		FOR UPDATE
+	`, params.Provider, params.ProviderChargeID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, false, ErrChargeNotFound
+		}
+		return nil, false, err
+	}
+	if tag.RowsAffected() == 0 || before.Status != "pending" {
+		return before, false, tx.Commit(ctx)
+	}
+
+	var payment *Payment
+	var reg *Registration
+	if params.Status == "paid" {
+		if payment, reg, err = r.payCharge(ctx, tx, before, params); err != nil {
+			return nil, false, err
+		}
+	}
+	charge, err := scanCharge(tx.QueryRow(ctx, `
+		UPDATE payment_charges
+		SET status = $2,
+			payment_id = $3,
+			paid_at = $4,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE charge_id = $1
+		RETURNING `+chargeColumns,
+		before.ChargeID, params.Status, paymentID(payment), params.PaidAt))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := auditCharge(ctx, tx, "charge."+params.Status, before, charge); err != nil {
+		return nil, false, err
+	}
+	if payment != nil && events != nil {
+		if err := enqueueOutbox(ctx, tx, events(payment, reg)); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+	return charge, true, nil
+}
+
+// payCharge records the payment of a paid charge and approves it. The payer
+// may have paid after the registration stopped taking payments, typically
+// because it expired while they were paying. The money was collected all
+// the same, so the payment is recorded, rejected without touching the
+// registration, and refunded in full.
+func (r *Postgres) payCharge(ctx context.Context, tx pgx.Tx, charge *Charge, params ChargeWebhookParams) (*Payment, *Registration, error) {
+	reg, err := lockRegistration(ctx, tx, charge.RegistrationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reg == nil {
+		return nil, nil, ErrRegistrationNotFound
+	}
+	if checkPayable(reg) != nil {
+		payment, err := insertPayment(ctx, tx, CreatePaymentParams{
+			RegistrationID: charge.RegistrationID,
+			Amount:         params.Amount,
+			PaymentMethod:  charge.PaymentMethod,
+		}, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if payment, reg, err = r.verifyPayment(ctx, tx, chargeRefusal(charge, payment, reg)); err != nil {
+			return nil, nil, err
+		}
+		if err := refundPayment(ctx, tx, payment, reg.EventID); err != nil {
+			return nil, nil, err
+		}
+		return payment, reg, nil
+	}
+
+	if reg, err = markPaid(ctx, tx, charge.RegistrationID); err != nil {
+		return nil, nil, err
+	}
+	payment, err := insertPayment(ctx, tx, CreatePaymentParams{
+		RegistrationID: charge.RegistrationID,
+		Amount:         params.Amount,
+		PaymentMethod:  charge.PaymentMethod,
+	}, nil, reg.PaymentAmountStatus(params.Amount))
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.verifyPayment(ctx, tx, chargeApproval(charge, payment))
+}
+
+// chargeApproval is the verification a paid charge gives its payment.
+func chargeApproval(charge *Charge, payment *Payment) VerifyPaymentParams {
+	notes := fmt.Sprintf("paid through %s charge %s", charge.Provider, charge.ProviderChargeID)
+	return VerifyPaymentParams{
+		PaymentID:          payment.PaymentID,
+		RegistrationID:     payment.RegistrationID,
+		Approved:           true,
+		VerificationNotes:  &notes,
+		RegistrationStatus: statemachine.Confirmed,
+	}
+}
+
+// chargeRefusal is the verification given to the payment of a charge paid
+// once reg could no longer take it: a rejection that leaves reg as it is.
+func chargeRefusal(charge *Charge, payment *Payment, reg *Registration) VerifyPaymentParams {
+	params := chargeApproval(charge, payment)
+	reason := fmt.Sprintf("registration was already %s; refunded in full", reg.Status)
+	params.Approved = false
+	params.RejectionReason = &reason
+	params.RegistrationStatus = statemachine.Status(reg.Status)
+	return params
+}
+
+func paymentID(p *Payment) *uuid.UUID {
+	if p == nil {
+		return nil
+	}
+	return &p.PaymentID
+}
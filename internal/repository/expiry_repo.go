@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// PaymentTimeoutReason is recorded on registrations cancelled for not paying in time.
+const PaymentTimeoutReason = "payment timeout"
+
+// ExpireOverdueRegistrations cancels up to limit pending or partially paid
+// registrations whose payment deadline (for the latter, that of their next
+// installment) has passed, opens refunds for what was already paid as the
+// event's policy allows, gives back their voucher uses, enqueues the events
+// built by events for each one, and promotes waitlisted registrants into the
+// freed seats. A registration with a gateway charge still open is left until
+// the charge expires, so a payer who is paying right at the deadline is not
+// cancelled under them. Rows locked by a concurrent request are skipped
+// until the next run.
+func (r *Postgres) ExpireOverdueRegistrations(ctx context.Context, limit int, events func(*Registration) []OutboxMessage) ([]*Registration, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+registrationColumns+`
+		FROM registrations
+		WHERE status IN ('pending', 'partially_paid') AND payment_due_at < CURRENT_TIMESTAMP
+			AND NOT EXISTS (
+				SELECT 1 FROM payment_charges c
+				WHERE c.registration_id = registrations.registration_id
+					AND c.status = 'pending' AND c.expires_at >= CURRENT_TIMESTAMP
+			)
+		ORDER BY payment_due_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	overdue, err := scanRegistrations(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(overdue) == 0 {
+		return nil, nil
+	}
+	ids := make([]uuid.UUID, len(overdue))
+	before := make(map[uuid.UUID]*Registration, len(overdue))
+	for i, reg := range overdue {
+		ids[i] = reg.RegistrationID
+		before[reg.RegistrationID] = reg
+	}
+
+	rows, err = tx.Query(ctx, `
+		UPDATE registrations
+		SET status = 'cancelled',
+			cancelled_at = CURRENT_TIMESTAMP,
+			cancellation_reason = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE registration_id = ANY($1)
+		RETURNING `+registrationColumns,
+		ids, PaymentTimeoutReason,
+	)
+	if err != nil {
+		return nil, err
+	}
+	expired, err := scanRegistrations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := releaseVouchers(ctx, tx, ids); err != nil {
+		return nil, err
+	}
+	var eventIDs []uuid.UUID
+	for _, reg := range expired {
+		if err := auditRegistration(ctx, tx, "registration.expired", before[reg.RegistrationID], reg); err != nil {
+			return nil, err
+		}
+		if err := openRefund(ctx, tx, reg); err != nil {
+			return nil, err
+		}
+		if events != nil {
+			if err := enqueueOutbox(ctx, tx, events(reg)); err != nil {
+				return nil, err
+			}
+		}
+		eventIDs = append(eventIDs, reg.EventID)
+	}
+	// Capacity rows are locked in event_id order, as Postgres sorts UUIDs,
+	// so concurrent runs and requests cannot deadlock on them
+	slices.SortFunc(eventIDs, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	for _, eventID := range slices.Compact(eventIDs) {
+		if _, err := r.promoteWaitlisted(ctx, tx, eventID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RegistrationExportRow is a registration together with its latest payment,
+// if any.
+type RegistrationExportRow struct {
+	*Registration
+	PaymentStatus *string
+	PaymentAmount *float64
+	PaymentMethod *string
+	PaymentDate   *time.Time
+	VerifiedAt    *time.Time
+}
+
+// EachEventRegistration calls fn for every registration of an event in
+// registration order, streaming rows from the database instead of loading
+// them all. Iteration stops at the first error returned by fn.
+func (r *Postgres) EachEventRegistration(ctx context.Context, eventID uuid.UUID, fn func(*RegistrationExportRow) error) error {
+	query := `
+		SELECT ` + qualify("r", registrationColumns) + `,
+			p.verification_status, p.amount, p.payment_method, p.payment_date, p.verified_at
+		FROM registrations r
+		LEFT JOIN LATERAL (
+			SELECT verification_status, amount, payment_method, payment_date, verified_at
+			FROM payments
+			WHERE payments.registration_id = r.registration_id
+			ORDER BY created_at DESC
+			LIMIT 1
+		) p ON true
+		WHERE r.event_id = $1
+		ORDER BY r.registration_date, r.registration_id
+	`
+
+	rows, err := r.Pool.Query(ctx, query, eventID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := RegistrationExportRow{Registration: &Registration{}}
+		dest := append(registrationFields(row.Registration),
+			&row.PaymentStatus, &row.PaymentAmount, &row.PaymentMethod, &row.PaymentDate, &row.VerifiedAt)
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type IdempotencyRecord struct {
+	Key          string
+	RequestHash  string
+	StatusCode   *int
+	ContentType  *string
+	ResponseBody []byte
+	CompletedAt  *time.Time
+}
+
+// ReserveIdempotencyKey claims key for a request with the given hash. If the
+// key is already taken it returns the existing record and reserved=false.
+// Keys older than ttl can be claimed again, as can reservations left
+// incomplete for longer than lease, whose request died before it could
+// complete or release them. PurgeIdempotencyKeys deletes expired keys that
+// are never reused.
+func (r *Postgres) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, ttl, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	_, err := r.Pool.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE idempotency_key = $1
+			AND (created_at < CURRENT_TIMESTAMP - $2::interval
+				OR (completed_at IS NULL AND locked_until < CURRENT_TIMESTAMP))
+	`, key, interval(ttl))
+	if err != nil {
+		return nil, false, err
+	}
+
+	tag, err := r.Pool.Exec(ctx, `
+		INSERT INTO idempotency_keys (idempotency_key, request_hash, locked_until)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3::interval)
+		ON CONFLICT (idempotency_key) DO NOTHING
+	`, key, requestHash, interval(lease))
+	if err != nil {
+		return nil, false, err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, true, nil
+	}
+
+	var rec IdempotencyRecord
+	err = r.Pool.QueryRow(ctx, `
+		SELECT idempotency_key, request_hash, status_code, content_type, response_body, completed_at
+		FROM idempotency_keys
+		WHERE idempotency_key = $1
+	`, key).Scan(&rec.Key, &rec.RequestHash, &rec.StatusCode, &rec.ContentType, &rec.ResponseBody, &rec.CompletedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			// Released between our insert and select; let the client retry
+			return nil, false, fmt.Errorf("idempotency key %q changed concurrently", key)
+		}
+		return nil, false, err
+	}
+	return &rec, false, nil
+}
+
+// CompleteIdempotencyKey stores the response to replay for later retries.
+func (r *Postgres) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	_, err := r.Pool.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $2,
+			content_type = $3,
+			response_body = $4,
+			completed_at = CURRENT_TIMESTAMP
+		WHERE idempotency_key = $1
+	`, key, statusCode, contentType, body)
+	return err
+}
+
+// ReleaseIdempotencyKey frees a reserved key so the request can be retried,
+// used when the original attempt failed with a server error.
+func (r *Postgres) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := r.Pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND completed_at IS NULL`, key)
+	return err
+}
+
+// interval formats d as a Postgres interval, to the second.
+func interval(d time.Duration) string {
+	return fmt.Sprintf("%d seconds", int(d.Seconds()))
+}
+
+// PurgeIdempotencyKeys deletes up to limit keys older than ttl and returns
+// how many it deleted.
+func (r *Postgres) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit int) (int, error) {
+	tag, err := r.Pool.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE idempotency_key IN (
+			SELECT idempotency_key
+			FROM idempotency_keys
+			WHERE created_at < CURRENT_TIMESTAMP - $1::interval
+			LIMIT $2
+		)
+	`, interval(ttl), limit)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+)
+
+// RegisteredUserIDs returns which of userIDs already have a registration for
+// the event.
+func (r *Postgres) RegisteredUserIDs(ctx context.Context, eventID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	found := make(map[uuid.UUID]bool)
+	if len(userIDs) == 0 {
+		return found, nil
+	}
+	rows, err := r.Pool.Query(ctx, `
+		SELECT user_id
+		FROM registrations
+		WHERE event_id = $1 AND user_id = ANY($2)
+	`, eventID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+	return found, rows.Err()
+}
+
+var importColumns = []string{
+	"ord", "registration_id", "user_id", "full_name", "gender", "phone", "email",
+	"address", "emergency_contact_name", "emergency_contact_phone",
+	"emergency_contact_relation", "special_needs", "status", "waitlist_position",
+	"category", "amount_due",
+}
+
+// ImportRegistrations inserts registrations for one event in a single
+// transaction. Rows are bulk-loaded with COPY into a temporary table and
+// moved into registrations from there, so the enum and deadline columns are
+// filled by SQL exactly as CreateRegistration does. Seats are handed out in
+// row order under the event's capacity lock; rows that do not fit go on the
+// waitlist. Each row is priced like CreateRegistration. events is called
+// for each inserted registration and its messages are written to the outbox
+// in the same transaction.
+func (r *Postgres) ImportRegistrations(ctx context.Context, eventID uuid.UUID, params []CreateRegistrationParams, events func(*Registration) []OutboxMessage) ([]*Registration, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ec, err := getEventCapacity(ctx, tx, eventID, true)
+	if err != nil {
+		return nil, err
+	}
+	nextPos, err := nextWaitlistPosition(ctx, tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	pricing, err := getEventPricing(ctx, tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	rows := make([][]any, len(params))
+	for i, p := range params {
+		status := statemachine.Pending
+		var waitlistPosition *int
+		var seatErr error
+		if ec != nil {
+			seatErr = ec.seatAvailable(p.Gender)
+		}
+		switch {
+		case errors.Is(seatErr, ErrEventFull), errors.Is(seatErr, ErrGenderQuotaFull):
+			pos := nextPos
+			nextPos++
+			status = statemachine.Waitlisted
+			waitlistPosition = &pos
+		case ec != nil:
+			ec.takeSeat(p.Gender)
+		}
+
+		amountDue, err := pricing.AmountDue(p.Category, p.Gender, now)
+		if err != nil {
+			return nil, err
+		}
+		var category *string
+		if p.Category != "" {
+			category = &p.Category
+		}
+		id := p.RegistrationID
+		if id == uuid.Nil {
+			id = uuid.New()
+		}
+		rows[i] = []any{
+			i, id, p.UserID, p.FullName, p.Gender, p.Phone, p.Email,
+			p.Address, p.EmergencyContactName, p.EmergencyContactPhone,
+			p.EmergencyContactRelation, p.SpecialNeeds, string(status), waitlistPosition,
+			category, amountDue,
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE registration_import (
+			ord INT,
+			registration_id UUID,
+			user_id UUID,
+			full_name TEXT,
+			gender TEXT,
+			phone TEXT,
+			email TEXT,
+			address TEXT,
+			emergency_contact_name TEXT,
+			emergency_contact_phone TEXT,
+			emergency_contact_relation TEXT,
+			special_needs TEXT,
+			status TEXT,
+			waitlist_position INT,
+			category TEXT,
+			amount_due NUMERIC(10,2)
+		) ON COMMIT DROP
+	`)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"registration_import"}, importColumns, pgx.CopyFromRows(rows)); err != nil {
+		return nil, err
+	}
+
+	inserted, err := tx.Query(ctx, `
+		INSERT INTO registrations (
+			registration_id, event_id, user_id, full_name, gender, phone, email,
+			address, emergency_contact_name, emergency_contact_phone,
+			emergency_contact_relation, special_needs, status, waitlist_position,
+			payment_due_at, category, amount_due
+		)
+		SELECT registration_id, $1::uuid, user_id, full_name, gender, phone, email,
+			address, emergency_contact_name, emergency_contact_phone,
+			emergency_contact_relation, special_needs, status::registration_status, waitlist_position,
+			CASE WHEN waitlist_position IS NULL THEN `+paymentDueAt("$1", "$2")+` END,
+			category, amount_due
+		FROM registration_import
+		ORDER BY ord
+		RETURNING `+registrationColumns,
+		eventID, r.DefaultPaymentWindowHours)
+	if err != nil {
+		return nil, err
+	}
+	regs, err := scanRegistrations(inserted)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, reg := range regs {
+		if reg, err = scheduleInstallments(ctx, tx, reg, pricing); err != nil {
+			return nil, err
+		}
+		regs[i] = reg
+		if err := auditRegistration(ctx, tx, "registration.imported", nil, reg); err != nil {
+			return nil, err
+		}
+		if events != nil {
+			if err := enqueueOutbox(ctx, tx, events(reg)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+)
+
+// InstallmentRule is one step of an event's installment plan: Percent of
+// the price is due by DueAt.
+type InstallmentRule struct {
+	Percent int       `json:"percent"`
+	DueAt   time.Time `json:"due_at"`
+}
+
+// Installment is one part of a registration's amount_due and when it must
+// have been paid.
+type Installment struct {
+	Amount float64   `json:"amount"`
+	DueAt  time.Time `json:"due_at"`
+}
+
+// maxInstallments bounds the installment plan of an event.
+const maxInstallments = 12
+
+// Schedule splits amount into the event's installments. No installment is
+// due before earliest, the payment deadline the registration would have
+// without a plan, so late registrants are not overdue on arrival. It
+// returns nil when the event has no plan or nothing is owed.
+func (p *EventPricing) Schedule(amount *float64, earliest *time.Time) []Installment {
+	if p == nil || len(p.Installments) == 0 || amount == nil || *amount <= 0 || earliest == nil {
+		return nil
+	}
+	// Work in cents and give the remainder to the last installment, so the
+	// parts add up to amount
+	cents := math.Round(*amount * 100)
+	schedule := make([]Installment, len(p.Installments))
+	var assigned float64
+	for i, rule := range p.Installments {
+		share := math.Floor(cents * float64(rule.Percent) / 100)
+		if i == len(schedule)-1 {
+			share = cents - assigned
+		}
+		assigned += share
+		due := rule.DueAt.UTC()
+		if due.Before(*earliest) {
+			due = *earliest
+		}
+		schedule[i] = Installment{Amount: share / 100, DueAt: due}
+	}
+	return schedule
+}
+
+// nextInstallment returns the first installment that paid does not cover,
+// or nil once all are.
+func nextInstallment(schedule []Installment, paid float64) *Installment {
+	var cumulative float64
+	for i, inst := range schedule {
+		cumulative += math.Round(inst.Amount * 100)
+		if cumulative > math.Round(paid*100) {
+			return &schedule[i]
+		}
+	}
+	return nil
+}
+
+// owedNow is what reg must still pay to cover its next installment: the
+// installments due by then less what has been paid.
+func (reg *Registration) owedNow() float64 {
+	next := nextInstallment(reg.Installments, reg.AmountPaid)
+	if next == nil {
+		return 0
+	}
+	var cents float64
+	for _, inst := range reg.Installments {
+		if inst.DueAt.After(next.DueAt) {
+			break
+		}
+		cents += math.Round(inst.Amount * 100)
+	}
+	return (cents - math.Round(reg.AmountPaid*100)) / 100
+}
+
+// AmountOwed is what reg should pay next: the amount that covers its next
+// installment, or its balance without a plan. It is nil when reg has no
+// amount_due.
+func (reg *Registration) AmountOwed() *float64 {
+	if reg.Balance == nil {
+		return nil
+	}
+	owed := *reg.Balance
+	if len(reg.Installments) > 0 {
+		owed = reg.owedNow()
+	}
+	return &owed
+}
+
+// PaymentAmountStatus compares a payment with what reg still owes. Without
+// installments that is its balance. With them, anything from the amount
+// that covers the next installment up to the whole balance is exact.
+func (reg *Registration) PaymentAmountStatus(paid float64) *string {
+	if reg.Balance == nil || len(reg.Installments) == 0 {
+		return AmountStatus(paid, reg.Balance)
+	}
+	status := AmountExact
+	switch p := math.Round(paid * 100); {
+	case p < math.Round(reg.owedNow()*100):
+		status = AmountUnderpaid
+	case p > math.Round(*reg.Balance*100):
+		status = AmountOverpaid
+	}
+	return &status
+}
+
+// credit returns what reg's amount_paid and payment deadline become once
+// amount more is approved. With installments the deadline moves to the next
+// installment not yet covered, and is cleared once none is left.
+func (reg *Registration) credit(amount float64) (float64, *time.Time) {
+	paid := math.Round((reg.AmountPaid+amount)*100) / 100
+	if len(reg.Installments) == 0 {
+		return paid, reg.PaymentDueAt
+	}
+	next := nextInstallment(reg.Installments, paid)
+	if next == nil {
+		return paid, nil
+	}
+	due := next.DueAt
+	return paid, &due
+}
+
+// settledStatus is the status a payment decision leaves reg in, given the
+// status the verifier asked for. An approval only confirms reg once nothing
+// is owed, and a rejection returns it to partially_paid rather than pending
+// when earlier payments were approved.
+func settledStatus(reg *Registration, requested statemachine.Status) statemachine.Status {
+	switch {
+	case requested == statemachine.Confirmed && reg.Balance != nil && math.Round(*reg.Balance*100) > 0:
+		return statemachine.PartiallyPaid
+	case requested == statemachine.Pending && reg.AmountPaid > 0:
+		return statemachine.PartiallyPaid
+	}
+	return requested
+}
+
+// lapsed reports whether reg still owes a payment, being pending or
+// partially paid, while its payment deadline passed before now.
+func (reg *Registration) lapsed(now time.Time) bool {
+	owing := reg.Status == string(statemachine.Pending) || reg.Status == string(statemachine.PartiallyPaid)
+	return owing && reg.PaymentDueAt != nil && reg.PaymentDueAt.Before(now)
+}
+
+// reopenPaymentWindow gives reg a fresh payment window, as a promoted
+// registrant gets, when a payment decision left it owing after its deadline
+// passed: verifiers often decide after the deadline, and the participant
+// must get the chance to pay again before the expiry scheduler cancels reg.
+// reg is returned unchanged otherwise.
+func (r *Postgres) reopenPaymentWindow(ctx context.Context, tx pgx.Tx, reg *Registration) (*Registration, error) {
+	if !reg.lapsed(time.Now()) {
+		return reg, nil
+	}
+	after, err := scanRegistration(tx.QueryRow(ctx, `
+		UPDATE registrations
+		SET payment_due_at = `+paymentDueAt("event_id", "$2")+`,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE registration_id = $1
+		RETURNING `+registrationColumns,
+		reg.RegistrationID, r.DefaultPaymentWindowHours))
+	if err != nil {
+		return nil, err
+	}
+	if err := auditRegistration(ctx, tx, "registration.payment_window_reopened", reg, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// scheduleInstallments gives a registration that has just become pending
+// the event's installment plan and makes its first installment the payment
+// deadline. reg is returned unchanged when the event has no plan.
+func scheduleInstallments(ctx context.Context, tx pgx.Tx, reg *Registration, pricing *EventPricing) (*Registration, error) {
+	schedule := pricing.Schedule(reg.AmountDue, reg.PaymentDueAt)
+	if schedule == nil {
+		return reg, nil
+	}
+	return scanRegistration(tx.QueryRow(ctx, `
+		UPDATE registrations
+		SET installments = $2,
+			payment_due_at = $3
+		WHERE registration_id = $1
+		RETURNING `+registrationColumns,
+		reg.RegistrationID, schedule, schedule[0].DueAt))
+}
+
+// creditPayment adds an approved payment of amount to reg's amount_paid and
+// moves its payment deadline as credit does.
+func creditPayment(ctx context.Context, tx pgx.Tx, reg *Registration, amount float64) (*Registration, error) {
+	paid, dueAt := reg.credit(amount)
+	after, err := scanRegistration(tx.QueryRow(ctx, `
+		UPDATE registrations
+		SET amount_paid = $2,
+			payment_due_at = $3,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE registration_id = $1
+		RETURNING `+registrationColumns,
+		reg.RegistrationID, paid, dueAt))
+	if err != nil {
+		return nil, err
+	}
+	if err := auditRegistration(ctx, tx, "registration.payment_credited", reg, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
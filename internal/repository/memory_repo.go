@@ -0,0 +1,1949 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+// Memory keeps everything in process memory while applying the same rules
+// as Postgres: seat quotas and the waitlist, guarded status transitions, the
+// audit log and the outbox. It lets the HTTP layer be tested without a
+// database. Memory is safe for concurrent use.
+type Memory struct {
+	// See the fields of the same name on Postgres.
+	PromotedTopic             string
+	DefaultPaymentWindowHours int
+
+	mu            sync.Mutex
+	clock         time.Time
+	registrations []*Registration // in insertion order
+	payments      []*Payment      // in insertion order
+	refunds       []*Refund       // in insertion order
+	charges       []*Charge       // in insertion order
+	webhooks      map[memoryWebhookKey]bool
+	capacity      map[uuid.UUID]*EventCapacity
+	policies      map[uuid.UUID]*RefundPolicy
+	pricing       map[uuid.UUID]*EventPricing
+	vouchers      []*Voucher // in insertion order
+	redemptions   []memoryRedemption
+	orders        []*Order // in insertion order, without Registrations
+	audit         []*AuditEvent
+	outbox        []*memoryOutboxRow
+	idempotency   map[string]*memoryIdempotencyKey
+}
+
+type memoryOutboxRow struct {
+	OutboxRecord
+	sent          bool
+	parked        bool
+	nextAttemptAt time.Time
+}
+
+type memoryRedemption struct {
+	voucherID      uuid.UUID
+	registrationID uuid.UUID
+	email          string
+	released       bool
+}
+
+type memoryWebhookKey struct {
+	provider, eventID string
+}
+
+type memoryIdempotencyKey struct {
+	IdempotencyRecord
+	createdAt   time.Time
+	lockedUntil time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		DefaultPaymentWindowHours: 48,
+		capacity:                  make(map[uuid.UUID]*EventCapacity),
+		policies:                  make(map[uuid.UUID]*RefundPolicy),
+		pricing:                   make(map[uuid.UUID]*EventPricing),
+		webhooks:                  make(map[memoryWebhookKey]bool),
+		idempotency:               make(map[string]*memoryIdempotencyKey),
+	}
+}
+
+// now returns the current time at database precision, strictly after the
+// previous call so rows written in quick succession keep their order.
+func (m *Memory) now() time.Time {
+	t := time.Now().UTC().Truncate(time.Microsecond)
+	if !t.After(m.clock) {
+		t = m.clock.Add(time.Microsecond)
+	}
+	m.clock = t
+	return t
+}
+
+// uniqueViolation mimics the error Postgres returns for a duplicate key, so
+// callers map it the same way.
+func uniqueViolation(constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23505",
+		Message:        fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		ConstraintName: constraint,
+	}
+}
+
+// checkViolation mimics the error Postgres returns when a CHECK constraint
+// fails.
+func checkViolation(constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23514",
+		Message:        fmt.Sprintf("new row violates check constraint %q", constraint),
+		ConstraintName: constraint,
+	}
+}
+
+func cloneRegistration(reg *Registration) *Registration {
+	c := *reg
+	c.Installments = append([]Installment(nil), reg.Installments...)
+	return &c
+}
+
+// setBalance mirrors the generated balance column.
+func setBalance(reg *Registration) {
+	reg.Balance = nil
+	if reg.AmountDue != nil {
+		balance := math.Round((*reg.AmountDue-reg.AmountPaid)*100) / 100
+		reg.Balance = &balance
+	}
+}
+
+// scheduleInstallments follows the rules of the Postgres
+// scheduleInstallments.
+func (m *Memory) scheduleInstallments(reg *Registration) {
+	if schedule := m.pricing[reg.EventID].Schedule(reg.AmountDue, reg.PaymentDueAt); schedule != nil {
+		reg.Installments = schedule
+		reg.PaymentDueAt = &schedule[0].DueAt
+	}
+}
+
+func clonePayment(p *Payment) *Payment {
+	c := *p
+	return &c
+}
+
+func cloneRefund(r *Refund) *Refund {
+	c := *r
+	return &c
+}
+
+func (m *Memory) findRegistration(id uuid.UUID) *Registration {
+	for _, reg := range m.registrations {
+		if reg.RegistrationID == id {
+			return reg
+		}
+	}
+	return nil
+}
+
+// checkUnique enforces the primary key and unique_event_user on a new
+// registration.
+func (m *Memory) checkUnique(id, eventID uuid.UUID, userID *uuid.UUID) error {
+	for _, reg := range m.registrations {
+		if reg.RegistrationID == id {
+			return uniqueViolation("registrations_pkey")
+		}
+		if userID != nil && reg.UserID != nil && reg.EventID == eventID && *reg.UserID == *userID {
+			return uniqueViolation("unique_event_user")
+		}
+	}
+	return nil
+}
+
+// outboxRows encodes msgs up front so an unencodable payload fails the
+// operation before anything is changed.
+func (m *Memory) outboxRows(msgs []OutboxMessage) ([]*memoryOutboxRow, error) {
+	var rows []*memoryOutboxRow
+	for _, msg := range msgs {
+		if msg.Topic == "" {
+			continue
+		}
+		payload, err := json.Marshal(msg.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal outbox payload: %w", err)
+		}
+		rows = append(rows, &memoryOutboxRow{OutboxRecord: OutboxRecord{Topic: msg.Topic, Key: msg.Key, Payload: payload}})
+	}
+	return rows, nil
+}
+
+func (m *Memory) enqueue(rows []*memoryOutboxRow) {
+	for _, row := range rows {
+		row.ID = int64(len(m.outbox) + 1)
+		m.outbox = append(m.outbox, row)
+	}
+}
+
+func (m *Memory) auditRegistration(ctx context.Context, action string, before, after *Registration) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return m.writeAudit(ctx, after.RegistrationID, "registration", after.RegistrationID, action, b, after)
+}
+
+func (m *Memory) auditPayment(ctx context.Context, action string, before, after *Payment) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return m.writeAudit(ctx, after.RegistrationID, "payment", after.PaymentID, action, b, after)
+}
+
+func (m *Memory) auditRefund(ctx context.Context, action string, before, after *Refund) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return m.writeAudit(ctx, after.RegistrationID, "refund", after.RefundID, action, b, after)
+}
+
+func (m *Memory) auditCharge(ctx context.Context, action string, before, after *Charge) error {
+	var b any
+	if before != nil {
+		b = before
+	}
+	return m.writeAudit(ctx, after.RegistrationID, "charge", after.ChargeID, action, b, after)
+}
+
+func (m *Memory) writeAudit(ctx context.Context, registrationID uuid.UUID, entityType string, entityID uuid.UUID, action string, before, after any) error {
+	b, a, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 && len(a) == 0 {
+		return nil
+	}
+	beforeJSON, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit diff: %w", err)
+	}
+	afterJSON, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit diff: %w", err)
+	}
+
+	actor := actorFrom(ctx)
+	m.audit = append(m.audit, &AuditEvent{
+		ID:             int64(len(m.audit) + 1),
+		RegistrationID: registrationID,
+		EntityType:     entityType,
+		EntityID:       entityID,
+		Action:         action,
+		Actor:          actor.ID,
+		Before:         beforeJSON,
+		After:          afterJSON,
+		RequestID:      nonEmpty(actor.RequestID),
+		IP:             nonEmpty(actor.IP),
+		CreatedAt:      m.now(),
+	})
+	return nil
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// newRegistration builds a registration for params, priced by the event's
+// pricing and on the waitlist if ec (which may be nil) has no seat for it.
+func (m *Memory) newRegistration(eventID uuid.UUID, params CreateRegistrationParams, ec *EventCapacity) (*Registration, error) {
+	now := m.now()
+	amountDue, err := m.pricing[eventID].AmountDue(params.Category, params.Gender, now)
+	if err != nil {
+		return nil, err
+	}
+	reg := &Registration{
+		RegistrationID:           params.RegistrationID,
+		EventID:                  eventID,
+		UserID:                   params.UserID,
+		FullName:                 params.FullName,
+		Gender:                   params.Gender,
+		Phone:                    params.Phone,
+		Email:                    params.Email,
+		Address:                  params.Address,
+		EmergencyContactName:     params.EmergencyContactName,
+		EmergencyContactPhone:    params.EmergencyContactPhone,
+		EmergencyContactRelation: params.EmergencyContactRelation,
+		SpecialNeeds:             params.SpecialNeeds,
+		RegistrationDate:         now,
+		Status:                   string(statemachine.Pending),
+		AmountDue:                amountDue,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+	}
+	if reg.RegistrationID == uuid.Nil {
+		reg.RegistrationID = uuid.New()
+	}
+	if params.Category != "" {
+		reg.Category = &params.Category
+	}
+
+	var seatErr error
+	if ec != nil {
+		seatErr = ec.seatAvailable(params.Gender)
+	}
+	switch {
+	case errors.Is(seatErr, ErrEventFull), errors.Is(seatErr, ErrGenderQuotaFull):
+		pos := m.nextWaitlistPosition(eventID)
+		reg.Status = string(statemachine.Waitlisted)
+		reg.WaitlistPosition = &pos
+	default:
+		if ec != nil {
+			ec.takeSeat(params.Gender)
+		}
+		reg.PaymentDueAt = m.paymentDueAt(eventID, now)
+	}
+	setBalance(reg)
+	return reg, nil
+}
+
+func (m *Memory) nextWaitlistPosition(eventID uuid.UUID) int {
+	pos := 0
+	for _, reg := range m.registrations {
+		if reg.EventID == eventID && reg.WaitlistPosition != nil && *reg.WaitlistPosition > pos {
+			pos = *reg.WaitlistPosition
+		}
+	}
+	return pos + 1
+}
+
+func (m *Memory) paymentDueAt(eventID uuid.UUID, from time.Time) *time.Time {
+	hours := m.DefaultPaymentWindowHours
+	if ec := m.capacity[eventID]; ec != nil && ec.PaymentWindowHours != nil {
+		hours = *ec.PaymentWindowHours
+	}
+	due := from.Add(time.Duration(hours) * time.Hour)
+	return &due
+}
+
+// eventCapacity returns a copy of the event's quotas with the seats taken,
+// or nil if none are configured.
+func (m *Memory) eventCapacity(eventID uuid.UUID) *EventCapacity {
+	stored := m.capacity[eventID]
+	if stored == nil {
+		return nil
+	}
+	ec := *stored
+	for _, reg := range m.registrations {
+		if reg.EventID != eventID || !holdsSeat(reg.Status) {
+			continue
+		}
+		ec.takeSeat(reg.Gender)
+	}
+	return &ec
+}
+
+func holdsSeat(status string) bool {
+	for _, s := range seatHoldingStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateRegistration(ctx context.Context, params CreateRegistrationParams, events func(*Registration) []OutboxMessage) (*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reg, rows, err := m.createRegistration(ctx, params, nil, events)
+	if err != nil {
+		return nil, err
+	}
+	m.enqueue(rows)
+	return cloneRegistration(reg), nil
+}
+
+// createRegistration stores a registration for params, in orderID if it is
+// not nil, and returns it with the outbox rows built by events for the
+// caller to enqueue.
+func (m *Memory) createRegistration(ctx context.Context, params CreateRegistrationParams, orderID *uuid.UUID, events func(*Registration) []OutboxMessage) (*Registration, []*memoryOutboxRow, error) {
+	if err := m.checkUnique(params.RegistrationID, params.EventID, params.UserID); err != nil {
+		return nil, nil, err
+	}
+	reg, err := m.newRegistration(params.EventID, params, m.eventCapacity(params.EventID))
+	if err != nil {
+		return nil, nil, err
+	}
+	reg.OrderID = orderID
+	var voucher *Voucher
+	if code := NormalizeVoucherCode(params.VoucherCode); code != "" {
+		if voucher, err = m.applyVoucher(code, reg); err != nil {
+			return nil, nil, err
+		}
+	}
+	m.scheduleInstallments(reg)
+	var rows []*memoryOutboxRow
+	if events != nil {
+		if rows, err = m.outboxRows(events(cloneRegistration(reg))); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := m.auditRegistration(ctx, "registration.created", nil, reg); err != nil {
+		return nil, nil, err
+	}
+	m.registrations = append(m.registrations, reg)
+	if voucher != nil {
+		voucher.UsedCount++
+		voucher.UpdatedAt = m.now()
+		m.redemptions = append(m.redemptions, memoryRedemption{voucherID: voucher.VoucherID, registrationID: reg.RegistrationID, email: reg.Email})
+	}
+	return reg, rows, nil
+}
+
+// applyVoucher checks that reg may redeem the voucher with code, as
+// redeemVoucher does, and takes its discount off reg.AmountDue. The caller
+// counts the use once reg is stored.
+func (m *Memory) applyVoucher(code string, reg *Registration) (*Voucher, error) {
+	var v *Voucher
+	for _, candidate := range m.vouchers {
+		if candidate.Code == code {
+			v = candidate
+		}
+	}
+	if v == nil {
+		return nil, validation.Errors{{Field: "voucher_code", Message: "does not exist"}}
+	}
+	if err := v.checkUsable(reg.EventID, time.Now()); err != nil {
+		return nil, err
+	}
+	if reg.AmountDue == nil {
+		return nil, validation.Errors{{Field: "voucher_code", Message: "cannot be used for an event without pricing"}}
+	}
+	if v.MaxUses != nil && v.UsedCount >= *v.MaxUses {
+		return nil, ErrVoucherExhausted
+	}
+	for _, r := range m.redemptions {
+		if r.voucherID == v.VoucherID && !r.released && strings.EqualFold(r.email, reg.Email) {
+			return nil, ErrVoucherAlreadyUsed
+		}
+	}
+	discount := v.Discount(*reg.AmountDue)
+	due := math.Round((*reg.AmountDue-discount)*100) / 100
+	reg.VoucherCode, reg.DiscountAmount, reg.AmountDue = &v.Code, &discount, &due
+	setBalance(reg)
+	return v, nil
+}
+
+func (m *Memory) GetRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reg := m.findRegistration(registrationID)
+	if reg == nil {
+		return nil, nil
+	}
+	return cloneRegistration(reg), nil
+}
+
+func (m *Memory) UpdateRegistration(ctx context.Context, params UpdateRegistrationParams) (*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reg := m.findRegistration(params.RegistrationID)
+	if reg == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	before := cloneRegistration(reg)
+	set := func(dst *string, v *string) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	setOptional := func(dst **string, v *string) {
+		if v != nil {
+			*dst = v
+		}
+	}
+	set(&reg.FullName, params.FullName)
+	set(&reg.Phone, params.Phone)
+	set(&reg.Email, params.Email)
+	setOptional(&reg.Address, params.Address)
+	setOptional(&reg.EmergencyContactName, params.EmergencyContactName)
+	setOptional(&reg.EmergencyContactPhone, params.EmergencyContactPhone)
+	setOptional(&reg.EmergencyContactRelation, params.EmergencyContactRelation)
+	setOptional(&reg.SpecialNeeds, params.SpecialNeeds)
+	setOptional(&reg.Notes, params.Notes)
+	reg.UpdatedAt = m.now()
+
+	if err := m.auditRegistration(ctx, "registration.updated", before, reg); err != nil {
+		return nil, err
+	}
+	return cloneRegistration(reg), nil
+}
+
+func (m *Memory) CancelRegistration(ctx context.Context, registrationID uuid.UUID, reason string, events ...OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reg := m.findRegistration(registrationID)
+	if reg == nil {
+		return ErrRegistrationNotFound
+	}
+	if err := statemachine.Validate(statemachine.Status(reg.Status), statemachine.Cancelled); err != nil {
+		return err
+	}
+	rows, err := m.outboxRows(events)
+	if err != nil {
+		return err
+	}
+
+	before := cloneRegistration(reg)
+	now := m.now()
+	reg.Status = string(statemachine.Cancelled)
+	reg.WaitlistPosition = nil
+	reg.CancelledAt = &now
+	reg.CancellationReason = &reason
+	reg.UpdatedAt = now
+	if err := m.auditRegistration(ctx, "registration.cancelled", before, reg); err != nil {
+		return err
+	}
+	if err := m.openRefund(ctx, reg); err != nil {
+		return err
+	}
+	m.releaseVoucher(reg)
+	m.enqueue(rows)
+	return m.promoteWaitlisted(ctx, reg.EventID)
+}
+
+// setStatus moves reg to status once the caller has checked the transition.
+// Like updateStatus, leaving the seat-holding statuses promotes the waitlist.
+func (m *Memory) setStatus(ctx context.Context, reg *Registration, status statemachine.Status) error {
+	before := cloneRegistration(reg)
+	reg.Status = string(status)
+	reg.WaitlistPosition = nil
+	reg.UpdatedAt = m.now()
+	if err := m.auditRegistration(ctx, "registration.status_changed", before, reg); err != nil {
+		return err
+	}
+	if status == statemachine.Cancelled {
+		if err := m.openRefund(ctx, reg); err != nil {
+			return err
+		}
+	}
+	if status == statemachine.Cancelled || status == statemachine.Rejected {
+		m.releaseVoucher(reg)
+		return m.promoteWaitlisted(ctx, reg.EventID)
+	}
+	return nil
+}
+
+// releaseVoucher gives back the voucher use of reg, as releaseVouchers does.
+func (m *Memory) releaseVoucher(reg *Registration) {
+	for i := range m.redemptions {
+		r := &m.redemptions[i]
+		if r.registrationID != reg.RegistrationID || r.released {
+			continue
+		}
+		r.released = true
+		for _, v := range m.vouchers {
+			if v.VoucherID == r.voucherID {
+				v.UsedCount--
+				v.UpdatedAt = m.now()
+			}
+		}
+	}
+}
+
+// promoteWaitlisted follows the rules of Postgres.promoteWaitlisted.
+func (m *Memory) promoteWaitlisted(ctx context.Context, eventID uuid.UUID) error {
+	ec := m.eventCapacity(eventID)
+
+	var queue []*Registration
+	for _, reg := range m.registrations {
+		if reg.EventID == eventID && reg.Status == string(statemachine.Waitlisted) {
+			queue = append(queue, reg)
+		}
+	}
+	sort.SliceStable(queue, func(i, j int) bool {
+		pi, pj := 0, 0
+		if queue[i].WaitlistPosition != nil {
+			pi = *queue[i].WaitlistPosition
+		}
+		if queue[j].WaitlistPosition != nil {
+			pj = *queue[j].WaitlistPosition
+		}
+		return pi < pj
+	})
+
+	for _, reg := range queue {
+		if ec != nil {
+			err := ec.seatAvailable(reg.Gender)
+			if err == ErrEventFull {
+				break
+			}
+			if err != nil {
+				continue
+			}
+		}
+
+		before := cloneRegistration(reg)
+		now := m.now()
+		reg.Status = string(statemachine.Pending)
+		reg.WaitlistPosition = nil
+		reg.PaymentDueAt = m.paymentDueAt(eventID, now)
+		reg.UpdatedAt = now
+		m.scheduleInstallments(reg)
+		if err := m.auditRegistration(ctx, "registration.promoted", before, reg); err != nil {
+			return err
+		}
+		if ec != nil {
+			ec.takeSeat(reg.Gender)
+		}
+
+		rows, err := m.outboxRows([]OutboxMessage{registrationPromotedEvent(m.PromotedTopic, reg)})
+		if err != nil {
+			return err
+		}
+		m.enqueue(rows)
+	}
+	return nil
+}
+
+func (m *Memory) ListRegistrations(ctx context.Context, filter RegistrationFilter, page RegistrationPageRequest) (*RegistrationPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sortName := page.Sort
+	if sortName == "" {
+		sortName = defaultRegistrationSort
+	}
+	desc := strings.HasPrefix(sortName, "-")
+	key, ok := registrationSorts[strings.TrimPrefix(sortName, "-")]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	var matches []*Registration
+	for _, reg := range m.registrations {
+		if m.matches(reg, filter) {
+			matches = append(matches, reg)
+		}
+	}
+	// compare orders a before b in the requested direction, ties broken by
+	// registration_id as in the SQL keyset.
+	compare := func(av any, aID uuid.UUID, bv any, bID uuid.UUID) int {
+		c := compareSortValues(av, bv)
+		if c == 0 {
+			c = bytes.Compare(aID[:], bID[:])
+		}
+		if desc {
+			c = -c
+		}
+		return c
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return compare(key.value(matches[i]), matches[i].RegistrationID, key.value(matches[j]), matches[j].RegistrationID) < 0
+	})
+	total := int64(len(matches))
+
+	if page.Cursor != "" {
+		c, err := decodeCursor(page.Cursor)
+		if err != nil || c.Sort != sortName {
+			return nil, ErrInvalidCursor
+		}
+		var value any = c.Value
+		if _, isTime := key.value(&Registration{}).(time.Time); isTime {
+			t, err := time.Parse(time.RFC3339Nano, c.Value)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			value = t
+		}
+		i := sort.Search(len(matches), func(i int) bool {
+			return compare(key.value(matches[i]), matches[i].RegistrationID, value, c.ID) > 0
+		})
+		matches = matches[i:]
+	}
+
+	result := &RegistrationPage{Items: []*Registration{}, Total: total}
+	for i, reg := range matches {
+		if i == page.Limit {
+			last := result.Items[page.Limit-1]
+			next := encodeCursor(cursor{Sort: sortName, Value: cursorValue(key.value(last)), ID: last.RegistrationID})
+			result.NextCursor = &next
+			break
+		}
+		result.Items = append(result.Items, cloneRegistration(reg))
+	}
+	return result, nil
+}
+
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// ownedBy reports whether reg belongs to userID or was paid for by them as
+// the payer of an order.
+func (m *Memory) ownedBy(reg *Registration, userID uuid.UUID) bool {
+	if reg.UserID != nil && *reg.UserID == userID {
+		return true
+	}
+	if reg.OrderID == nil {
+		return false
+	}
+	order := m.findOrder(*reg.OrderID)
+	return order != nil && order.PayerUserID != nil && *order.PayerUserID == userID
+}
+
+func (m *Memory) matches(reg *Registration, f RegistrationFilter) bool {
+	switch {
+	case f.EventID != nil && reg.EventID != *f.EventID:
+		return false
+	case f.UserID != nil && (reg.UserID == nil || *reg.UserID != *f.UserID):
+		return false
+	case f.OwnerID != nil && !m.ownedBy(reg, *f.OwnerID):
+		return false
+	case len(f.Statuses) > 0 && !containsString(f.Statuses, reg.Status):
+		return false
+	case f.Gender != "" && reg.Gender != f.Gender:
+		return false
+	case f.RegisteredFrom != nil && reg.RegistrationDate.Before(*f.RegisteredFrom):
+		return false
+	case f.RegisteredTo != nil && !reg.RegistrationDate.Before(*f.RegisteredTo):
+		return false
+	}
+	if f.PaymentStatus == "" {
+		return true
+	}
+	latest := m.latestPayment(reg.RegistrationID)
+	if f.PaymentStatus == PaymentStatusNone {
+		return latest == nil
+	}
+	return latest != nil && latest.VerificationStatus == f.PaymentStatus
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchRegistrations matches case-insensitive substrings of the name and
+// email and digits of the normalized phone number. The ranking is a rough
+// stand-in for the full-text and trigram scores Postgres computes: exact
+// matches first, then prefixes, then other substrings.
+func (m *Memory) SearchRegistrations(ctx context.Context, params RegistrationSearchParams) ([]*RegistrationSearchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q := strings.ToLower(strings.TrimSpace(params.Query))
+	phone := searchPhone(q)
+	results := []*RegistrationSearchResult{}
+	for _, reg := range m.registrations {
+		if params.EventID != nil && reg.EventID != *params.EventID {
+			continue
+		}
+		rank := textRank(strings.ToLower(reg.FullName), q) + textRank(strings.ToLower(reg.Email), q)
+		if phone != "" {
+			rank += textRank(normalizePhone(reg.Phone), phone)
+		}
+		if rank > 0 {
+			results = append(results, &RegistrationSearchResult{Registration: cloneRegistration(reg), Rank: rank})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if a.FullName != b.FullName {
+			return a.FullName < b.FullName
+		}
+		return bytes.Compare(a.RegistrationID[:], b.RegistrationID[:]) < 0
+	})
+	if params.Limit > 0 && len(results) > params.Limit {
+		results = results[:params.Limit]
+	}
+	return results, nil
+}
+
+func textRank(s, q string) float64 {
+	switch {
+	case q == "":
+		return 0
+	case s == q:
+		return 1
+	case strings.HasPrefix(s, q):
+		return 0.75
+	case strings.Contains(s, q):
+		return 0.5
+	}
+	return 0
+}
+
+// normalizePhone is the Go form of the normalize_phone_id SQL function.
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	d := b.String()
+	switch {
+	case strings.HasPrefix(d, "62"):
+		return d
+	case strings.HasPrefix(d, "0"):
+		return "62" + d[1:]
+	case strings.HasPrefix(d, "8"):
+		return "62" + d
+	}
+	return d
+}
+
+func (m *Memory) ListAuditEvents(ctx context.Context, registrationID uuid.UUID) ([]*AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*AuditEvent{}
+	for _, e := range m.audit {
+		if e.RegistrationID == registrationID {
+			c := *e
+			events = append(events, &c)
+		}
+	}
+	return events, nil
+}
+
+func (m *Memory) latestPayment(registrationID uuid.UUID) *Payment {
+	for i := len(m.payments) - 1; i >= 0; i-- {
+		if m.payments[i].RegistrationID == registrationID {
+			return m.payments[i]
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreatePayment(ctx context.Context, params CreatePaymentParams, events ...OutboxMessage) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reg := m.findRegistration(params.RegistrationID)
+	if reg == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	if err := checkPayable(reg); err != nil {
+		return nil, err
+	}
+	if reg.OrderID != nil {
+		return nil, ErrPaidByOrder
+	}
+	rows, err := m.outboxRows(events)
+	if err != nil {
+		return nil, err
+	}
+	payment, err := m.addPayment(ctx, reg, m.newPayment(params, nil, reg.PaymentAmountStatus(params.Amount)))
+	if err != nil {
+		return nil, err
+	}
+	m.enqueue(rows)
+	return clonePayment(payment), nil
+}
+
+// newPayment builds the pending payment insertPayment would store.
+func (m *Memory) newPayment(params CreatePaymentParams, orderID *uuid.UUID, amountStatus *string) *Payment {
+	now := m.now()
+	payment := &Payment{
+		PaymentID:            params.PaymentID,
+		RegistrationID:       params.RegistrationID,
+		Amount:               params.Amount,
+		AmountStatus:         amountStatus,
+		PaymentMethod:        params.PaymentMethod,
+		PaymentDate:          now,
+		PaymentProofURL:      params.PaymentProofURL,
+		PaymentProofFilename: params.PaymentProofFilename,
+		BankName:             params.BankName,
+		AccountNumber:        params.AccountNumber,
+		AccountHolderName:    params.AccountHolderName,
+		VerificationStatus:   "pending",
+		OrderID:              orderID,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+	if payment.PaymentID == uuid.Nil {
+		payment.PaymentID = uuid.New()
+	}
+	if payment.PaymentMethod == "" {
+		payment.PaymentMethod = "bank_transfer"
+	}
+	return payment
+}
+
+// addPayment marks reg paid and stores payment for it, superseding its
+// pending payments as insertPayment does.
+func (m *Memory) addPayment(ctx context.Context, reg *Registration, payment *Payment) (*Payment, error) {
+	if err := m.setStatus(ctx, reg, statemachine.Paid); err != nil {
+		return nil, err
+	}
+	for _, p := range m.payments {
+		if p.RegistrationID != reg.RegistrationID || p.VerificationStatus != "pending" {
+			continue
+		}
+		before := clonePayment(p)
+		p.VerificationStatus = "superseded"
+		p.UpdatedAt = m.now()
+		if err := m.auditPayment(ctx, "payment.superseded", before, p); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.auditPayment(ctx, "payment.created", nil, payment); err != nil {
+		return nil, err
+	}
+	m.payments = append(m.payments, payment)
+	return payment, nil
+}
+
+func (m *Memory) GetLatestPaymentByRegistrationID(ctx context.Context, registrationID uuid.UUID) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p := m.latestPayment(registrationID); p != nil {
+		return clonePayment(p), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) ListPaymentsByRegistrationID(ctx context.Context, registrationID uuid.UUID) ([]*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var payments []*Payment
+	for i := len(m.payments) - 1; i >= 0; i-- {
+		if m.payments[i].RegistrationID == registrationID {
+			payments = append(payments, clonePayment(m.payments[i]))
+		}
+	}
+	return payments, nil
+}
+
+func (m *Memory) VerifyPayment(ctx context.Context, params VerifyPaymentParams, events func(*Payment, *Registration) []OutboxMessage) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var payment *Payment
+	for _, p := range m.payments {
+		if p.PaymentID == params.PaymentID && p.RegistrationID == params.RegistrationID && p.VerificationStatus == "pending" {
+			payment = p
+		}
+	}
+	if payment == nil {
+		return nil, ErrNoPendingPayment
+	}
+	reg := m.findRegistration(params.RegistrationID)
+	if reg == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	verified, settled, err := m.decide(payment, reg, params)
+	if err != nil {
+		return nil, err
+	}
+	if payment.OrderID != nil {
+		return nil, ErrPaidByOrder
+	}
+	var rows []*memoryOutboxRow
+	if events != nil {
+		if rows, err = m.outboxRows(events(clonePayment(verified), cloneRegistration(settled))); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.verifyPayment(ctx, payment, verified, reg, settled); err != nil {
+		return nil, err
+	}
+	m.enqueue(rows)
+	return clonePayment(payment), nil
+}
+
+// decide returns payment and reg as the decision in params leaves them,
+// without changing either, so that the transition can be checked and events
+// encoded first. An approved amount is credited to reg and its status is
+// settled as in Postgres.
+func (m *Memory) decide(payment *Payment, reg *Registration, params VerifyPaymentParams) (*Payment, *Registration, error) {
+	now := m.now()
+	verified := clonePayment(payment)
+	verified.VerificationStatus = "rejected"
+	if params.Approved {
+		verified.VerificationStatus = "approved"
+	}
+	verified.VerifiedBy = params.VerifiedBy
+	verified.VerifiedAt = &now
+	verified.VerificationNotes = params.VerificationNotes
+	verified.RejectionReason = params.RejectionReason
+	verified.UpdatedAt = now
+
+	settled := cloneRegistration(reg)
+	if params.Approved {
+		settled.AmountPaid, settled.PaymentDueAt = reg.credit(payment.Amount)
+		setBalance(settled)
+	}
+	if status := settledStatus(settled, params.RegistrationStatus); string(status) != reg.Status {
+		if err := statemachine.Validate(statemachine.Status(reg.Status), status); err != nil {
+			return nil, nil, err
+		}
+		settled.Status = string(status)
+	}
+	if settled.lapsed(now) {
+		settled.PaymentDueAt = m.paymentDueAt(reg.EventID, now)
+	}
+	return verified, settled, nil
+}
+
+// verifyPayment stores the decision decide returned for payment and reg.
+func (m *Memory) verifyPayment(ctx context.Context, payment, verified *Payment, reg, settled *Registration) error {
+	before := clonePayment(payment)
+	*payment = *verified
+	if err := m.auditPayment(ctx, "payment.verified", before, payment); err != nil {
+		return err
+	}
+	if verified.VerificationStatus == "approved" {
+		before := cloneRegistration(reg)
+		_, dueAt := reg.credit(payment.Amount)
+		reg.AmountPaid, reg.Balance, reg.PaymentDueAt = settled.AmountPaid, settled.Balance, dueAt
+		reg.UpdatedAt = m.now()
+		if err := m.auditRegistration(ctx, "registration.payment_credited", before, reg); err != nil {
+			return err
+		}
+	}
+	if settled.Status != reg.Status {
+		if err := m.setStatus(ctx, reg, statemachine.Status(settled.Status)); err != nil {
+			return err
+		}
+	}
+	if !sameTime(settled.PaymentDueAt, reg.PaymentDueAt) {
+		before := cloneRegistration(reg)
+		reg.PaymentDueAt = settled.PaymentDueAt
+		reg.UpdatedAt = m.now()
+		return m.auditRegistration(ctx, "registration.payment_window_reopened", before, reg)
+	}
+	return nil
+}
+
+// sameTime reports whether a and b are both nil or the same instant.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func cloneCharge(c *Charge) *Charge {
+	cp := *c
+	return &cp
+}
+
+func (m *Memory) CreateCharge(ctx context.Context, params CreateChargeParams) (*Charge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reg := m.findRegistration(params.RegistrationID)
+	if reg == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	if err := checkPayable(reg); err != nil {
+		return nil, err
+	}
+	if reg.OrderID != nil {
+		return nil, ErrPaidByOrder
+	}
+	for _, c := range m.charges {
+		if c.Provider == params.Provider && c.ProviderChargeID == params.ProviderChargeID {
+			return nil, uniqueViolation("unique_provider_charge")
+		}
+	}
+
+	now := m.now()
+	charge := &Charge{
+		ChargeID:         params.ChargeID,
+		RegistrationID:   params.RegistrationID,
+		Provider:         params.Provider,
+		ProviderChargeID: params.ProviderChargeID,
+		PaymentMethod:    params.PaymentMethod,
+		Amount:           params.Amount,
+		PaymentCode:      params.PaymentCode,
+		Status:           "pending",
+		ExpiresAt:        memoryTime(params.ExpiresAt),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := m.auditCharge(ctx, "charge.created", nil, charge); err != nil {
+		return nil, err
+	}
+	m.charges = append(m.charges, charge)
+	return cloneCharge(charge), nil
+}
+
+func (m *Memory) ListChargesByRegistrationID(ctx context.Context, registrationID uuid.UUID) ([]*Charge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var charges []*Charge
+	for i := len(m.charges) - 1; i >= 0; i-- {
+		if m.charges[i].RegistrationID == registrationID {
+			charges = append(charges, cloneCharge(m.charges[i]))
+		}
+	}
+	return charges, nil
+}
+
+func (m *Memory) ApplyChargeWebhook(ctx context.Context, params ChargeWebhookParams, events func(*Payment, *Registration) []OutboxMessage) (*Charge, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var charge *Charge
+	for _, c := range m.charges {
+		if c.Provider == params.Provider && c.ProviderChargeID == params.ProviderChargeID {
+			charge = c
+		}
+	}
+	if charge == nil {
+		return nil, false, ErrChargeNotFound
+	}
+	key := memoryWebhookKey{params.Provider, params.EventID}
+	if m.webhooks[key] || charge.Status != "pending" {
+		m.webhooks[key] = true
+		return cloneCharge(charge), false, nil
+	}
+
+	// Decide everything before changing anything, as a rolled back
+	// transaction would leave no trace
+	var payment, verified *Payment
+	var reg, settled *Registration
+	var rows []*memoryOutboxRow
+	var refused bool
+	if params.Status == "paid" {
+		if reg = m.findRegistration(charge.RegistrationID); reg == nil {
+			return nil, false, ErrRegistrationNotFound
+		}
+		create := CreatePaymentParams{
+			RegistrationID: charge.RegistrationID,
+			Amount:         params.Amount,
+			PaymentMethod:  charge.PaymentMethod,
+		}
+		var err error
+		if refused = checkPayable(reg) != nil; refused {
+			payment = m.newPayment(create, nil, nil)
+			verified, settled, err = m.decide(payment, reg, chargeRefusal(charge, payment, reg))
+		} else {
+			payment = m.newPayment(create, nil, reg.PaymentAmountStatus(params.Amount))
+			paid := cloneRegistration(reg)
+			paid.Status = string(statemachine.Paid)
+			verified, settled, err = m.decide(payment, paid, chargeApproval(charge, payment))
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if events != nil {
+			if rows, err = m.outboxRows(events(clonePayment(verified), cloneRegistration(settled))); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	switch {
+	case refused:
+		if err := m.auditPayment(ctx, "payment.created", nil, payment); err != nil {
+			return nil, false, err
+		}
+		m.payments = append(m.payments, payment)
+		if err := m.verifyPayment(ctx, payment, verified, reg, settled); err != nil {
+			return nil, false, err
+		}
+		if err := m.refundPayment(ctx, payment, reg.EventID); err != nil {
+			return nil, false, err
+		}
+	case payment != nil:
+		if _, err := m.addPayment(ctx, reg, payment); err != nil {
+			return nil, false, err
+		}
+		if err := m.verifyPayment(ctx, payment, verified, reg, settled); err != nil {
+			return nil, false, err
+		}
+	}
+	before := cloneCharge(charge)
+	charge.Status = params.Status
+	charge.PaymentID = paymentID(payment)
+	charge.PaidAt = memoryTime(params.PaidAt)
+	charge.UpdatedAt = m.now()
+	if err := m.auditCharge(ctx, "charge."+params.Status, before, charge); err != nil {
+		return nil, false, err
+	}
+	m.webhooks[key] = true
+	m.enqueue(rows)
+	return cloneCharge(charge), true, nil
+}
+
+// openRefund follows the rules of the Postgres openRefund.
+func (m *Memory) openRefund(ctx context.Context, reg *Registration) error {
+	var payment *Payment
+	for i := len(m.payments) - 1; i >= 0 && payment == nil; i-- {
+		if p := m.payments[i]; p.RegistrationID == reg.RegistrationID && p.VerificationStatus == "approved" {
+			payment = p
+		}
+	}
+	if payment == nil {
+		return nil
+	}
+	percent := m.policies[reg.EventID].PercentAt(time.Now())
+	if percent <= 0 || refundAmount(reg.AmountPaid, percent) <= 0 {
+		return nil
+	}
+	for _, r := range m.refunds {
+		if r.PaymentID == payment.PaymentID {
+			return nil
+		}
+	}
+
+	now := m.now()
+	refund := &Refund{
+		RefundID:       uuid.New(),
+		PaymentID:      payment.PaymentID,
+		RegistrationID: reg.RegistrationID,
+		EventID:        reg.EventID,
+		Amount:         refundAmount(reg.AmountPaid, percent),
+		Percent:        percent,
+		RefundType:     refundType(percent),
+		Status:         "pending",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := m.auditRefund(ctx, "refund.created", nil, refund); err != nil {
+		return err
+	}
+	m.refunds = append(m.refunds, refund)
+	return nil
+}
+
+// refundPayment follows the rules of the Postgres refundPayment.
+func (m *Memory) refundPayment(ctx context.Context, payment *Payment, eventID uuid.UUID) error {
+	now := m.now()
+	refund := &Refund{
+		RefundID:       uuid.New(),
+		PaymentID:      payment.PaymentID,
+		RegistrationID: payment.RegistrationID,
+		EventID:        eventID,
+		Amount:         payment.Amount,
+		Percent:        100,
+		RefundType:     refundType(100),
+		Status:         "pending",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := m.auditRefund(ctx, "refund.created", nil, refund); err != nil {
+		return err
+	}
+	m.refunds = append(m.refunds, refund)
+	return nil
+}
+
+func (m *Memory) GetRefundByRegistrationID(ctx context.Context, registrationID uuid.UUID) (*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.refunds) - 1; i >= 0; i-- {
+		if m.refunds[i].RegistrationID == registrationID {
+			return cloneRefund(m.refunds[i]), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) ListRefunds(ctx context.Context, filter RefundFilter) ([]*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refunds := []*Refund{}
+	for _, r := range m.refunds {
+		if len(refunds) == filter.Limit {
+			break
+		}
+		if r.EventID == filter.EventID && (filter.Status == "" || r.Status == filter.Status) {
+			refunds = append(refunds, cloneRefund(r))
+		}
+	}
+	return refunds, nil
+}
+
+func (m *Memory) ProcessRefund(ctx context.Context, params ProcessRefundParams, events ...OutboxMessage) (*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var refund *Refund
+	for _, r := range m.refunds {
+		if r.RefundID == params.RefundID && r.RegistrationID == params.RegistrationID && r.Status == "pending" {
+			refund = r
+		}
+	}
+	if refund == nil {
+		return nil, ErrNoPendingRefund
+	}
+	rows, err := m.outboxRows(events)
+	if err != nil {
+		return nil, err
+	}
+
+	before := cloneRefund(refund)
+	now := m.now()
+	refund.Status = "processed"
+	refund.RefundProofURL = params.RefundProofURL
+	refund.RefundProofFilename = params.RefundProofFilename
+	refund.Notes = params.Notes
+	refund.ProcessedBy = params.ProcessedBy
+	refund.ProcessedAt = &now
+	refund.UpdatedAt = now
+	if err := m.auditRefund(ctx, "refund.processed", before, refund); err != nil {
+		return nil, err
+	}
+	m.enqueue(rows)
+	return cloneRefund(refund), nil
+}
+
+func (m *Memory) GetRefundPolicy(ctx context.Context, eventID uuid.UUID) (*RefundPolicy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.policies[eventID]
+	if !ok {
+		return nil, nil
+	}
+	c := *p
+	c.Rules = append([]RefundRule{}, p.Rules...)
+	return &c, nil
+}
+
+func (m *Memory) UpsertRefundPolicy(ctx context.Context, params UpsertRefundPolicyParams) (*RefundPolicy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := &RefundPolicy{
+		EventID:       params.EventID,
+		EventStartsAt: params.EventStartsAt.UTC().Truncate(time.Microsecond),
+		Rules:         append([]RefundRule{}, params.Rules...),
+		UpdatedAt:     m.now(),
+	}
+	m.policies[params.EventID] = p
+	c := *p
+	c.Rules = append([]RefundRule{}, p.Rules...)
+	return &c, nil
+}
+
+func (m *Memory) GetEventPricing(ctx context.Context, eventID uuid.UUID) (*EventPricing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.pricing[eventID]
+	if !ok {
+		return nil, nil
+	}
+	return clonePricing(p), nil
+}
+
+func (m *Memory) UpsertEventPricing(ctx context.Context, params UpsertEventPricingParams) (*EventPricing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := &EventPricing{
+		EventID:      params.EventID,
+		BasePrice:    params.BasePrice,
+		MalePrice:    params.MalePrice,
+		FemalePrice:  params.FemalePrice,
+		Categories:   append([]CategoryPrice{}, params.Categories...),
+		EarlyBird:    append([]EarlyBirdWindow{}, params.EarlyBird...),
+		Installments: append([]InstallmentRule{}, params.Installments...),
+		UpdatedAt:    m.now(),
+	}
+	for i := range p.EarlyBird {
+		p.EarlyBird[i].EndsAt = p.EarlyBird[i].EndsAt.UTC().Truncate(time.Microsecond)
+	}
+	m.pricing[params.EventID] = p
+	return clonePricing(p), nil
+}
+
+func clonePricing(p *EventPricing) *EventPricing {
+	c := *p
+	c.Categories = append([]CategoryPrice{}, p.Categories...)
+	c.EarlyBird = append([]EarlyBirdWindow{}, p.EarlyBird...)
+	c.Installments = append([]InstallmentRule{}, p.Installments...)
+	return &c
+}
+
+func (m *Memory) CreateVoucher(ctx context.Context, params CreateVoucherParams) (*Voucher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.vouchers {
+		if v.Code == params.Code {
+			return nil, uniqueViolation("unique_voucher_code")
+		}
+	}
+	now := m.now()
+	v := &Voucher{
+		VoucherID:     uuid.New(),
+		Code:          params.Code,
+		EventID:       params.EventID,
+		DiscountType:  params.DiscountType,
+		DiscountValue: params.DiscountValue,
+		MaxUses:       params.MaxUses,
+		ValidFrom:     memoryTime(params.ValidFrom),
+		ValidUntil:    memoryTime(params.ValidUntil),
+		Active:        true,
+		Description:   params.Description,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	m.vouchers = append(m.vouchers, v)
+	return cloneVoucher(v), nil
+}
+
+func (m *Memory) GetVoucher(ctx context.Context, voucherID uuid.UUID) (*Voucher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.vouchers {
+		if v.VoucherID == voucherID {
+			return cloneVoucher(v), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) ListVouchers(ctx context.Context, filter VoucherFilter) ([]*Voucher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vouchers := []*Voucher{}
+	for i := len(m.vouchers) - 1; i >= 0 && len(vouchers) < filter.Limit; i-- {
+		v := m.vouchers[i]
+		if filter.EventID == nil || v.EventID == nil || *v.EventID == *filter.EventID {
+			vouchers = append(vouchers, cloneVoucher(v))
+		}
+	}
+	return vouchers, nil
+}
+
+func (m *Memory) UpdateVoucher(ctx context.Context, params UpdateVoucherParams) (*Voucher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.vouchers {
+		if v.VoucherID != params.VoucherID {
+			continue
+		}
+		if params.MaxUses != nil && *params.MaxUses < v.UsedCount {
+			return nil, checkViolation("voucher_usage_limit")
+		}
+		from, until := v.ValidFrom, v.ValidUntil
+		if params.ValidFrom != nil {
+			from = params.ValidFrom
+		}
+		if params.ValidUntil != nil {
+			until = params.ValidUntil
+		}
+		if from != nil && until != nil && !until.After(*from) {
+			return nil, checkViolation("voucher_validity")
+		}
+		if params.Active != nil {
+			v.Active = *params.Active
+		}
+		if params.MaxUses != nil {
+			v.MaxUses = params.MaxUses
+		}
+		if params.ValidFrom != nil {
+			v.ValidFrom = memoryTime(params.ValidFrom)
+		}
+		if params.ValidUntil != nil {
+			v.ValidUntil = memoryTime(params.ValidUntil)
+		}
+		if params.Description != nil {
+			v.Description = params.Description
+		}
+		v.UpdatedAt = m.now()
+		return cloneVoucher(v), nil
+	}
+	return nil, ErrVoucherNotFound
+}
+
+func cloneVoucher(v *Voucher) *Voucher {
+	c := *v
+	return &c
+}
+
+// memoryTime stores an optional timestamp at database precision.
+func memoryTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC().Truncate(time.Microsecond)
+	return &u
+}
+
+// memorySavepoint is the state createRegistration changes, so that an order
+// can undo the members it already added when a later one is refused, as a
+// rolled back transaction would.
+type memorySavepoint struct {
+	registrations, audit, redemptions int
+	vouchers                          []Voucher
+}
+
+func (m *Memory) savepoint() memorySavepoint {
+	sp := memorySavepoint{registrations: len(m.registrations), audit: len(m.audit), redemptions: len(m.redemptions)}
+	for _, v := range m.vouchers {
+		sp.vouchers = append(sp.vouchers, *v)
+	}
+	return sp
+}
+
+func (m *Memory) rollbackTo(sp memorySavepoint) {
+	m.registrations = m.registrations[:sp.registrations]
+	m.audit = m.audit[:sp.audit]
+	m.redemptions = m.redemptions[:sp.redemptions]
+	for i, v := range sp.vouchers {
+		*m.vouchers[i] = v
+	}
+}
+
+func (m *Memory) findOrder(id uuid.UUID) *Order {
+	for _, o := range m.orders {
+		if o.OrderID == id {
+			return o
+		}
+	}
+	return nil
+}
+
+// order returns a copy of o with its members, as getOrder does.
+func (m *Memory) order(o *Order) *Order {
+	c := *o
+	c.Registrations = nil
+	for _, reg := range m.registrations {
+		if reg.OrderID != nil && *reg.OrderID == o.OrderID {
+			c.Registrations = append(c.Registrations, cloneRegistration(reg))
+		}
+	}
+	c.AmountDue = c.amountDue()
+	return &c
+}
+
+func (m *Memory) CreateOrder(ctx context.Context, params CreateOrderParams, events func(*Registration) []OutboxMessage) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if params.OrderID != uuid.Nil && m.findOrder(params.OrderID) != nil {
+		return nil, uniqueViolation("orders_pkey")
+	}
+	now := m.now()
+	order := &Order{
+		OrderID:     params.OrderID,
+		EventID:     params.EventID,
+		PayerUserID: params.PayerUserID,
+		PayerName:   params.PayerName,
+		PayerEmail:  params.PayerEmail,
+		PayerPhone:  params.PayerPhone,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if order.OrderID == uuid.Nil {
+		order.OrderID = uuid.New()
+	}
+
+	sp := m.savepoint()
+	var rows []*memoryOutboxRow
+	for i, member := range params.Members {
+		member.EventID = params.EventID
+		_, memberRows, err := m.createRegistration(ctx, member, &order.OrderID, events)
+		if err != nil {
+			m.rollbackTo(sp)
+			return nil, memberError(i, err)
+		}
+		rows = append(rows, memberRows...)
+	}
+	m.orders = append(m.orders, order)
+	m.enqueue(rows)
+	return m.order(order), nil
+}
+
+func (m *Memory) GetOrder(ctx context.Context, orderID uuid.UUID) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if o := m.findOrder(orderID); o != nil {
+		return m.order(o), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) CreateOrderPayment(ctx context.Context, params CreateOrderPaymentParams, events func(*Payment) []OutboxMessage) ([]*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o := m.findOrder(params.OrderID)
+	if o == nil {
+		return nil, ErrOrderNotFound
+	}
+	order := m.order(o)
+	members := order.payableMembers()
+	if len(members) == 0 {
+		return nil, ErrNothingToPay
+	}
+	amountStatus := AmountStatus(params.Amount, order.AmountDue)
+	shares := splitAmount(params.Amount, members)
+
+	// Build every payment and its events before changing anything
+	payments := make([]*Payment, len(members))
+	var rows []*memoryOutboxRow
+	for i, member := range members {
+		payments[i] = m.newPayment(CreatePaymentParams{
+			RegistrationID:       member.RegistrationID,
+			Amount:               shares[i],
+			PaymentMethod:        params.PaymentMethod,
+			PaymentProofURL:      params.PaymentProofURL,
+			PaymentProofFilename: params.PaymentProofFilename,
+			BankName:             params.BankName,
+			AccountNumber:        params.AccountNumber,
+			AccountHolderName:    params.AccountHolderName,
+		}, &o.OrderID, amountStatus)
+		if events != nil {
+			memberRows, err := m.outboxRows(events(clonePayment(payments[i])))
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, memberRows...)
+		}
+	}
+	result := make([]*Payment, len(payments))
+	for i, payment := range payments {
+		if _, err := m.addPayment(ctx, m.findRegistration(payment.RegistrationID), payment); err != nil {
+			return nil, err
+		}
+		result[i] = clonePayment(payment)
+	}
+	m.enqueue(rows)
+	return result, nil
+}
+
+func (m *Memory) VerifyOrderPayment(ctx context.Context, params VerifyOrderPaymentParams, events func(*Payment, *Registration) []OutboxMessage) ([]*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o := m.findOrder(params.OrderID)
+	if o == nil {
+		return nil, ErrOrderNotFound
+	}
+	verify := VerifyPaymentParams{
+		Approved:           params.Approved,
+		VerifiedBy:         params.VerifiedBy,
+		VerificationNotes:  params.VerificationNotes,
+		RejectionReason:    params.RejectionReason,
+		RegistrationStatus: params.RegistrationStatus,
+	}
+	// Only a member's latest upload is verified, as in Postgres. Every
+	// decision is made and its events encoded before changing anything.
+	var pending, verified []*Payment
+	var members, settled []*Registration
+	var rows []*memoryOutboxRow
+	for _, reg := range m.registrations {
+		if reg.OrderID == nil || *reg.OrderID != o.OrderID {
+			continue
+		}
+		p := m.latestPayment(reg.RegistrationID)
+		if p == nil || p.VerificationStatus != "pending" || p.OrderID == nil || *p.OrderID != o.OrderID {
+			continue
+		}
+		after, afterReg, err := m.decide(p, reg, verify)
+		if err != nil {
+			return nil, err
+		}
+		if events != nil {
+			memberRows, err := m.outboxRows(events(clonePayment(after), cloneRegistration(afterReg)))
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, memberRows...)
+		}
+		pending, verified = append(pending, p), append(verified, after)
+		members, settled = append(members, reg), append(settled, afterReg)
+	}
+	if len(pending) == 0 {
+		return nil, ErrNoPendingPayment
+	}
+
+	result := make([]*Payment, len(pending))
+	for i, p := range pending {
+		if err := m.verifyPayment(ctx, p, verified[i], members[i], settled[i]); err != nil {
+			return nil, err
+		}
+		result[i] = clonePayment(p)
+	}
+	m.enqueue(rows)
+	return result, nil
+}
+
+func (m *Memory) GetEventCapacity(ctx context.Context, eventID uuid.UUID) (*EventCapacity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.eventCapacity(eventID), nil
+}
+
+func (m *Memory) UpsertEventCapacity(ctx context.Context, params UpsertEventCapacityParams) (*EventCapacity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.capacity[params.EventID] = &EventCapacity{
+		EventID:            params.EventID,
+		TotalQuota:         params.TotalQuota,
+		MaleQuota:          params.MaleQuota,
+		FemaleQuota:        params.FemaleQuota,
+		PaymentWindowHours: params.PaymentWindowHours,
+		UpdatedAt:          m.now(),
+	}
+	if err := m.promoteWaitlisted(ctx, params.EventID); err != nil {
+		return nil, err
+	}
+	return m.eventCapacity(params.EventID), nil
+}
+
+func (m *Memory) EachEventRegistration(ctx context.Context, eventID uuid.UUID, fn func(*RegistrationExportRow) error) error {
+	// Snapshot first so fn runs without holding the lock
+	m.mu.Lock()
+	var rows []*RegistrationExportRow
+	for _, reg := range m.registrations {
+		if reg.EventID != eventID {
+			continue
+		}
+		row := &RegistrationExportRow{Registration: cloneRegistration(reg)}
+		if p := m.latestPayment(reg.RegistrationID); p != nil {
+			status, amount, method, date := p.VerificationStatus, p.Amount, p.PaymentMethod, p.PaymentDate
+			row.PaymentStatus, row.PaymentAmount, row.PaymentMethod, row.PaymentDate = &status, &amount, &method, &date
+			row.VerifiedAt = p.VerifiedAt
+		}
+		rows = append(rows, row)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if !a.RegistrationDate.Equal(b.RegistrationDate) {
+			return a.RegistrationDate.Before(b.RegistrationDate)
+		}
+		return bytes.Compare(a.RegistrationID[:], b.RegistrationID[:]) < 0
+	})
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RegisteredUserIDs(ctx context.Context, eventID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := make(map[uuid.UUID]bool)
+	for _, id := range userIDs {
+		for _, reg := range m.registrations {
+			if reg.EventID == eventID && reg.UserID != nil && *reg.UserID == id {
+				found[id] = true
+			}
+		}
+	}
+	return found, nil
+}
+
+func (m *Memory) ImportRegistrations(ctx context.Context, eventID uuid.UUID, params []CreateRegistrationParams, events func(*Registration) []OutboxMessage) ([]*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Nothing is stored until every row has passed, as in one transaction
+	saved := len(m.registrations)
+	ec := m.eventCapacity(eventID)
+	regs := make([]*Registration, 0, len(params))
+	var rows []*memoryOutboxRow
+	for _, p := range params {
+		if err := m.checkUnique(p.RegistrationID, eventID, p.UserID); err != nil {
+			m.registrations = m.registrations[:saved]
+			return nil, err
+		}
+		reg, err := m.newRegistration(eventID, p, ec)
+		if err != nil {
+			m.registrations = m.registrations[:saved]
+			return nil, err
+		}
+		m.scheduleInstallments(reg)
+		// Appended right away so later rows see its waitlist position and user_id
+		m.registrations = append(m.registrations, reg)
+		regs = append(regs, reg)
+		if events != nil {
+			msgs, err := m.outboxRows(events(cloneRegistration(reg)))
+			if err != nil {
+				m.registrations = m.registrations[:saved]
+				return nil, err
+			}
+			rows = append(rows, msgs...)
+		}
+	}
+
+	out := make([]*Registration, len(regs))
+	for i, reg := range regs {
+		if err := m.auditRegistration(ctx, "registration.imported", nil, reg); err != nil {
+			return nil, err
+		}
+		out[i] = cloneRegistration(reg)
+	}
+	m.enqueue(rows)
+	return out, nil
+}
+
+func (m *Memory) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, ttl, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if rec, ok := m.idempotency[key]; ok {
+		stale := rec.CompletedAt == nil && rec.lockedUntil.Before(now)
+		if rec.createdAt.After(now.Add(-ttl)) && !stale {
+			c := rec.IdempotencyRecord
+			return &c, false, nil
+		}
+		delete(m.idempotency, key)
+	}
+	m.idempotency[key] = &memoryIdempotencyKey{
+		IdempotencyRecord: IdempotencyRecord{Key: key, RequestHash: requestHash},
+		createdAt:         now,
+		lockedUntil:       now.Add(lease),
+	}
+	return nil, true, nil
+}
+
+func (m *Memory) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.idempotency[key]
+	if !ok {
+		return nil
+	}
+	now := m.now()
+	rec.StatusCode = &statusCode
+	rec.ContentType = &contentType
+	rec.ResponseBody = append([]byte(nil), body...)
+	rec.CompletedAt = &now
+	return nil
+}
+
+func (m *Memory) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rec, ok := m.idempotency[key]; ok && rec.CompletedAt == nil {
+		delete(m.idempotency, key)
+	}
+	return nil
+}
+
+func (m *Memory) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	cutoff := m.now().Add(-ttl)
+	for key, rec := range m.idempotency {
+		if n < limit && rec.createdAt.Before(cutoff) {
+			delete(m.idempotency, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ProcessOutbox hands unsent messages to send following the rules of the
+// Postgres relay: in order per key, skipping keys whose oldest unsent message
+// is backing off, and parking messages that failed maxAttempts times.
+func (m *Memory) ProcessOutbox(ctx context.Context, limit, maxAttempts int, send func(OutboxRecord) error) (OutboxResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result OutboxResult
+	now := m.now()
+	heads := make(map[string]*memoryOutboxRow)
+	var batch []*memoryOutboxRow
+	for _, row := range m.outbox {
+		if row.sent || row.parked {
+			continue
+		}
+		if heads[row.Key] == nil {
+			heads[row.Key] = row
+		}
+		if !heads[row.Key].nextAttemptAt.After(now) && len(batch) < limit {
+			batch = append(batch, row)
+		}
+	}
+
+	blocked := make(map[string]bool)
+	for _, row := range batch {
+		if blocked[row.Key] {
+			continue
+		}
+		row.Attempts++
+		if err := send(row.OutboxRecord); err != nil {
+			blocked[row.Key] = true
+			row.LastError = err.Error()
+			if row.Attempts >= maxAttempts {
+				row.parked = true
+				result.Parked = append(result.Parked, row.OutboxRecord)
+				continue
+			}
+			row.nextAttemptAt = now.Add(outboxBackoff(row.Attempts))
+			continue
+		}
+		row.sent = true
+		result.Sent++
+	}
+	return result, nil
+}
+
+func (m *Memory) CountParkedOutbox(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, row := range m.outbox {
+		if row.parked {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,422 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+var (
+	// ErrOrderNotFound is returned by mutations targeting an order that does
+	// not exist.
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrNothingToPay is returned when a payment is uploaded for an order
+	// none of whose members is awaiting payment.
+	ErrNothingToPay = errors.New("no registration in the order is awaiting payment")
+)
+
+// MaxOrderMembers bounds the number of registrations in one order.
+const MaxOrderMembers = 10
+
+// Order groups the registrations of several members, e.g. a family, for one
+// event under a single payer, who pays for all of them with one transfer.
+type Order struct {
+	OrderID     uuid.UUID  `json:"order_id"`
+	EventID     uuid.UUID  `json:"event_id"`
+	PayerUserID *uuid.UUID `json:"payer_user_id"`
+	PayerName   string     `json:"payer_name"`
+	PayerEmail  string     `json:"payer_email"`
+	PayerPhone  string     `json:"payer_phone"`
+	// AmountDue is the combined balance of the members awaiting payment or
+	// its verification, or nil if the event has no pricing.
+	AmountDue     *float64        `json:"amount_due"`
+	Registrations []*Registration `json:"registrations"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// awaitingPayment reports whether reg is paid for by the order's next
+// payment.
+func awaitingPayment(reg *Registration) bool {
+	switch statemachine.Status(reg.Status) {
+	case statemachine.Pending, statemachine.Paid, statemachine.PartiallyPaid:
+		return true
+	}
+	return false
+}
+
+// payableMembers returns the members of the order awaiting payment.
+func (o *Order) payableMembers() []*Registration {
+	var members []*Registration
+	for _, reg := range o.Registrations {
+		if awaitingPayment(reg) {
+			members = append(members, reg)
+		}
+	}
+	return members
+}
+
+// amountDue sums the balance of the members awaiting payment. It is nil if
+// any member has none, i.e. the event has no pricing.
+func (o *Order) amountDue() *float64 {
+	var cents float64
+	for _, reg := range o.Registrations {
+		if reg.Balance == nil {
+			return nil
+		}
+		if awaitingPayment(reg) {
+			cents += math.Round(*reg.Balance * 100)
+		}
+	}
+	total := cents / 100
+	return &total
+}
+
+// splitAmount divides a transfer of amount between members in proportion to
+// what each owes, or evenly when any member has no balance or nothing is
+// owed. It works in cents and gives the remainder to the last member, so the
+// parts add up to amount.
+func splitAmount(amount float64, members []*Registration) []float64 {
+	weights := make([]float64, len(members))
+	var total float64
+	for i, reg := range members {
+		if reg.Balance == nil {
+			total = 0
+			break
+		}
+		weights[i] = math.Max(math.Round(*reg.Balance*100), 0)
+		total += weights[i]
+	}
+	if total == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = float64(len(weights))
+	}
+
+	cents := math.Round(amount * 100)
+	parts := make([]float64, len(members))
+	var assigned float64
+	for i := range parts {
+		share := math.Floor(cents * weights[i] / total)
+		if i == len(parts)-1 {
+			share = cents - assigned
+		}
+		parts[i] = share / 100
+		assigned += share
+	}
+	return parts
+}
+
+type CreateOrderParams struct {
+	OrderID     uuid.UUID
+	EventID     uuid.UUID
+	PayerUserID *uuid.UUID
+	PayerName   string
+	PayerEmail  string
+	PayerPhone  string
+	// Members are registered for EventID; their own EventID is ignored.
+	Members []CreateRegistrationParams
+}
+
+func (p CreateOrderParams) Validate() error {
+	var v validation.Validator
+	v.Check(p.EventID != uuid.Nil, "event_id", "is required")
+	if v.Required("payer_name", p.PayerName) {
+		v.MaxLen("payer_name", p.PayerName, 255)
+	}
+	if v.Required("payer_email", p.PayerEmail) {
+		v.MaxLen("payer_email", p.PayerEmail, 255)
+		v.Email("payer_email", p.PayerEmail)
+	}
+	if v.Required("payer_phone", p.PayerPhone) {
+		v.MaxLen("payer_phone", p.PayerPhone, 20)
+		v.Phone("payer_phone", p.PayerPhone)
+	}
+	v.Check(len(p.Members) > 0, "members", "must not be empty")
+	v.Check(len(p.Members) <= MaxOrderMembers, "members", fmt.Sprintf("must have at most %d entries", MaxOrderMembers))
+	for i, m := range p.Members {
+		m.EventID = p.EventID
+		var fieldErrs validation.Errors
+		if errors.As(m.Validate(), &fieldErrs) {
+			for _, fe := range fieldErrs {
+				v.Add(memberField(i, fe.Field), fe.Message)
+			}
+		}
+	}
+	return v.Err()
+}
+
+func memberField(i int, field string) string {
+	return fmt.Sprintf("members[%d].%s", i, field)
+}
+
+// memberError points the field errors in err at member i of the order.
+func memberError(i int, err error) error {
+	var fieldErrs validation.Errors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+	prefixed := make(validation.Errors, len(fieldErrs))
+	for j, fe := range fieldErrs {
+		prefixed[j] = validation.FieldError{Field: memberField(i, fe.Field), Message: fe.Message}
+	}
+	return prefixed
+}
+
+type CreateOrderPaymentParams struct {
+	OrderID              uuid.UUID
+	Amount               float64
+	PaymentMethod        string
+	PaymentProofURL      *string
+	PaymentProofFilename *string
+	BankName             *string
+	AccountNumber        *string
+	AccountHolderName    *string
+}
+
+type VerifyOrderPaymentParams struct {
+	OrderID            uuid.UUID
+	Approved           bool
+	VerifiedBy         *uuid.UUID
+	VerificationNotes  *string
+	RejectionReason    *string
+	RegistrationStatus statemachine.Status
+}
+
+const orderColumns = `order_id, event_id, payer_user_id, payer_name, payer_email, payer_phone, created_at, updated_at`
+
+func scanOrder(row pgx.Row) (*Order, error) {
+	var o Order
+	err := row.Scan(&o.OrderID, &o.EventID, &o.PayerUserID, &o.PayerName, &o.PayerEmail, &o.PayerPhone, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// getOrder returns an order with its members, oldest first, or nil if it
+// does not exist. With forUpdate the order and its
+// members stay locked until q's transaction ends.
+func getOrder(ctx context.Context, q querier, orderID uuid.UUID, forUpdate bool) (*Order, error) {
+	lock := ""
+	if forUpdate {
+		lock = "FOR UPDATE"
+	}
+	order, err := scanOrder(q.QueryRow(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE order_id = $1
+		`+lock, orderID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	rows, err := q.Query(ctx, `
+		SELECT `+registrationColumns+`
+		FROM registrations
+		WHERE order_id = $1
+		ORDER BY created_at, registration_id
+		`+lock, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Registrations, err = scanRegistrations(rows); err != nil {
+		return nil, err
+	}
+	order.AmountDue = order.amountDue()
+	return order, nil
+}
+
+// CreateOrder inserts an order and registers each of its members as
+// CreateRegistration would, all in one transaction: if any member is refused
+// no one is registered. events builds the messages enqueued for each member.
+func (r *Postgres) CreateOrder(ctx context.Context, params CreateOrderParams, events func(*Registration) []OutboxMessage) (*Order, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var orderID *uuid.UUID
+	if params.OrderID != uuid.Nil {
+		orderID = &params.OrderID
+	}
+	order, err := scanOrder(tx.QueryRow(ctx, `
+		INSERT INTO orders (order_id, event_id, payer_user_id, payer_name, payer_email, payer_phone)
+		VALUES (COALESCE($1, gen_random_uuid()), $2, $3, $4, $5, $6)
+		RETURNING `+orderColumns,
+		orderID, params.EventID, params.PayerUserID, params.PayerName, params.PayerEmail, params.PayerPhone))
+	if err != nil {
+		return nil, err
+	}
+	for i, member := range params.Members {
+		member.EventID = params.EventID
+		reg, err := r.createRegistration(ctx, tx, member, &order.OrderID)
+		if err != nil {
+			return nil, memberError(i, err)
+		}
+		if events != nil {
+			if err := enqueueOutbox(ctx, tx, events(reg)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if order, err = getOrder(ctx, tx, order.OrderID, false); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetOrder returns an order with its members, or nil if it does not exist.
+func (r *Postgres) GetOrder(ctx context.Context, orderID uuid.UUID) (*Order, error) {
+	return getOrder(ctx, r.Pool, orderID, false)
+}
+
+// CreateOrderPayment records one transfer for every member of an order
+// awaiting payment and marks them paid. Each member gets a payment row for
+// its share of the amount, split by splitAmount, with the order's proof; the
+// amount_status of every row compares the whole transfer with the order's
+// amount_due. events builds the messages enqueued for each row.
+func (r *Postgres) CreateOrderPayment(ctx context.Context, params CreateOrderPaymentParams, events func(*Payment) []OutboxMessage) ([]*Payment, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := getOrder(ctx, tx, params.OrderID, true)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	members := order.payableMembers()
+	if len(members) == 0 {
+		return nil, ErrNothingToPay
+	}
+	amountStatus := AmountStatus(params.Amount, order.AmountDue)
+	shares := splitAmount(params.Amount, members)
+
+	payments := make([]*Payment, 0, len(members))
+	for i, member := range members {
+		if _, err := markPaid(ctx, tx, member.RegistrationID); err != nil {
+			return nil, err
+		}
+		payment, err := insertPayment(ctx, tx, CreatePaymentParams{
+			RegistrationID:       member.RegistrationID,
+			Amount:               shares[i],
+			PaymentMethod:        params.PaymentMethod,
+			PaymentProofURL:      params.PaymentProofURL,
+			PaymentProofFilename: params.PaymentProofFilename,
+			BankName:             params.BankName,
+			AccountNumber:        params.AccountNumber,
+			AccountHolderName:    params.AccountHolderName,
+		}, &order.OrderID, amountStatus)
+		if err != nil {
+			return nil, err
+		}
+		if events != nil {
+			if err := enqueueOutbox(ctx, tx, events(payment)); err != nil {
+				return nil, err
+			}
+		}
+		payments = append(payments, payment)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// VerifyOrderPayment records one decision on the latest pending payment of
+// every member of an order and settles those members as VerifyPayment does,
+// in one transaction. events builds the messages enqueued for each verified
+// payment from it and its member as updated.
+func (r *Postgres) VerifyOrderPayment(ctx context.Context, params VerifyOrderPaymentParams, events func(*Payment, *Registration) []OutboxMessage) ([]*Payment, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := getOrder(ctx, tx, params.OrderID, true)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	// As for a single registration, only a member's latest upload is
+	// verified; older ones were superseded by it
+	rows, err := tx.Query(ctx, `
+		SELECT payment_id, registration_id
+		FROM (
+			SELECT DISTINCT ON (registration_id) payment_id, registration_id, verification_status, order_id
+			FROM payments
+			WHERE registration_id IN (SELECT registration_id FROM registrations WHERE order_id = $1)
+			ORDER BY registration_id, created_at DESC
+		) latest
+		WHERE verification_status = 'pending' AND order_id = $1
+	`, params.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	var pending []VerifyPaymentParams
+	for rows.Next() {
+		p := VerifyPaymentParams{
+			Approved:           params.Approved,
+			VerifiedBy:         params.VerifiedBy,
+			VerificationNotes:  params.VerificationNotes,
+			RejectionReason:    params.RejectionReason,
+			RegistrationStatus: params.RegistrationStatus,
+		}
+		if err := rows.Scan(&p.PaymentID, &p.RegistrationID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, ErrNoPendingPayment
+	}
+
+	payments := make([]*Payment, 0, len(pending))
+	for _, p := range pending {
+		payment, reg, err := r.verifyPayment(ctx, tx, p)
+		if err != nil {
+			return nil, err
+		}
+		if events != nil {
+			if err := enqueueOutbox(ctx, tx, events(payment, reg)); err != nil {
+				return nil, err
+			}
+		}
+		payments = append(payments, payment)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
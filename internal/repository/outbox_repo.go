@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// outboxLockID is the advisory lock key that serialises outbox relays so
+// per-key ordering holds even with several service instances running.
+const outboxLockID = 727001
+
+// OutboxMessage is an event to publish once the surrounding transaction commits.
+type OutboxMessage struct {
+	Topic   string
+	Key     string
+	Payload any
+}
+
+// Event wraps data in the {"event", "data"} envelope used by every message
+// this service publishes.
+func Event(topic, key, name string, data map[string]any) OutboxMessage {
+	return OutboxMessage{
+		Topic:   topic,
+		Key:     key,
+		Payload: map[string]any{"event": name, "data": data},
+	}
+}
+
+type OutboxRecord struct {
+	ID       int64
+	Topic    string
+	Key      string
+	Payload  json.RawMessage
+	Attempts int
+	// LastError is why the latest attempt failed, set on parked records.
+	LastError string
+}
+
+// OutboxResult reports what one ProcessOutbox call did. Parked lists the
+// messages it gave up on.
+type OutboxResult struct {
+	Sent   int
+	Parked []OutboxRecord
+}
+
+func enqueueOutbox(ctx context.Context, q querier, msgs []OutboxMessage) error {
+	for _, m := range msgs {
+		if m.Topic == "" {
+			continue
+		}
+		payload, err := json.Marshal(m.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal outbox payload: %w", err)
+		}
+		_, err = q.Exec(ctx, `
+			INSERT INTO outbox (topic, message_key, payload)
+			VALUES ($1, $2, $3)
+		`, m.Topic, m.Key, payload)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessOutbox hands up to limit unsent outbox rows, oldest first, to send
+// and records the outcome. Rows are sent in order per key: once a row fails
+// it backs off and the rest of its key is held back until it is due again,
+// while other keys carry on. A row that has failed maxAttempts times is
+// parked instead and no longer holds its key back. If another relay holds
+// the lock it returns immediately.
+//
+// The lock is taken on a session rather than in a transaction, so no
+// transaction stays open while send talks to the broker.
+func (r *Postgres) ProcessOutbox(ctx context.Context, limit, maxAttempts int, send func(OutboxRecord) error) (OutboxResult, error) {
+	var result OutboxResult
+	conn, err := r.Pool.Acquire(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, outboxLockID).Scan(&locked); err != nil {
+		return result, err
+	}
+	if !locked {
+		return result, nil
+	}
+	defer func() {
+		// A connection still holding the lock must not go back to the pool
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, outboxLockID); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	// Only keys whose oldest unsent row is due take part, so a key that is
+	// backing off cannot fill the batch and starve the others
+	rows, err := conn.Query(ctx, `
+		SELECT o.id, o.topic, o.message_key, o.payload, o.attempts
+		FROM outbox o
+		JOIN (
+			SELECT DISTINCT ON (message_key) message_key, next_attempt_at
+			FROM outbox
+			WHERE sent_at IS NULL AND parked_at IS NULL
+			ORDER BY message_key, id
+		) head ON head.message_key = o.message_key
+		WHERE o.sent_at IS NULL AND o.parked_at IS NULL
+			AND head.next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY o.id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return result, err
+	}
+	var batch []OutboxRecord
+	for rows.Next() {
+		var rec OutboxRecord
+		if err := rows.Scan(&rec.ID, &rec.Topic, &rec.Key, &rec.Payload, &rec.Attempts); err != nil {
+			rows.Close()
+			return result, err
+		}
+		batch = append(batch, rec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	blocked := make(map[string]bool)
+	for _, rec := range batch {
+		if blocked[rec.Key] {
+			continue
+		}
+		sendErr := send(rec)
+		if sendErr == nil {
+			if _, err := conn.Exec(ctx, `UPDATE outbox SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1 WHERE id = $1`, rec.ID); err != nil {
+				return result, err
+			}
+			result.Sent++
+			continue
+		}
+
+		blocked[rec.Key] = true
+		rec.Attempts++
+		rec.LastError = sendErr.Error()
+		if rec.Attempts >= maxAttempts {
+			_, err = conn.Exec(ctx, `
+				UPDATE outbox
+				SET attempts = $2,
+					last_error = $3,
+					parked_at = CURRENT_TIMESTAMP
+				WHERE id = $1
+			`, rec.ID, rec.Attempts, rec.LastError)
+			if err != nil {
+				return result, err
+			}
+			result.Parked = append(result.Parked, rec)
+			continue
+		}
+		_, err = conn.Exec(ctx, `
+			UPDATE outbox
+			SET attempts = $2,
+				last_error = $3,
+				next_attempt_at = CURRENT_TIMESTAMP + $4::interval
+			WHERE id = $1
+		`, rec.ID, rec.Attempts, rec.LastError, interval(outboxBackoff(rec.Attempts)))
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// CountParkedOutbox returns how many messages were parked and still wait to
+// be requeued by hand.
+func (r *Postgres) CountParkedOutbox(ctx context.Context) (int, error) {
+	var n int
+	err := r.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM outbox WHERE parked_at IS NOT NULL AND sent_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// outboxBackoff doubles the retry delay per attempt, capped at five minutes.
+func outboxBackoff(attempts int) time.Duration {
+	d := time.Second
+	for i := 1; i < attempts && d < 5*time.Minute; i++ {
+		d *= 2
+	}
+	if d > 5*time.Minute {
+		d = 5 * time.Minute
+	}
+	return d
+}
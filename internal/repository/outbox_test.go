@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMemoryProcessOutbox(t *testing.T) {
+	m := NewMemory()
+	testProcessOutbox(t, m, func(msgs ...OutboxMessage) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		rows, err := m.outboxRows(msgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.enqueue(rows)
+	})
+}
+
+// testProcessOutbox checks the relay rules on store, whose outbox enqueue
+// adds messages to. The outbox must start empty.
+func testProcessOutbox(t *testing.T, store OutboxStore, enqueue func(...OutboxMessage)) {
+	ctx := context.Background()
+	failing := map[string]bool{}
+	var sent []string
+	send := func(rec OutboxRecord) error {
+		if failing[rec.Key] {
+			return errors.New("broker unavailable")
+		}
+		var payload struct {
+			Event string `json:"event"`
+		}
+		if err := json.Unmarshal(rec.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, payload.Event)
+		return nil
+	}
+	process := func(limit, maxAttempts int) OutboxResult {
+		t.Helper()
+		sent = nil
+		result, err := store.ProcessOutbox(ctx, limit, maxAttempts, send)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	event := func(key, name string) OutboxMessage { return Event("topic", key, name, nil) }
+
+	// A failing key holds back only its own later messages
+	enqueue(event("a", "a1"), event("b", "b1"), event("a", "a2"), event("b", "b2"), event("c", "c1"))
+	failing["a"] = true
+	if result := process(10, 5); result.Sent != 3 || len(result.Parked) != 0 || !slices.Equal(sent, []string{"b1", "b2", "c1"}) {
+		t.Errorf("sent %v (%+v), want b1 b2 c1", sent, result)
+	}
+
+	// Its first message is not due again yet, so the key is skipped even
+	// though the broker would take it now, and it does not use up the batch
+	failing["a"] = false
+	enqueue(event("d", "d1"))
+	if result := process(1, 5); result.Sent != 1 || !slices.Equal(sent, []string{"d1"}) {
+		t.Errorf("sent %v (%+v), want d1", sent, result)
+	}
+
+	// A message failing maxAttempts times is parked and releases its key
+	enqueue(event("e", "e1"), event("e", "e2"))
+	failing["e"] = true
+	result := process(10, 1)
+	if result.Sent != 0 || len(result.Parked) != 1 {
+		t.Fatalf("sent %v, parked %+v", sent, result.Parked)
+	}
+	if parked := result.Parked[0]; parked.Key != "e" || parked.Attempts != 1 || parked.LastError != "broker unavailable" {
+		t.Errorf("parked %+v", parked)
+	}
+	if n, err := store.CountParkedOutbox(ctx); err != nil || n != 1 {
+		t.Errorf("parked count = %d, %v", n, err)
+	}
+	failing["e"] = false
+	if result := process(10, 1); result.Sent != 1 || !slices.Equal(sent, []string{"e2"}) {
+		t.Errorf("sent %v (%+v), want e2", sent, result)
+	}
+}
@@ -0,0 +1,370 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+)
+
+type Payment struct {
+	PaymentID            uuid.UUID  `json:"payment_id"`
+	RegistrationID       uuid.UUID  `json:"registration_id"`
+	Amount               float64    `json:"amount"`
+	AmountStatus         *string    `json:"amount_status"`
+	PaymentMethod        string     `json:"payment_method"`
+	PaymentDate          time.Time  `json:"payment_date"`
+	PaymentProofURL      *string    `json:"payment_proof_url"`
+	PaymentProofFilename *string    `json:"payment_proof_filename"`
+	BankName             *string    `json:"bank_name"`
+	AccountNumber        *string    `json:"account_number"`
+	AccountHolderName    *string    `json:"account_holder_name"`
+	VerificationStatus   string     `json:"verification_status"`
+	VerifiedBy           *uuid.UUID `json:"verified_by"`
+	VerifiedAt           *time.Time `json:"verified_at"`
+	VerificationNotes    *string    `json:"verification_notes"`
+	RejectionReason      *string    `json:"rejection_reason"`
+	OrderID              *uuid.UUID `json:"order_id"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+type CreatePaymentParams struct {
+	PaymentID            uuid.UUID
+	RegistrationID       uuid.UUID
+	Amount               float64
+	PaymentMethod        string
+	PaymentProofURL      *string
+	PaymentProofFilename *string
+	BankName             *string
+	AccountNumber        *string
+	AccountHolderName    *string
+}
+
+const paymentColumns = `payment_id, registration_id, amount, amount_status, payment_method, payment_date,
+			payment_proof_url, payment_proof_filename, bank_name, account_number,
+			account_holder_name, verification_status, verified_by, verified_at,
+			verification_notes, rejection_reason, order_id, created_at, updated_at`
+
+func scanPayment(row pgx.Row) (*Payment, error) {
+	var p Payment
+	err := row.Scan(
+		&p.PaymentID, &p.RegistrationID, &p.Amount, &p.AmountStatus, &p.PaymentMethod, &p.PaymentDate,
+		&p.PaymentProofURL, &p.PaymentProofFilename, &p.BankName, &p.AccountNumber,
+		&p.AccountHolderName, &p.VerificationStatus, &p.VerifiedBy, &p.VerifiedAt,
+		&p.VerificationNotes, &p.RejectionReason, &p.OrderID, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ErrPaidByOrder is returned when a payment is uploaded or verified for a
+// single member of an order, which is paid and verified as a whole.
+var ErrPaidByOrder = errors.New("registration belongs to an order; pay and verify through the order")
+
+// CreatePayment records a payment and marks the registration as paid. Uploads
+// are refused once the registration has been confirmed, cancelled or rejected.
+// The payment's amount_status compares it with what the registration still
+// owes (see Registration.PaymentAmountStatus).
+func (r *Postgres) CreatePayment(ctx context.Context, params CreatePaymentParams, events ...OutboxMessage) (*Payment, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	reg, err := markPaid(ctx, tx, params.RegistrationID)
+	if err != nil {
+		return nil, err
+	}
+	if reg.OrderID != nil {
+		return nil, ErrPaidByOrder
+	}
+	payment, err := insertPayment(ctx, tx, params, nil, reg.PaymentAmountStatus(params.Amount))
+	if err != nil {
+		return nil, err
+	}
+	if err := enqueueOutbox(ctx, tx, events); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// markPaid moves a registration to paid, or keeps it there: a second upload
+// while already paid (e.g. a corrected proof) is allowed. A partially paid
+// registration moves to paid while its next payment awaits verification.
+func markPaid(ctx context.Context, tx pgx.Tx, registrationID uuid.UUID) (*Registration, error) {
+	before, err := lockRegistration(ctx, tx, registrationID)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	allowed := append(statemachine.Sources(statemachine.Paid), string(statemachine.Paid))
+	reg, err := scanRegistration(tx.QueryRow(ctx, `
+		UPDATE registrations
+		SET status = 'paid',
+			updated_at = CURRENT_TIMESTAMP
+		WHERE registration_id = $1 AND status = ANY($2::registration_status[])
+		RETURNING `+registrationColumns,
+		registrationID, allowed))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, transitionError(ctx, tx, registrationID, statemachine.Paid)
+		}
+		return nil, err
+	}
+	if err := auditRegistration(ctx, tx, "registration.status_changed", before, reg); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// checkPayable reports whether reg may take a payment under the rules of
+// markPaid, without changing it.
+func checkPayable(reg *Registration) error {
+	if reg.Status == string(statemachine.Paid) {
+		return nil
+	}
+	return statemachine.Validate(statemachine.Status(reg.Status), statemachine.Paid)
+}
+
+// insertPayment stores a pending payment for params.RegistrationID. Earlier
+// payments of the registration still pending are superseded by it, so only
+// the latest upload awaits verification.
+func insertPayment(ctx context.Context, tx pgx.Tx, params CreatePaymentParams, orderID *uuid.UUID, amountStatus *string) (*Payment, error) {
+	if err := supersedePayments(ctx, tx, params.RegistrationID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO payments (
+			payment_id, registration_id, amount, payment_method, payment_proof_url,
+			payment_proof_filename, bank_name, account_number, account_holder_name, amount_status, order_id
+		) VALUES (COALESCE($1, gen_random_uuid()), $2, $3, COALESCE(NULLIF($4, '')::payment_method, 'bank_transfer'), $5, $6, $7, $8, $9, $10, $11)
+		RETURNING ` + paymentColumns
+
+	var paymentID *uuid.UUID
+	if params.PaymentID != uuid.Nil {
+		paymentID = &params.PaymentID
+	}
+	payment, err := scanPayment(tx.QueryRow(ctx, query,
+		paymentID, params.RegistrationID, params.Amount, params.PaymentMethod, params.PaymentProofURL,
+		params.PaymentProofFilename, params.BankName, params.AccountNumber, params.AccountHolderName,
+		amountStatus, orderID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := auditPayment(ctx, tx, "payment.created", nil, payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// supersedePayments marks the pending payments of a registration superseded.
+func supersedePayments(ctx context.Context, tx pgx.Tx, registrationID uuid.UUID) error {
+	rows, err := tx.Query(ctx, `
+		UPDATE payments
+		SET verification_status = 'superseded',
+			updated_at = CURRENT_TIMESTAMP
+		WHERE registration_id = $1 AND verification_status = 'pending'
+		RETURNING `+paymentColumns,
+		registrationID)
+	if err != nil {
+		return err
+	}
+	var superseded []*Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		superseded = append(superseded, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, after := range superseded {
+		before := *after
+		before.VerificationStatus = "pending"
+		if err := auditPayment(ctx, tx, "payment.superseded", &before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLatestPaymentByRegistrationID returns the most recent payment for a
+// registration, or nil if none has been uploaded yet.
+func (r *Postgres) GetLatestPaymentByRegistrationID(ctx context.Context, registrationID uuid.UUID) (*Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE registration_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	p, err := scanPayment(r.Pool.QueryRow(ctx, query, registrationID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *Postgres) ListPaymentsByRegistrationID(ctx context.Context, registrationID uuid.UUID) ([]*Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE registration_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.Pool.Query(ctx, query, registrationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []*Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+
+	return payments, rows.Err()
+}
+
+// ErrNoPendingPayment is returned when a verification is requested for a
+// payment that is not (or no longer) awaiting review.
+var ErrNoPendingPayment = errors.New("no pending payment for registration")
+
+type VerifyPaymentParams struct {
+	PaymentID         uuid.UUID
+	RegistrationID    uuid.UUID
+	Approved          bool
+	VerifiedBy        *uuid.UUID
+	VerificationNotes *string
+	RejectionReason   *string
+	// RegistrationStatus is the status asked for. Confirmed becomes
+	// PartiallyPaid while a balance remains, and Pending becomes
+	// PartiallyPaid once earlier payments were approved.
+	RegistrationStatus statemachine.Status
+}
+
+// VerifyPayment records the verification decision on a pending payment,
+// credits an approved amount to the registration's amount_paid, moves the
+// registration to the status the decision settles on, reopens its payment
+// window if it is left owing past its deadline and enqueues the events
+// built by events from the verified payment and updated registration, all in
+// one transaction.
+func (r *Postgres) VerifyPayment(ctx context.Context, params VerifyPaymentParams, events func(*Payment, *Registration) []OutboxMessage) (*Payment, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	payment, reg, err := r.verifyPayment(ctx, tx, params)
+	if err != nil {
+		return nil, err
+	}
+	if payment.OrderID != nil {
+		return nil, ErrPaidByOrder
+	}
+	if events != nil {
+		if err := enqueueOutbox(ctx, tx, events(payment, reg)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// verifyPayment does the work of VerifyPayment inside tx and returns the
+// registration as the decision left it.
+func (r *Postgres) verifyPayment(ctx context.Context, tx pgx.Tx, params VerifyPaymentParams) (*Payment, *Registration, error) {
+	before, err := scanPayment(tx.QueryRow(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments
+		WHERE payment_id = $1 AND registration_id = $2 AND verification_status = 'pending'
+		FOR UPDATE
+	`, params.PaymentID, params.RegistrationID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil, ErrNoPendingPayment
+		}
+		return nil, nil, err
+	}
+
+	verificationStatus := "rejected"
+	if params.Approved {
+		verificationStatus = "approved"
+	}
+
+	query := `
+		UPDATE payments
+		SET verification_status = $2,
+			verified_by = $3,
+			verified_at = CURRENT_TIMESTAMP,
+			verification_notes = $4,
+			rejection_reason = $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE payment_id = $1
+		RETURNING ` + paymentColumns
+
+	payment, err := scanPayment(tx.QueryRow(ctx, query,
+		before.PaymentID, verificationStatus, params.VerifiedBy, params.VerificationNotes, params.RejectionReason,
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := auditPayment(ctx, tx, "payment.verified", before, payment); err != nil {
+		return nil, nil, err
+	}
+
+	reg, err := lockRegistration(ctx, tx, params.RegistrationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reg == nil {
+		return nil, nil, ErrRegistrationNotFound
+	}
+	if params.Approved {
+		if reg, err = creditPayment(ctx, tx, reg, payment.Amount); err != nil {
+			return nil, nil, err
+		}
+	}
+	if status := settledStatus(reg, params.RegistrationStatus); string(status) != reg.Status {
+		if reg, err = r.updateStatus(ctx, tx, params.RegistrationID, status, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	if reg, err = r.reopenPaymentWindow(ctx, tx, reg); err != nil {
+		return nil, nil, err
+	}
+	return payment, reg, nil
+}
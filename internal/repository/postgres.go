@@ -4,11 +4,27 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx so helpers can run
+// inside or outside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type Postgres struct {
 	Pool *pgxpool.Pool
+
+	// PromotedTopic receives registration.promoted events when waitlisted
+	// registrants get a seat. DefaultPaymentWindowHours is how long a pending
+	// registration has to pay when its event sets no window of its own.
+	PromotedTopic             string
+	DefaultPaymentWindowHours int
 }
 
 func NewPostgres(dbURL string) (*Postgres, error) {
@@ -27,4 +43,3 @@ func NewPostgres(dbURL string) (*Postgres, error) {
 func (p *Postgres) Close() {
 	p.Pool.Close()
 }
-
@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/migrate"
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/migrations"
+)
+
+// The tests in this file run against the PostgreSQL database named by
+// TEST_DATABASE_URL and are skipped without it. They migrate the database
+// up and leave their rows behind, each under events of its own, so use a
+// throwaway database.
+
+func testPostgres(t *testing.T) *Postgres {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	pg, err := NewPostgres(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pg.Close)
+
+	migrator, err := migrate.New(pg.Pool, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pg.PromotedTopic = "registration.promoted"
+	pg.DefaultPaymentWindowHours = 24
+	return pg
+}
+
+// newRegistrant returns the params of a registration for eventID by a new
+// user.
+func newRegistrant(eventID uuid.UUID, voucherCode string) CreateRegistrationParams {
+	userID := uuid.New()
+	return CreateRegistrationParams{
+		EventID:     eventID,
+		UserID:      &userID,
+		FullName:    "Integration Test",
+		Gender:      "female",
+		Phone:       "081234567890",
+		Email:       userID.String() + "@example.com",
+		VoucherCode: voucherCode,
+	}
+}
+
+func register(t *testing.T, pg *Postgres, params CreateRegistrationParams) *Registration {
+	t.Helper()
+	reg, err := pg.CreateRegistration(context.Background(), params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func getRegistration(t *testing.T, pg *Postgres, registrationID uuid.UUID) *Registration {
+	t.Helper()
+	reg, err := pg.GetRegistrationByID(context.Background(), registrationID)
+	if err != nil || reg == nil {
+		t.Fatalf("registration %s: %v, %v", registrationID, reg, err)
+	}
+	return reg
+}
+
+func setCapacity(t *testing.T, pg *Postgres, eventID uuid.UUID, totalQuota int) {
+	t.Helper()
+	if _, err := pg.UpsertEventCapacity(context.Background(), UpsertEventCapacityParams{EventID: eventID, TotalQuota: &totalQuota}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createVoucher prices eventID and creates a 10% voucher for it with
+// maxUses uses.
+func createVoucher(t *testing.T, pg *Postgres, eventID uuid.UUID, maxUses int) *Voucher {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := pg.UpsertEventPricing(ctx, UpsertEventPricingParams{EventID: eventID, BasePrice: 100000}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := pg.CreateVoucher(ctx, CreateVoucherParams{
+		Code:          NormalizeVoucherCode("it-" + uuid.NewString()[:8]),
+		EventID:       &eventID,
+		DiscountType:  "percent",
+		DiscountValue: 10,
+		MaxUses:       &maxUses,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func voucherUses(t *testing.T, pg *Postgres, voucherID uuid.UUID) int {
+	t.Helper()
+	v, err := pg.GetVoucher(context.Background(), voucherID)
+	if err != nil || v == nil {
+		t.Fatalf("voucher %s: %v, %v", voucherID, v, err)
+	}
+	return v.UsedCount
+}
+
+func TestPostgresCapacity(t *testing.T) {
+	pg := testPostgres(t)
+	ctx := context.Background()
+	eventID := uuid.New()
+	setCapacity(t, pg, eventID, 3)
+
+	// Concurrent registrations take the seats once and queue the rest
+	var wg sync.WaitGroup
+	regs := make([]*Registration, 10)
+	errs := make([]error, len(regs))
+	for i := range regs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			regs[i], errs[i] = pg.CreateRegistration(ctx, newRegistrant(eventID, ""), nil)
+		}()
+	}
+	wg.Wait()
+	var seated []*Registration
+	positions := map[int]bool{}
+	for i, reg := range regs {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		switch reg.Status {
+		case string(statemachine.Pending):
+			seated = append(seated, reg)
+		case string(statemachine.Waitlisted):
+			positions[*reg.WaitlistPosition] = true
+		default:
+			t.Errorf("registration %s is %s", reg.RegistrationID, reg.Status)
+		}
+	}
+	if len(seated) != 3 || len(positions) != 7 {
+		t.Fatalf("%d seated, waitlist positions %v", len(seated), positions)
+	}
+	for pos := 1; pos <= 7; pos++ {
+		if !positions[pos] {
+			t.Errorf("waitlist positions %v, want 1 to 7", positions)
+		}
+	}
+
+	// A freed seat goes to the head of the waitlist
+	var head *Registration
+	for _, reg := range regs {
+		if reg.WaitlistPosition != nil && *reg.WaitlistPosition == 1 {
+			head = reg
+		}
+	}
+	if err := pg.CancelRegistration(ctx, seated[0].RegistrationID, "changed plans"); err != nil {
+		t.Fatal(err)
+	}
+	promoted := getRegistration(t, pg, head.RegistrationID)
+	if promoted.Status != string(statemachine.Pending) || promoted.WaitlistPosition != nil || promoted.PaymentDueAt == nil {
+		t.Errorf("head of the waitlist after a cancellation: %+v", promoted)
+	}
+
+	// Raising the quota promotes the next in line
+	setCapacity(t, pg, eventID, 4)
+	waitlisted := 0
+	for _, reg := range regs {
+		if getRegistration(t, pg, reg.RegistrationID).Status == string(statemachine.Waitlisted) {
+			waitlisted++
+		}
+	}
+	if waitlisted != 5 {
+		t.Errorf("%d still waitlisted after raising the quota, want 5", waitlisted)
+	}
+}
+
+func TestPostgresVoucherLimit(t *testing.T) {
+	pg := testPostgres(t)
+	ctx := context.Background()
+	eventID := uuid.New()
+	voucher := createVoucher(t, pg, eventID, 3)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = pg.CreateRegistration(ctx, newRegistrant(eventID, voucher.Code), nil)
+		}()
+	}
+	wg.Wait()
+	redeemed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+		case !errors.Is(err, ErrVoucherExhausted):
+			t.Errorf("redeem: %v", err)
+		}
+	}
+	if redeemed != 3 {
+		t.Errorf("redeemed %d times, want max_uses 3", redeemed)
+	}
+	if n := voucherUses(t, pg, voucher.VoucherID); n != 3 {
+		t.Errorf("used_count = %d, want 3", n)
+	}
+
+	// An email redeems a code once; cancelling gives the use back
+	other := createVoucher(t, pg, eventID, 1)
+	params := newRegistrant(eventID, other.Code)
+	reg := register(t, pg, params)
+	again := newRegistrant(eventID, other.Code)
+	again.Email = params.Email
+	if _, err := pg.CreateRegistration(ctx, again, nil); !errors.Is(err, ErrVoucherAlreadyUsed) {
+		t.Errorf("second redemption by %s: %v", params.Email, err)
+	}
+	if err := pg.CancelRegistration(ctx, reg.RegistrationID, "changed plans"); err != nil {
+		t.Fatal(err)
+	}
+	if n := voucherUses(t, pg, other.VoucherID); n != 0 {
+		t.Errorf("used_count after cancelling = %d, want 0", n)
+	}
+	register(t, pg, again)
+}
+
+func TestPostgresExpiry(t *testing.T) {
+	pg := testPostgres(t)
+	ctx := context.Background()
+	eventID := uuid.New()
+	setCapacity(t, pg, eventID, 1)
+	voucher := createVoucher(t, pg, eventID, 1)
+
+	overdue := register(t, pg, newRegistrant(eventID, voucher.Code))
+	waiting := register(t, pg, newRegistrant(eventID, ""))
+	if waiting.Status != string(statemachine.Waitlisted) {
+		t.Fatalf("second registration is %s, want waitlisted", waiting.Status)
+	}
+	if _, err := pg.Pool.Exec(ctx, `
+		UPDATE registrations
+		SET payment_due_at = CURRENT_TIMESTAMP - INTERVAL '1 minute'
+		WHERE registration_id = $1
+	`, overdue.RegistrationID); err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := pg.ExpireOverdueRegistrations(ctx, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, reg := range expired {
+		found = found || reg.RegistrationID == overdue.RegistrationID
+	}
+	if !found {
+		t.Fatalf("overdue registration %s was not expired", overdue.RegistrationID)
+	}
+	got := getRegistration(t, pg, overdue.RegistrationID)
+	if got.Status != string(statemachine.Cancelled) || got.CancelledAt == nil || got.CancellationReason == nil || *got.CancellationReason != PaymentTimeoutReason {
+		t.Errorf("expired registration: %+v", got)
+	}
+	if n := voucherUses(t, pg, voucher.VoucherID); n != 0 {
+		t.Errorf("used_count after expiry = %d, want 0", n)
+	}
+	if got := getRegistration(t, pg, waiting.RegistrationID); got.Status != string(statemachine.Pending) || got.WaitlistPosition != nil {
+		t.Errorf("waitlisted registration after expiry: %+v", got)
+	}
+}
+
+func TestPostgresStatusChangeCancel(t *testing.T) {
+	pg := testPostgres(t)
+	ctx := context.Background()
+	reg := register(t, pg, newRegistrant(uuid.New(), ""))
+
+	if err := pg.UpdateRegistrationStatus(ctx, reg.RegistrationID, statemachine.Cancelled, StatusChangeCancelReason); err != nil {
+		t.Fatal(err)
+	}
+	got := getRegistration(t, pg, reg.RegistrationID)
+	if got.Status != string(statemachine.Cancelled) || got.CancelledAt == nil || got.CancellationReason == nil || *got.CancellationReason != StatusChangeCancelReason {
+		t.Errorf("cancelled registration: %+v", got)
+	}
+	var transitionErr *statemachine.TransitionError
+	if err := pg.UpdateRegistrationStatus(ctx, reg.RegistrationID, statemachine.Pending, ""); !errors.As(err, &transitionErr) {
+		t.Errorf("reopening a cancelled registration: %v", err)
+	}
+}
+
+func TestPostgresSupersededPayment(t *testing.T) {
+	pg := testPostgres(t)
+	ctx := context.Background()
+	reg := register(t, pg, newRegistrant(uuid.New(), ""))
+
+	proof := "/files/payments/proof.png"
+	pay := func() *Payment {
+		t.Helper()
+		p, err := pg.CreatePayment(ctx, CreatePaymentParams{RegistrationID: reg.RegistrationID, Amount: 100000, PaymentProofURL: &proof})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	first, second := pay(), pay()
+	payments, err := pg.ListPaymentsByRegistrationID(ctx, reg.RegistrationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[uuid.UUID]string{}
+	for _, p := range payments {
+		statuses[p.PaymentID] = p.VerificationStatus
+	}
+	if statuses[first.PaymentID] != "superseded" || statuses[second.PaymentID] != "pending" {
+		t.Errorf("verification statuses %v", statuses)
+	}
+}
+
+func TestPostgresProcessOutbox(t *testing.T) {
+	pg := testPostgres(t)
+	ctx := context.Background()
+	if _, err := pg.Pool.Exec(ctx, `TRUNCATE outbox`); err != nil {
+		t.Fatal(err)
+	}
+	testProcessOutbox(t, slowBackoff{pg}, func(msgs ...OutboxMessage) {
+		if err := enqueueOutbox(ctx, pg.Pool, msgs); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// slowBackoff stretches the backoff of failed messages to an hour, so that
+// testProcessOutbox does not race the one-second first retry.
+type slowBackoff struct{ *Postgres }
+
+func (s slowBackoff) ProcessOutbox(ctx context.Context, limit, maxAttempts int, send func(OutboxRecord) error) (OutboxResult, error) {
+	result, err := s.Postgres.ProcessOutbox(ctx, limit, maxAttempts, send)
+	if err != nil {
+		return result, err
+	}
+	_, err = s.Pool.Exec(ctx, `
+		UPDATE outbox
+		SET next_attempt_at = CURRENT_TIMESTAMP + INTERVAL '1 hour'
+		WHERE sent_at IS NULL AND parked_at IS NULL AND attempts > 0
+	`)
+	return result, err
+}
+
+// The advisory lock lets one relay at a time through; the others return
+// without sending.
+func TestPostgresProcessOutboxLock(t *testing.T) {
+	pg := testPostgres(t)
+	ctx := context.Background()
+	if _, err := pg.Pool.Exec(ctx, `TRUNCATE outbox`); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueOutbox(ctx, pg.Pool, []OutboxMessage{Event("topic", "a", "a1", nil)}); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	sending := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := pg.ProcessOutbox(ctx, 10, 5, func(OutboxRecord) error {
+			close(sending)
+			<-release
+			return nil
+		})
+		done <- err
+	}()
+	<-sending
+	result, err := pg.ProcessOutbox(ctx, 10, 5, func(rec OutboxRecord) error {
+		t.Errorf("sent %s while another relay holds the lock", rec.Key)
+		return nil
+	})
+	if err != nil || result.Sent != 0 {
+		t.Errorf("second relay: %+v, %v", result, err)
+	}
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("first relay did not finish")
+	}
+	var unsent int
+	if err := pg.Pool.QueryRow(ctx, `SELECT count(*) FROM outbox WHERE sent_at IS NULL`).Scan(&unsent); err != nil || unsent != 0 {
+		t.Errorf("%d messages unsent, %v", unsent, err)
+	}
+}
@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+// MaxAmount is the largest amount a DECIMAL(10,2) money column holds.
+const MaxAmount = 99999999.99
+
+// CategoryPrice is the price for registrants of one category, e.g. student.
+type CategoryPrice struct {
+	Category string  `json:"category"`
+	Price    float64 `json:"price"`
+}
+
+// EarlyBirdWindow discounts registrations made before EndsAt.
+type EarlyBirdWindow struct {
+	Name            string    `json:"name"`
+	EndsAt          time.Time `json:"ends_at"`
+	DiscountPercent int       `json:"discount_percent"`
+}
+
+// EventPricing is what registering for an event costs. The price is the
+// registrant's category price, else their gender's price, else BasePrice,
+// less the discount of the early-bird window open at registration. With
+// Installments the price is paid in parts rather than in one go.
+type EventPricing struct {
+	EventID      uuid.UUID         `json:"event_id"`
+	BasePrice    float64           `json:"base_price"`
+	MalePrice    *float64          `json:"male_price"`
+	FemalePrice  *float64          `json:"female_price"`
+	Categories   []CategoryPrice   `json:"categories"`
+	EarlyBird    []EarlyBirdWindow `json:"early_bird"`
+	Installments []InstallmentRule `json:"installments"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// AmountDue prices a registration made at t. It returns nil for a nil
+// pricing (the event charges nothing through this service) and a
+// validation error for a category the event does not offer.
+func (p *EventPricing) AmountDue(category, gender string, t time.Time) (*float64, error) {
+	if p == nil {
+		return nil, nil
+	}
+	price := p.BasePrice
+	switch {
+	case gender == "male" && p.MalePrice != nil:
+		price = *p.MalePrice
+	case gender == "female" && p.FemalePrice != nil:
+		price = *p.FemalePrice
+	}
+	if category != "" && len(p.Categories) > 0 {
+		names := make([]string, len(p.Categories))
+		found := false
+		for i, c := range p.Categories {
+			names[i] = c.Category
+			if c.Category == category {
+				price, found = c.Price, true
+			}
+		}
+		if !found {
+			return nil, validation.Errors{{Field: "category", Message: "must be one of " + strings.Join(names, ", ")}}
+		}
+	}
+	if w := p.earlyBirdAt(t); w != nil {
+		price = price * float64(100-w.DiscountPercent) / 100
+	}
+	amount := math.Round(price*100) / 100
+	return &amount, nil
+}
+
+// earlyBirdAt returns the window open at t, the one closing soonest if
+// several are, or nil.
+func (p *EventPricing) earlyBirdAt(t time.Time) *EarlyBirdWindow {
+	var open *EarlyBirdWindow
+	for i, w := range p.EarlyBird {
+		if t.Before(w.EndsAt) && (open == nil || w.EndsAt.Before(open.EndsAt)) {
+			open = &p.EarlyBird[i]
+		}
+	}
+	return open
+}
+
+type UpsertEventPricingParams struct {
+	EventID      uuid.UUID
+	BasePrice    float64
+	MalePrice    *float64
+	FemalePrice  *float64
+	Categories   []CategoryPrice
+	EarlyBird    []EarlyBirdWindow
+	Installments []InstallmentRule
+}
+
+// maxPricingEntries bounds the categories and early-bird windows of a
+// pricing.
+const maxPricingEntries = 20
+
+func (p UpsertEventPricingParams) Validate() error {
+	var v validation.Validator
+	checkPrice := func(field string, price float64) {
+		v.Check(price >= 0, field, "must not be negative")
+		v.Check(price <= MaxAmount, field, fmt.Sprintf("must not exceed %.2f", MaxAmount))
+	}
+	checkPrice("base_price", p.BasePrice)
+	if p.MalePrice != nil {
+		checkPrice("male_price", *p.MalePrice)
+	}
+	if p.FemalePrice != nil {
+		checkPrice("female_price", *p.FemalePrice)
+	}
+
+	v.Check(len(p.Categories) <= maxPricingEntries, "categories", fmt.Sprintf("must have at most %d entries", maxPricingEntries))
+	seen := map[string]bool{}
+	for i, c := range p.Categories {
+		field := fmt.Sprintf("categories[%d]", i)
+		if v.Required(field+".category", c.Category) {
+			v.MaxLen(field+".category", c.Category, 50)
+			v.Check(!seen[c.Category], field+".category", "is used by another entry")
+		}
+		checkPrice(field+".price", c.Price)
+		seen[c.Category] = true
+	}
+
+	v.Check(len(p.EarlyBird) <= maxPricingEntries, "early_bird", fmt.Sprintf("must have at most %d entries", maxPricingEntries))
+	for i, w := range p.EarlyBird {
+		field := fmt.Sprintf("early_bird[%d]", i)
+		v.MaxLen(field+".name", w.Name, 50)
+		v.Check(!w.EndsAt.IsZero(), field+".ends_at", "is required")
+		v.Check(w.DiscountPercent > 0 && w.DiscountPercent <= 100, field+".discount_percent", "must be between 1 and 100")
+	}
+
+	v.Check(len(p.Installments) <= maxInstallments, "installments", fmt.Sprintf("must have at most %d entries", maxInstallments))
+	total := 0
+	for i, rule := range p.Installments {
+		field := fmt.Sprintf("installments[%d]", i)
+		v.Check(rule.Percent > 0 && rule.Percent <= 100, field+".percent", "must be between 1 and 100")
+		v.Check(!rule.DueAt.IsZero(), field+".due_at", "is required")
+		if i > 0 && !rule.DueAt.IsZero() {
+			v.Check(rule.DueAt.After(p.Installments[i-1].DueAt), field+".due_at", "must be after the previous installment")
+		}
+		total += rule.Percent
+	}
+	v.Check(len(p.Installments) == 0 || total == 100, "installments", "percents must add up to 100")
+	return v.Err()
+}
+
+// GetEventPricing returns an event's pricing, or nil if it has none.
+func (r *Postgres) GetEventPricing(ctx context.Context, eventID uuid.UUID) (*EventPricing, error) {
+	return getEventPricing(ctx, r.Pool, eventID)
+}
+
+func getEventPricing(ctx context.Context, q querier, eventID uuid.UUID) (*EventPricing, error) {
+	var p EventPricing
+	var categories, earlyBird, installments []byte
+	err := q.QueryRow(ctx, `
+		SELECT event_id, base_price, male_price, female_price, categories, early_bird, installments, updated_at
+		FROM event_pricing
+		WHERE event_id = $1
+	`, eventID).Scan(&p.EventID, &p.BasePrice, &p.MalePrice, &p.FemalePrice, &categories, &earlyBird, &installments, &p.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(categories, &p.Categories); err != nil {
+		return nil, fmt.Errorf("invalid price categories for event %s: %w", eventID, err)
+	}
+	if err := json.Unmarshal(earlyBird, &p.EarlyBird); err != nil {
+		return nil, fmt.Errorf("invalid early-bird windows for event %s: %w", eventID, err)
+	}
+	if err := json.Unmarshal(installments, &p.Installments); err != nil {
+		return nil, fmt.Errorf("invalid installment plan for event %s: %w", eventID, err)
+	}
+	return &p, nil
+}
+
+// UpsertEventPricing sets an event's pricing. It applies to registrations
+// created from now on; existing ones keep their amount_due and installments.
+func (r *Postgres) UpsertEventPricing(ctx context.Context, params UpsertEventPricingParams) (*EventPricing, error) {
+	p := EventPricing{
+		EventID:      params.EventID,
+		BasePrice:    params.BasePrice,
+		MalePrice:    params.MalePrice,
+		FemalePrice:  params.FemalePrice,
+		Categories:   params.Categories,
+		EarlyBird:    params.EarlyBird,
+		Installments: params.Installments,
+	}
+	if p.Categories == nil {
+		p.Categories = []CategoryPrice{}
+	}
+	if p.EarlyBird == nil {
+		p.EarlyBird = []EarlyBirdWindow{}
+	}
+	if p.Installments == nil {
+		p.Installments = []InstallmentRule{}
+	}
+	categories, err := json.Marshal(p.Categories)
+	if err != nil {
+		return nil, err
+	}
+	earlyBird, err := json.Marshal(p.EarlyBird)
+	if err != nil {
+		return nil, err
+	}
+	installments, err := json.Marshal(p.Installments)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Pool.QueryRow(ctx, `
+		INSERT INTO event_pricing (event_id, base_price, male_price, female_price, categories, early_bird, installments)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (event_id) DO UPDATE
+		SET base_price = EXCLUDED.base_price,
+			male_price = EXCLUDED.male_price,
+			female_price = EXCLUDED.female_price,
+			categories = EXCLUDED.categories,
+			early_bird = EXCLUDED.early_bird,
+			installments = EXCLUDED.installments,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`, params.EventID, params.BasePrice, params.MalePrice, params.FemalePrice, categories, earlyBird, installments).Scan(&p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Payment amount statuses, comparing what was paid with amount_due.
+const (
+	AmountExact     = "exact"
+	AmountUnderpaid = "underpaid"
+	AmountOverpaid  = "overpaid"
+)
+
+// AmountStatus compares a payment with a registration's amount_due, or
+// returns nil if nothing is due.
+func AmountStatus(paid float64, due *float64) *string {
+	if due == nil {
+		return nil
+	}
+	status := AmountExact
+	// Compare in cents to stay clear of float rounding
+	switch p, d := math.Round(paid*100), math.Round(*due*100); {
+	case p < d:
+		status = AmountUnderpaid
+	case p > d:
+		status = AmountOverpaid
+	}
+	return &status
+}
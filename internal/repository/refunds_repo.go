@@ -0,0 +1,361 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+// ErrNoPendingRefund is returned when a refund is marked processed but the
+// registration has none awaiting payout.
+var ErrNoPendingRefund = errors.New("no pending refund for registration")
+
+// RefundRule refunds Percent of what was paid when a registration is cancelled
+// at least DaysBefore days before the event starts.
+type RefundRule struct {
+	DaysBefore int `json:"days_before"`
+	Percent    int `json:"percent"`
+}
+
+// RefundPolicy is how much of the approved payments an event gives back on
+// cancellation, depending on how close to the start it happens.
+type RefundPolicy struct {
+	EventID       uuid.UUID    `json:"event_id"`
+	EventStartsAt time.Time    `json:"event_starts_at"`
+	Rules         []RefundRule `json:"rules"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// PercentAt returns the percentage refunded for a cancellation at t: that of
+// the applicable rule with the most days before the start, or 0 if none
+// applies. A nil policy refunds in full.
+func (p *RefundPolicy) PercentAt(t time.Time) int {
+	if p == nil {
+		return 100
+	}
+	left := p.EventStartsAt.Sub(t)
+	best, percent := -1, 0
+	for _, r := range p.Rules {
+		if r.DaysBefore > best && left >= time.Duration(r.DaysBefore)*24*time.Hour {
+			best, percent = r.DaysBefore, r.Percent
+		}
+	}
+	return percent
+}
+
+type UpsertRefundPolicyParams struct {
+	EventID       uuid.UUID
+	EventStartsAt time.Time
+	Rules         []RefundRule
+}
+
+// maxRefundRules bounds the size of a policy.
+const maxRefundRules = 20
+
+func (p UpsertRefundPolicyParams) Validate() error {
+	var v validation.Validator
+	v.Check(!p.EventStartsAt.IsZero(), "event_starts_at", "is required")
+	v.Check(len(p.Rules) <= maxRefundRules, "rules", fmt.Sprintf("must have at most %d entries", maxRefundRules))
+	seen := map[int]bool{}
+	for i, r := range p.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		v.Check(r.DaysBefore >= 0, field+".days_before", "must not be negative")
+		v.Check(!seen[r.DaysBefore], field+".days_before", "is used by another rule")
+		v.Check(r.Percent >= 0 && r.Percent <= 100, field+".percent", "must be between 0 and 100")
+		seen[r.DaysBefore] = true
+	}
+	return v.Err()
+}
+
+type Refund struct {
+	RefundID            uuid.UUID  `json:"refund_id"`
+	PaymentID           uuid.UUID  `json:"payment_id"`
+	RegistrationID      uuid.UUID  `json:"registration_id"`
+	EventID             uuid.UUID  `json:"event_id"`
+	Amount              float64    `json:"amount"`
+	Percent             int        `json:"percent"`
+	RefundType          string     `json:"refund_type"`
+	Status              string     `json:"status"`
+	RefundProofURL      *string    `json:"refund_proof_url"`
+	RefundProofFilename *string    `json:"refund_proof_filename"`
+	Notes               *string    `json:"notes"`
+	ProcessedBy         *uuid.UUID `json:"processed_by"`
+	ProcessedAt         *time.Time `json:"processed_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// refundAmount is percent of amount, rounded to the cent.
+func refundAmount(amount float64, percent int) float64 {
+	return math.Round(amount*float64(percent)) / 100
+}
+
+// refundType is "full" when the whole payment is returned.
+func refundType(percent int) string {
+	if percent >= 100 {
+		return "full"
+	}
+	return "partial"
+}
+
+const refundColumns = `refund_id, payment_id, registration_id, event_id, amount, percent,
+			refund_type, status, refund_proof_url, refund_proof_filename, notes,
+			processed_by, processed_at, created_at, updated_at`
+
+func scanRefund(row pgx.Row) (*Refund, error) {
+	var r Refund
+	err := row.Scan(
+		&r.RefundID, &r.PaymentID, &r.RegistrationID, &r.EventID, &r.Amount, &r.Percent,
+		&r.RefundType, &r.Status, &r.RefundProofURL, &r.RefundProofFilename, &r.Notes,
+		&r.ProcessedBy, &r.ProcessedAt, &r.CreatedAt, &r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// openRefund records the refund owed when reg has just been cancelled after
+// a payment was approved, sized by the event's refund policy against
+// everything reg paid, installments included. It is recorded against the
+// latest approved payment. Nothing is recorded when no payment was approved
+// or the policy refunds nothing.
+func openRefund(ctx context.Context, tx pgx.Tx, reg *Registration) error {
+	payment, err := scanPayment(tx.QueryRow(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments
+		WHERE registration_id = $1 AND verification_status = 'approved'
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, reg.RegistrationID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	policy, err := getRefundPolicy(ctx, tx, reg.EventID)
+	if err != nil {
+		return err
+	}
+	percent := policy.PercentAt(time.Now())
+	// An order member whose share of the transfer was nothing has nothing to refund
+	if percent <= 0 || refundAmount(reg.AmountPaid, percent) <= 0 {
+		return nil
+	}
+
+	refund, err := scanRefund(tx.QueryRow(ctx, `
+		INSERT INTO refunds (payment_id, registration_id, event_id, amount, percent, refund_type)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (payment_id) DO NOTHING
+		RETURNING `+refundColumns,
+		payment.PaymentID, reg.RegistrationID, reg.EventID, refundAmount(reg.AmountPaid, percent), percent, refundType(percent)))
+	if err != nil {
+		// The payment was already refunded
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	return auditRefund(ctx, tx, "refund.created", nil, refund)
+}
+
+// refundPayment records a full refund of a payment its registration did not
+// take, such as a gateway charge paid after the registration was cancelled.
+func refundPayment(ctx context.Context, tx pgx.Tx, payment *Payment, eventID uuid.UUID) error {
+	refund, err := scanRefund(tx.QueryRow(ctx, `
+		INSERT INTO refunds (payment_id, registration_id, event_id, amount, percent, refund_type)
+		VALUES ($1, $2, $3, $4, 100, $5)
+		RETURNING `+refundColumns,
+		payment.PaymentID, payment.RegistrationID, eventID, payment.Amount, refundType(100)))
+	if err != nil {
+		return err
+	}
+	return auditRefund(ctx, tx, "refund.created", nil, refund)
+}
+
+// GetRefundByRegistrationID returns the latest refund of a registration, or
+// nil if it has none.
+func (r *Postgres) GetRefundByRegistrationID(ctx context.Context, registrationID uuid.UUID) (*Refund, error) {
+	refund, err := scanRefund(r.Pool.QueryRow(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE registration_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, registrationID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return refund, nil
+}
+
+// RefundFilter selects an event's refunds. An empty Status matches any.
+type RefundFilter struct {
+	EventID uuid.UUID
+	Status  string
+	Limit   int
+}
+
+// ListRefunds returns the refunds of an event, oldest first, so pending
+// ones read as a work queue.
+func (r *Postgres) ListRefunds(ctx context.Context, filter RefundFilter) ([]*Refund, error) {
+	rows, err := r.Pool.Query(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE event_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at, refund_id
+		LIMIT $3
+	`, filter.EventID, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []*Refund{}
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+	return refunds, rows.Err()
+}
+
+type ProcessRefundParams struct {
+	RefundID            uuid.UUID
+	RegistrationID      uuid.UUID
+	ProcessedBy         *uuid.UUID
+	RefundProofURL      *string
+	RefundProofFilename *string
+	Notes               *string
+}
+
+// ProcessRefund marks a pending refund as paid out, with proof of the
+// transfer, and enqueues events in the same transaction.
+func (r *Postgres) ProcessRefund(ctx context.Context, params ProcessRefundParams, events ...OutboxMessage) (*Refund, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := scanRefund(tx.QueryRow(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE refund_id = $1 AND registration_id = $2 AND status = 'pending'
+		FOR UPDATE
+	`, params.RefundID, params.RegistrationID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNoPendingRefund
+		}
+		return nil, err
+	}
+
+	refund, err := scanRefund(tx.QueryRow(ctx, `
+		UPDATE refunds
+		SET status = 'processed',
+			refund_proof_url = $2,
+			refund_proof_filename = $3,
+			notes = $4,
+			processed_by = $5,
+			processed_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE refund_id = $1
+		RETURNING `+refundColumns,
+		before.RefundID, params.RefundProofURL, params.RefundProofFilename, params.Notes, params.ProcessedBy))
+	if err != nil {
+		return nil, err
+	}
+	if err := auditRefund(ctx, tx, "refund.processed", before, refund); err != nil {
+		return nil, err
+	}
+	if err := enqueueOutbox(ctx, tx, events); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// RefundProcessedEvent builds the payment.refunded message for refund.
+func RefundProcessedEvent(topic string, refund *Refund) OutboxMessage {
+	return Event(topic, refund.RegistrationID.String(), "payment.refunded", map[string]any{
+		"refund_id":        refund.RefundID,
+		"payment_id":       refund.PaymentID,
+		"registration_id":  refund.RegistrationID,
+		"event_id":         refund.EventID,
+		"amount":           refund.Amount,
+		"percent":          refund.Percent,
+		"refund_type":      refund.RefundType,
+		"refund_proof_url": refund.RefundProofURL,
+		"processed_by":     refund.ProcessedBy,
+		"timestamp":        time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// GetRefundPolicy returns an event's refund policy, or nil if it has none.
+func (r *Postgres) GetRefundPolicy(ctx context.Context, eventID uuid.UUID) (*RefundPolicy, error) {
+	return getRefundPolicy(ctx, r.Pool, eventID)
+}
+
+func getRefundPolicy(ctx context.Context, q querier, eventID uuid.UUID) (*RefundPolicy, error) {
+	var p RefundPolicy
+	var rules []byte
+	err := q.QueryRow(ctx, `
+		SELECT event_id, event_starts_at, rules, updated_at
+		FROM refund_policies
+		WHERE event_id = $1
+	`, eventID).Scan(&p.EventID, &p.EventStartsAt, &rules, &p.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(rules, &p.Rules); err != nil {
+		return nil, fmt.Errorf("invalid refund rules for event %s: %w", eventID, err)
+	}
+	return &p, nil
+}
+
+// UpsertRefundPolicy sets an event's refund policy. It applies to
+// cancellations from now on; refunds already opened keep their amount.
+func (r *Postgres) UpsertRefundPolicy(ctx context.Context, params UpsertRefundPolicyParams) (*RefundPolicy, error) {
+	rules := params.Rules
+	if rules == nil {
+		rules = []RefundRule{}
+	}
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	p := RefundPolicy{EventID: params.EventID, Rules: rules}
+	err = r.Pool.QueryRow(ctx, `
+		INSERT INTO refund_policies (event_id, event_starts_at, rules)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (event_id) DO UPDATE
+		SET event_starts_at = EXCLUDED.event_starts_at,
+			rules = EXCLUDED.rules,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING event_starts_at, updated_at
+	`, params.EventID, params.EventStartsAt.UTC(), raw).Scan(&p.EventStartsAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
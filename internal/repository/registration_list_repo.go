@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidSort is returned for an unknown sort key.
+var ErrInvalidSort = errors.New("invalid sort")
+
+// PaymentStatusNone filters registrations without any uploaded payment.
+const PaymentStatusNone = "none"
+
+// RegistrationFilter narrows ListRegistrations. Zero values are ignored.
+type RegistrationFilter struct {
+	EventID *uuid.UUID
+	UserID  *uuid.UUID
+	// OwnerID matches the registrations of that user and those they paid
+	// for as the payer of an order.
+	OwnerID  *uuid.UUID
+	Statuses []string
+	Gender   string
+	// RegisteredFrom is inclusive, RegisteredTo exclusive.
+	RegisteredFrom *time.Time
+	RegisteredTo   *time.Time
+	// PaymentStatus matches the verification status of the latest payment,
+	// or PaymentStatusNone for registrations without one.
+	PaymentStatus string
+}
+
+// RegistrationPageRequest selects the sort order and page. Sort is a key from
+// registrationSorts, optionally prefixed with "-" for descending order.
+type RegistrationPageRequest struct {
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+type RegistrationPage struct {
+	Items      []*Registration `json:"items"`
+	NextCursor *string         `json:"next_cursor"`
+	Total      int64           `json:"total"`
+}
+
+type sortKey struct {
+	column string
+	value  func(*Registration) any
+}
+
+// registrationSorts are the columns the list can be ordered by. Ties are
+// broken by registration_id so the keyset is unique.
+var registrationSorts = map[string]sortKey{
+	"created_at":        {"created_at", func(r *Registration) any { return r.CreatedAt }},
+	"updated_at":        {"updated_at", func(r *Registration) any { return r.UpdatedAt }},
+	"registration_date": {"registration_date", func(r *Registration) any { return r.RegistrationDate }},
+	"full_name":         {"full_name", func(r *Registration) any { return r.FullName }},
+}
+
+const defaultRegistrationSort = "-created_at"
+
+type cursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorValue renders a sort value for a cursor; timestamps keep full
+// precision so the keyset comparison is exact.
+func cursorValue(v any) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return v.(string)
+}
+
+// queryBuilder collects WHERE conditions and their positional arguments.
+type queryBuilder struct {
+	where []string
+	args  []any
+}
+
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *queryBuilder) add(cond string) {
+	b.where = append(b.where, cond)
+}
+
+func (b *queryBuilder) whereClause() string {
+	if len(b.where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.where, " AND ")
+}
+
+func (b *queryBuilder) filter(f RegistrationFilter) {
+	if f.EventID != nil {
+		b.add("event_id = " + b.arg(*f.EventID))
+	}
+	if f.UserID != nil {
+		b.add("user_id = " + b.arg(*f.UserID))
+	}
+	if f.OwnerID != nil {
+		owner := b.arg(*f.OwnerID)
+		b.add("(user_id = " + owner + " OR order_id IN (SELECT o.order_id FROM orders o WHERE o.payer_user_id = " + owner + "))")
+	}
+	if len(f.Statuses) > 0 {
+		b.add("status = ANY(" + b.arg(f.Statuses) + "::registration_status[])")
+	}
+	if f.Gender != "" {
+		b.add("gender = " + b.arg(f.Gender))
+	}
+	if f.RegisteredFrom != nil {
+		b.add("registration_date >= " + b.arg(*f.RegisteredFrom))
+	}
+	if f.RegisteredTo != nil {
+		b.add("registration_date < " + b.arg(*f.RegisteredTo))
+	}
+	switch f.PaymentStatus {
+	case "":
+	case PaymentStatusNone:
+		b.add("NOT EXISTS (SELECT 1 FROM payments p WHERE p.registration_id = registrations.registration_id)")
+	default:
+		b.add(`(SELECT p.verification_status FROM payments p
+			WHERE p.registration_id = registrations.registration_id
+			ORDER BY p.created_at DESC LIMIT 1) = ` + b.arg(f.PaymentStatus) + `::payment_verification_status`)
+	}
+}
+
+// ListRegistrations returns one page of registrations matching filter using
+// keyset pagination, along with the total number of matches.
+func (r *Postgres) ListRegistrations(ctx context.Context, filter RegistrationFilter, page RegistrationPageRequest) (*RegistrationPage, error) {
+	sort := page.Sort
+	if sort == "" {
+		sort = defaultRegistrationSort
+	}
+	desc := strings.HasPrefix(sort, "-")
+	key, ok := registrationSorts[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	var b queryBuilder
+	b.filter(filter)
+
+	var total int64
+	err := r.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM registrations `+b.whereClause(), b.args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp, dir := ">", "ASC"
+	if desc {
+		cmp, dir = "<", "DESC"
+	}
+	if page.Cursor != "" {
+		c, err := decodeCursor(page.Cursor)
+		if err != nil || c.Sort != sort {
+			return nil, ErrInvalidCursor
+		}
+		var value any = c.Value
+		if _, isTime := key.value(&Registration{}).(time.Time); isTime {
+			t, err := time.Parse(time.RFC3339Nano, c.Value)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			value = t
+		}
+		b.add("(" + key.column + ", registration_id) " + cmp + " (" + b.arg(value) + ", " + b.arg(c.ID) + ")")
+	}
+
+	query := `
+		SELECT ` + registrationColumns + `
+		FROM registrations
+		` + b.whereClause() + `
+		ORDER BY ` + key.column + ` ` + dir + `, registration_id ` + dir + `
+		LIMIT ` + b.arg(page.Limit+1)
+
+	rows, err := r.Pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanRegistrations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RegistrationPage{Items: items, Total: total}
+	if result.Items == nil {
+		result.Items = []*Registration{}
+	}
+	// One extra row was fetched to know whether another page exists
+	if len(items) > page.Limit {
+		result.Items = items[:page.Limit]
+		last := result.Items[page.Limit-1]
+		next := encodeCursor(cursor{Sort: sort, Value: cursorValue(key.value(last)), ID: last.RegistrationID})
+		result.NextCursor = &next
+	}
+	return result, nil
+}
@@ -2,157 +2,339 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/statemachine"
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
 )
 
+// ErrRegistrationNotFound is returned by mutations targeting a registration
+// that does not exist.
+var ErrRegistrationNotFound = errors.New("registration not found")
+
 type Registration struct {
-	RegistrationID          uuid.UUID  `json:"registration_id"`
-	EventID                 uuid.UUID  `json:"event_id"`
-	UserID                  *uuid.UUID `json:"user_id"`
-	FullName                string     `json:"full_name"`
-	Gender                  string     `json:"gender"`
-	Phone                   string     `json:"phone"`
-	Email                   string     `json:"email"`
-	Address                 *string    `json:"address"`
-	EmergencyContactName    *string    `json:"emergency_contact_name"`
-	EmergencyContactPhone   *string    `json:"emergency_contact_phone"`
-	EmergencyContactRelation *string   `json:"emergency_contact_relation"`
-	SpecialNeeds            *string    `json:"special_needs"`
-	RegistrationDate        time.Time  `json:"registration_date"`
-	Status                  string     `json:"status"`
-	CancelledAt             *time.Time `json:"cancelled_at"`
-	CancellationReason      *string    `json:"cancellation_reason"`
-	Notes                   *string    `json:"notes"`
-	CreatedAt               time.Time  `json:"created_at"`
-	UpdatedAt               time.Time  `json:"updated_at"`
+	RegistrationID           uuid.UUID     `json:"registration_id"`
+	EventID                  uuid.UUID     `json:"event_id"`
+	UserID                   *uuid.UUID    `json:"user_id"`
+	FullName                 string        `json:"full_name"`
+	Gender                   string        `json:"gender"`
+	Category                 *string       `json:"category"`
+	Phone                    string        `json:"phone"`
+	Email                    string        `json:"email"`
+	Address                  *string       `json:"address"`
+	EmergencyContactName     *string       `json:"emergency_contact_name"`
+	EmergencyContactPhone    *string       `json:"emergency_contact_phone"`
+	EmergencyContactRelation *string       `json:"emergency_contact_relation"`
+	SpecialNeeds             *string       `json:"special_needs"`
+	RegistrationDate         time.Time     `json:"registration_date"`
+	Status                   string        `json:"status"`
+	WaitlistPosition         *int          `json:"waitlist_position"`
+	PaymentDueAt             *time.Time    `json:"payment_due_at"`
+	AmountDue                *float64      `json:"amount_due"`
+	VoucherCode              *string       `json:"voucher_code"`
+	DiscountAmount           *float64      `json:"discount_amount"`
+	AmountPaid               float64       `json:"amount_paid"`
+	Balance                  *float64      `json:"balance"`
+	Installments             []Installment `json:"installments"`
+	OrderID                  *uuid.UUID    `json:"order_id"`
+	CancelledAt              *time.Time    `json:"cancelled_at"`
+	CancellationReason       *string       `json:"cancellation_reason"`
+	Notes                    *string       `json:"notes"`
+	CreatedAt                time.Time     `json:"created_at"`
+	UpdatedAt                time.Time     `json:"updated_at"`
 }
 
 type CreateRegistrationParams struct {
-	EventID                 uuid.UUID
-	UserID                  *uuid.UUID
-	FullName                string
-	Gender                  string
-	Phone                   string
-	Email                   string
-	Address                 *string
-	EmergencyContactName    *string
-	EmergencyContactPhone   *string
+	RegistrationID           uuid.UUID
+	EventID                  uuid.UUID
+	UserID                   *uuid.UUID
+	FullName                 string
+	Gender                   string
+	Category                 string
+	Phone                    string
+	Email                    string
+	Address                  *string
+	EmergencyContactName     *string
+	EmergencyContactPhone    *string
 	EmergencyContactRelation *string
-	SpecialNeeds            *string
+	SpecialNeeds             *string
+	VoucherCode              string
+}
+
+// Validate applies the rules every new registration must satisfy, whether it
+// comes from the API or a bulk import.
+func (p CreateRegistrationParams) Validate() error {
+	var v validation.Validator
+	v.Check(p.EventID != uuid.Nil, "event_id", "is required")
+	if v.Required("full_name", p.FullName) {
+		v.MaxLen("full_name", p.FullName, 255)
+	}
+	if v.Required("gender", p.Gender) {
+		v.OneOf("gender", p.Gender, "male", "female")
+	}
+	v.MaxLen("category", p.Category, 50)
+	if v.Required("phone", p.Phone) {
+		v.MaxLen("phone", p.Phone, 20)
+		v.Phone("phone", p.Phone)
+	}
+	if v.Required("email", p.Email) {
+		v.MaxLen("email", p.Email, 255)
+		v.Email("email", p.Email)
+	}
+	validateEmergencyContact(&v, p.EmergencyContactName, p.EmergencyContactPhone, p.EmergencyContactRelation)
+	v.MaxLen("voucher_code", p.VoucherCode, 50)
+	return v.Err()
+}
+
+// validateEmergencyContact checks the optional emergency contact fields
+// shared by create and update.
+func validateEmergencyContact(v *validation.Validator, name, phone, relation *string) {
+	if name != nil {
+		v.MaxLen("emergency_contact_name", *name, 255)
+	}
+	if phone != nil && *phone != "" {
+		v.MaxLen("emergency_contact_phone", *phone, 20)
+		v.Phone("emergency_contact_phone", *phone)
+	}
+	if relation != nil {
+		v.MaxLen("emergency_contact_relation", *relation, 100)
+	}
+}
+
+// RegistrationCreatedEvent builds the registration.created message for reg.
+func RegistrationCreatedEvent(topic string, reg *Registration) OutboxMessage {
+	return Event(topic, reg.RegistrationID.String(), "registration.created", map[string]any{
+		"registration_id":   reg.RegistrationID,
+		"event_id":          reg.EventID,
+		"user_id":           reg.UserID,
+		"full_name":         reg.FullName,
+		"gender":            reg.Gender,
+		"category":          reg.Category,
+		"amount_due":        reg.AmountDue,
+		"voucher_code":      reg.VoucherCode,
+		"order_id":          reg.OrderID,
+		"status":            reg.Status,
+		"waitlist_position": reg.WaitlistPosition,
+		"timestamp":         time.Now().UTC().Format(time.RFC3339),
+	})
 }
 
 type UpdateRegistrationParams struct {
-	RegistrationID          uuid.UUID
-	FullName                *string
-	Phone                   *string
-	Email                   *string
-	Address                 *string
-	EmergencyContactName    *string
-	EmergencyContactPhone   *string
+	RegistrationID           uuid.UUID
+	FullName                 *string
+	Phone                    *string
+	Email                    *string
+	Address                  *string
+	EmergencyContactName     *string
+	EmergencyContactPhone    *string
 	EmergencyContactRelation *string
-	SpecialNeeds            *string
-	Notes                   *string
+	SpecialNeeds             *string
+	Notes                    *string
 }
 
-func (r *Postgres) CreateRegistration(ctx context.Context, params CreateRegistrationParams) (*Registration, error) {
-	query := `
-		INSERT INTO registrations (
-			event_id, user_id, full_name, gender, phone, email,
-			address, emergency_contact_name, emergency_contact_phone,
-			emergency_contact_relation, special_needs
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING registration_id, event_id, user_id, full_name, gender, phone, email,
+// Validate checks the fields being changed. Required fields may be changed
+// but not cleared.
+func (p UpdateRegistrationParams) Validate() error {
+	var v validation.Validator
+	if p.FullName != nil && v.Required("full_name", *p.FullName) {
+		v.MaxLen("full_name", *p.FullName, 255)
+	}
+	if p.Phone != nil && v.Required("phone", *p.Phone) {
+		v.MaxLen("phone", *p.Phone, 20)
+		v.Phone("phone", *p.Phone)
+	}
+	if p.Email != nil && v.Required("email", *p.Email) {
+		v.MaxLen("email", *p.Email, 255)
+		v.Email("email", *p.Email)
+	}
+	validateEmergencyContact(&v, p.EmergencyContactName, p.EmergencyContactPhone, p.EmergencyContactRelation)
+	return v.Err()
+}
+
+const registrationColumns = `registration_id, event_id, user_id, full_name, gender, category, phone, email,
 			address, emergency_contact_name, emergency_contact_phone,
 			emergency_contact_relation, special_needs, registration_date,
-			status, cancelled_at, cancellation_reason, notes, created_at, updated_at
-	`
+			status, waitlist_position, payment_due_at, amount_due, voucher_code,
+			discount_amount, amount_paid, balance, installments, order_id, cancelled_at, cancellation_reason, notes, created_at, updated_at`
+
+// qualify prefixes each column in a comma-separated list with alias, for
+// queries where an unqualified name would be ambiguous.
+func qualify(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, col := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(col)
+	}
+	return strings.Join(parts, ", ")
+}
 
-	var reg Registration
-	err := r.Pool.QueryRow(ctx, query,
-		params.EventID, params.UserID, params.FullName, params.Gender,
-		params.Phone, params.Email, params.Address, params.EmergencyContactName,
-		params.EmergencyContactPhone, params.EmergencyContactRelation, params.SpecialNeeds,
-	).Scan(
+// registrationFields returns scan destinations matching registrationColumns.
+func registrationFields(reg *Registration) []any {
+	return []any{
 		&reg.RegistrationID, &reg.EventID, &reg.UserID, &reg.FullName, &reg.Gender,
-		&reg.Phone, &reg.Email, &reg.Address, &reg.EmergencyContactName,
+		&reg.Category, &reg.Phone, &reg.Email, &reg.Address, &reg.EmergencyContactName,
 		&reg.EmergencyContactPhone, &reg.EmergencyContactRelation, &reg.SpecialNeeds,
-		&reg.RegistrationDate, &reg.Status, &reg.CancelledAt, &reg.CancellationReason,
-		&reg.Notes, &reg.CreatedAt, &reg.UpdatedAt,
-	)
+		&reg.RegistrationDate, &reg.Status, &reg.WaitlistPosition, &reg.PaymentDueAt,
+		&reg.AmountDue, &reg.VoucherCode, &reg.DiscountAmount, &reg.AmountPaid, &reg.Balance,
+		&reg.Installments, &reg.OrderID, &reg.CancelledAt,
+		&reg.CancellationReason, &reg.Notes, &reg.CreatedAt, &reg.UpdatedAt,
+	}
+}
 
-	if err != nil {
+func scanRegistration(row pgx.Row) (*Registration, error) {
+	var reg Registration
+	if err := row.Scan(registrationFields(&reg)...); err != nil {
 		return nil, err
 	}
-
 	return &reg, nil
 }
 
-func (r *Postgres) GetRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*Registration, error) {
-	query := `
-		SELECT registration_id, event_id, user_id, full_name, gender, phone, email,
-			address, emergency_contact_name, emergency_contact_phone,
-			emergency_contact_relation, special_needs, registration_date,
-			status, cancelled_at, cancellation_reason, notes, created_at, updated_at
-		FROM registrations
-		WHERE registration_id = $1
-	`
+func scanRegistrations(rows pgx.Rows) ([]*Registration, error) {
+	defer rows.Close()
 
-	var reg Registration
-	err := r.Pool.QueryRow(ctx, query, registrationID).Scan(
-		&reg.RegistrationID, &reg.EventID, &reg.UserID, &reg.FullName, &reg.Gender,
-		&reg.Phone, &reg.Email, &reg.Address, &reg.EmergencyContactName,
-		&reg.EmergencyContactPhone, &reg.EmergencyContactRelation, &reg.SpecialNeeds,
-		&reg.RegistrationDate, &reg.Status, &reg.CancelledAt, &reg.CancellationReason,
-		&reg.Notes, &reg.CreatedAt, &reg.UpdatedAt,
-	)
+	var registrations []*Registration
+	for rows.Next() {
+		reg, err := scanRegistration(rows)
+		if err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, reg)
+	}
 
+	return registrations, rows.Err()
+}
+
+// CreateRegistration inserts a registration and enqueues the events built by
+// events in the same transaction. A nil params.RegistrationID lets the
+// database generate one. Pending registrations get a payment deadline; when
+// the event's capacity is exhausted the registration is placed on the
+// waitlist instead. A voucher code is redeemed in the same transaction and
+// its discount taken off amount_due. When the event has an installment plan
+// the payment deadline is that of the first installment.
+func (r *Postgres) CreateRegistration(ctx context.Context, params CreateRegistrationParams, events func(*Registration) []OutboxMessage) (*Registration, error) {
+	tx, err := r.Pool.Begin(ctx)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, nil
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	reg, err := r.createRegistration(ctx, tx, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	if events != nil {
+		if err := enqueueOutbox(ctx, tx, events(reg)); err != nil {
+			return nil, err
 		}
+	}
+	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
 
-	return &reg, nil
+	return reg, nil
 }
 
-func (r *Postgres) ListRegistrations(ctx context.Context, limit, offset int) ([]*Registration, error) {
+// createRegistration does the work of CreateRegistration inside tx, placing
+// the registration in orderID if it is not nil.
+func (r *Postgres) createRegistration(ctx context.Context, tx pgx.Tx, params CreateRegistrationParams, orderID *uuid.UUID) (*Registration, error) {
 	query := `
-		SELECT registration_id, event_id, user_id, full_name, gender, phone, email,
+		INSERT INTO registrations (
+			registration_id, event_id, user_id, full_name, gender, phone, email,
 			address, emergency_contact_name, emergency_contact_phone,
-			emergency_contact_relation, special_needs, registration_date,
-			status, cancelled_at, cancellation_reason, notes, created_at, updated_at
-		FROM registrations
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
-	`
+			emergency_contact_relation, special_needs, status, waitlist_position,
+			payment_due_at, category, amount_due, voucher_code, discount_amount, order_id
+		) VALUES (
+			COALESCE($1, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+			CASE WHEN $14::int IS NULL THEN ` + paymentDueAt("$2", "$15") + ` END,
+			NULLIF($16, ''), $17, $18, $19, $20
+		)
+		RETURNING ` + registrationColumns
+
+	var registrationID *uuid.UUID
+	if params.RegistrationID != uuid.Nil {
+		registrationID = &params.RegistrationID
+	}
 
-	rows, err := r.Pool.Query(ctx, query, limit, offset)
+	pricing, err := getEventPricing(ctx, tx, params.EventID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	amountDue, err := pricing.AmountDue(params.Category, params.Gender, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var voucher *Voucher
+	var voucherCode *string
+	var discount *float64
+	if code := NormalizeVoucherCode(params.VoucherCode); code != "" {
+		v, d, err := redeemVoucher(ctx, tx, code, params.EventID, params.Email, amountDue)
+		if err != nil {
+			return nil, err
+		}
+		due := math.Round((*amountDue-d)*100) / 100
+		voucher, voucherCode, discount, amountDue = v, &v.Code, &d, &due
+	}
 
-	var registrations []*Registration
-	for rows.Next() {
-		var reg Registration
-		err := rows.Scan(
-			&reg.RegistrationID, &reg.EventID, &reg.UserID, &reg.FullName, &reg.Gender,
-			&reg.Phone, &reg.Email, &reg.Address, &reg.EmergencyContactName,
-			&reg.EmergencyContactPhone, &reg.EmergencyContactRelation, &reg.SpecialNeeds,
-			&reg.RegistrationDate, &reg.Status, &reg.CancelledAt, &reg.CancellationReason,
-			&reg.Notes, &reg.CreatedAt, &reg.UpdatedAt,
-		)
+	status := statemachine.Pending
+	var waitlistPosition *int
+	err = checkSeat(ctx, tx, params.EventID, params.Gender)
+	switch {
+	case errors.Is(err, ErrEventFull), errors.Is(err, ErrGenderQuotaFull):
+		pos, err := nextWaitlistPosition(ctx, tx, params.EventID)
 		if err != nil {
 			return nil, err
 		}
-		registrations = append(registrations, &reg)
+		status = statemachine.Waitlisted
+		waitlistPosition = &pos
+	case err != nil:
+		return nil, err
 	}
 
-	return registrations, nil
+	reg, err := scanRegistration(tx.QueryRow(ctx, query,
+		registrationID, params.EventID, params.UserID, params.FullName, params.Gender,
+		params.Phone, params.Email, params.Address, params.EmergencyContactName,
+		params.EmergencyContactPhone, params.EmergencyContactRelation, params.SpecialNeeds,
+		string(status), waitlistPosition, r.DefaultPaymentWindowHours,
+		params.Category, amountDue, voucherCode, discount, orderID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if reg, err = scheduleInstallments(ctx, tx, reg, pricing); err != nil {
+		return nil, err
+	}
+	if voucher != nil {
+		if err := recordRedemption(ctx, tx, voucher, reg); err != nil {
+			return nil, err
+		}
+	}
+	if err := auditRegistration(ctx, tx, "registration.created", nil, reg); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+func (r *Postgres) GetRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*Registration, error) {
+	query := `
+		SELECT ` + registrationColumns + `
+		FROM registrations
+		WHERE registration_id = $1
+	`
+
+	reg, err := scanRegistration(r.Pool.QueryRow(ctx, query, registrationID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return reg, nil
 }
 
 func (r *Postgres) UpdateRegistration(ctx context.Context, params UpdateRegistrationParams) (*Registration, error) {
@@ -169,129 +351,174 @@ func (r *Postgres) UpdateRegistration(ctx context.Context, params UpdateRegistra
 			notes = COALESCE($10, notes),
 			updated_at = CURRENT_TIMESTAMP
 		WHERE registration_id = $1
-		RETURNING registration_id, event_id, user_id, full_name, gender, phone, email,
-			address, emergency_contact_name, emergency_contact_phone,
-			emergency_contact_relation, special_needs, registration_date,
-			status, cancelled_at, cancellation_reason, notes, created_at, updated_at
-	`
+		RETURNING ` + registrationColumns
 
-	var reg Registration
-	err := r.Pool.QueryRow(ctx, query,
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockRegistration(ctx, tx, params.RegistrationID)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	reg, err := scanRegistration(tx.QueryRow(ctx, query,
 		params.RegistrationID, params.FullName, params.Phone, params.Email,
 		params.Address, params.EmergencyContactName, params.EmergencyContactPhone,
 		params.EmergencyContactRelation, params.SpecialNeeds, params.Notes,
-	).Scan(
-		&reg.RegistrationID, &reg.EventID, &reg.UserID, &reg.FullName, &reg.Gender,
-		&reg.Phone, &reg.Email, &reg.Address, &reg.EmergencyContactName,
-		&reg.EmergencyContactPhone, &reg.EmergencyContactRelation, &reg.SpecialNeeds,
-		&reg.RegistrationDate, &reg.Status, &reg.CancelledAt, &reg.CancellationReason,
-		&reg.Notes, &reg.CreatedAt, &reg.UpdatedAt,
-	)
-
+	))
 	if err != nil {
 		return nil, err
 	}
-
-	return &reg, nil
+	if err := auditRegistration(ctx, tx, "registration.updated", before, reg); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return reg, nil
 }
 
-func (r *Postgres) CancelRegistration(ctx context.Context, registrationID uuid.UUID, reason string) error {
+// CancelRegistration cancels a registration, opens a refund if its payment
+// was approved, gives back its voucher use and, if that frees a seat,
+// promotes the next waitlisted registrant, all in the same transaction.
+func (r *Postgres) CancelRegistration(ctx context.Context, registrationID uuid.UUID, reason string, events ...OutboxMessage) error {
 	query := `
 		UPDATE registrations
 		SET status = 'cancelled',
+			waitlist_position = NULL,
 			cancelled_at = CURRENT_TIMESTAMP,
 			cancellation_reason = $2,
 			updated_at = CURRENT_TIMESTAMP
-		WHERE registration_id = $1
-	`
+		WHERE registration_id = $1 AND status = ANY($3::registration_status[])
+		RETURNING ` + registrationColumns
 
-	_, err := r.Pool.Exec(ctx, query, registrationID, reason)
-	return err
-}
-
-func (r *Postgres) UpdateRegistrationStatus(ctx context.Context, registrationID uuid.UUID, status string) error {
-	query := `
-		UPDATE registrations
-		SET status = $2,
-			updated_at = CURRENT_TIMESTAMP
-		WHERE registration_id = $1
-	`
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
-	_, err := r.Pool.Exec(ctx, query, registrationID, status)
-	return err
+	before, err := lockRegistration(ctx, tx, registrationID)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrRegistrationNotFound
+	}
+	reg, err := scanRegistration(tx.QueryRow(ctx, query, registrationID, reason, statemachine.Sources(statemachine.Cancelled)))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return transitionError(ctx, tx, registrationID, statemachine.Cancelled)
+		}
+		return err
+	}
+	if err := auditRegistration(ctx, tx, "registration.cancelled", before, reg); err != nil {
+		return err
+	}
+	if err := openRefund(ctx, tx, reg); err != nil {
+		return err
+	}
+	if err := releaseVouchers(ctx, tx, []uuid.UUID{reg.RegistrationID}); err != nil {
+		return err
+	}
+	if err := enqueueOutbox(ctx, tx, events); err != nil {
+		return err
+	}
+	if _, err := r.promoteWaitlisted(ctx, tx, reg.EventID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-func (r *Postgres) GetRegistrationsByEventID(ctx context.Context, eventID uuid.UUID, limit, offset int) ([]*Registration, error) {
-	query := `
-		SELECT registration_id, event_id, user_id, full_name, gender, phone, email,
-			address, emergency_contact_name, emergency_contact_phone,
-			emergency_contact_relation, special_needs, registration_date,
-			status, cancelled_at, cancellation_reason, notes, created_at, updated_at
-		FROM registrations
-		WHERE event_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+// StatusChangeCancelReason is recorded on registrations cancelled by an
+// event.status.changed message.
+const StatusChangeCancelReason = "cancelled by event status change"
 
-	rows, err := r.Pool.Query(ctx, query, eventID, limit, offset)
+// UpdateRegistrationStatus moves a registration to status, returning a
+// *statemachine.TransitionError if its current status does not allow it and
+// ErrWaitlistPromotion for a waitlisted registration sent to pending. A
+// cancellation records reason, as CancelRegistration does.
+func (r *Postgres) UpdateRegistrationStatus(ctx context.Context, registrationID uuid.UUID, status statemachine.Status, reason string) error {
+	tx, err := r.Pool.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	var registrations []*Registration
-	for rows.Next() {
-		var reg Registration
-		err := rows.Scan(
-			&reg.RegistrationID, &reg.EventID, &reg.UserID, &reg.FullName, &reg.Gender,
-			&reg.Phone, &reg.Email, &reg.Address, &reg.EmergencyContactName,
-			&reg.EmergencyContactPhone, &reg.EmergencyContactRelation, &reg.SpecialNeeds,
-			&reg.RegistrationDate, &reg.Status, &reg.CancelledAt, &reg.CancellationReason,
-			&reg.Notes, &reg.CreatedAt, &reg.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		registrations = append(registrations, &reg)
+	if _, err := r.updateStatus(ctx, tx, registrationID, status, reason); err != nil {
+		return err
 	}
-
-	return registrations, nil
+	return tx.Commit(ctx)
 }
 
-func (r *Postgres) GetRegistrationsByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*Registration, error) {
+// updateStatus applies a guarded status change inside tx. Moving a
+// registration to cancelled or rejected releases its seat to the waitlist
+// and its voucher use; cancelling also stamps cancelled_at with
+// cancelReason and opens a refund for an approved payment. It returns the
+// registration as updated.
+func (r *Postgres) updateStatus(ctx context.Context, tx pgx.Tx, registrationID uuid.UUID, status statemachine.Status, cancelReason string) (*Registration, error) {
 	query := `
-		SELECT registration_id, event_id, user_id, full_name, gender, phone, email,
-			address, emergency_contact_name, emergency_contact_phone,
-			emergency_contact_relation, special_needs, registration_date,
-			status, cancelled_at, cancellation_reason, notes, created_at, updated_at
-		FROM registrations
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+		UPDATE registrations
+		SET status = $2,
+			waitlist_position = NULL,
+			cancelled_at = CASE WHEN $2 = 'cancelled' THEN CURRENT_TIMESTAMP ELSE cancelled_at END,
+			cancellation_reason = CASE WHEN $2 = 'cancelled' THEN $4 ELSE cancellation_reason END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE registration_id = $1 AND status = ANY($3::registration_status[])
+		RETURNING ` + registrationColumns
 
-	rows, err := r.Pool.Query(ctx, query, userID, limit, offset)
+	before, err := lockRegistration(ctx, tx, registrationID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	if before == nil {
+		return nil, ErrRegistrationNotFound
+	}
+	if before.Status == string(statemachine.Waitlisted) && status == statemachine.Pending {
+		return nil, ErrWaitlistPromotion
+	}
+	reg, err := scanRegistration(tx.QueryRow(ctx, query, registrationID, string(status), statemachine.Sources(status), cancelReason))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, transitionError(ctx, tx, registrationID, status)
+		}
+		return nil, err
+	}
+	if err := auditRegistration(ctx, tx, "registration.status_changed", before, reg); err != nil {
+		return nil, err
+	}
 
-	var registrations []*Registration
-	for rows.Next() {
-		var reg Registration
-		err := rows.Scan(
-			&reg.RegistrationID, &reg.EventID, &reg.UserID, &reg.FullName, &reg.Gender,
-			&reg.Phone, &reg.Email, &reg.Address, &reg.EmergencyContactName,
-			&reg.EmergencyContactPhone, &reg.EmergencyContactRelation, &reg.SpecialNeeds,
-			&reg.RegistrationDate, &reg.Status, &reg.CancelledAt, &reg.CancellationReason,
-			&reg.Notes, &reg.CreatedAt, &reg.UpdatedAt,
-		)
-		if err != nil {
+	if status == statemachine.Cancelled {
+		if err := openRefund(ctx, tx, reg); err != nil {
 			return nil, err
 		}
-		registrations = append(registrations, &reg)
 	}
-
-	return registrations, nil
+	if status == statemachine.Cancelled || status == statemachine.Rejected {
+		if err := releaseVouchers(ctx, tx, []uuid.UUID{reg.RegistrationID}); err != nil {
+			return nil, err
+		}
+		if _, err := r.promoteWaitlisted(ctx, tx, reg.EventID); err != nil {
+			return nil, err
+		}
+	}
+	return reg, nil
 }
 
+// transitionError explains why a guarded status update matched no rows:
+// either the registration does not exist or its status forbids the move.
+func transitionError(ctx context.Context, q querier, registrationID uuid.UUID, to statemachine.Status) error {
+	var current string
+	err := q.QueryRow(ctx, `SELECT status FROM registrations WHERE registration_id = $1`, registrationID).Scan(&current)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrRegistrationNotFound
+		}
+		return err
+	}
+	return &statemachine.TransitionError{From: statemachine.Status(current), To: to}
+}
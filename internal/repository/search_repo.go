@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+type RegistrationSearchParams struct {
+	Query   string
+	EventID *uuid.UUID
+	Limit   int
+}
+
+type RegistrationSearchResult struct {
+	*Registration
+	Rank float64 `json:"rank"`
+}
+
+// SearchRegistrations finds registrations by partial name, email or phone
+// number. Whole words are matched through the full-text index, fragments and
+// typos through trigram similarity, and phone numbers in either 08xx or
+// +628xx form through the normalized phone column. Results are ordered by
+// rank, best match first.
+func (r *Postgres) SearchRegistrations(ctx context.Context, params RegistrationSearchParams) ([]*RegistrationSearchResult, error) {
+	q := strings.TrimSpace(params.Query)
+	phone := searchPhone(q)
+
+	query := `
+		WITH input AS (
+			SELECT to_tsquery('simple', NULLIF($1, '')) AS tsq,
+				$2::text AS term,
+				'%' || $3::text || '%' AS pattern,
+				NULLIF($4::text, '') AS phone
+		)
+		SELECT ` + qualify("r", registrationColumns) + `,
+			(COALESCE(ts_rank(r.search_vector, i.tsq), 0)
+				+ word_similarity(i.term, r.full_name)
+				+ similarity(i.term, r.email)
+				+ CASE
+					WHEN r.phone_normalized = i.phone THEN 1
+					WHEN r.phone_normalized LIKE '%' || i.phone || '%' THEN 0.5
+					ELSE 0
+				END)::float8 AS rank
+		FROM registrations r, input i
+		WHERE ($5::uuid IS NULL OR r.event_id = $5)
+			AND (r.search_vector @@ i.tsq
+				OR r.full_name ILIKE i.pattern
+				OR r.email ILIKE i.pattern
+				OR i.term <% r.full_name
+				OR r.phone_normalized LIKE '%' || i.phone || '%')
+		ORDER BY rank DESC, r.full_name, r.registration_id
+		LIMIT $6
+	`
+
+	rows, err := r.Pool.Query(ctx, query, prefixTSQuery(q), q, escapeLike(q), phone, params.EventID, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*RegistrationSearchResult{}
+	for rows.Next() {
+		var reg Registration
+		var res RegistrationSearchResult
+		if err := rows.Scan(append(registrationFields(&reg), &res.Rank)...); err != nil {
+			return nil, err
+		}
+		res.Registration = &reg
+		results = append(results, &res)
+	}
+	return results, rows.Err()
+}
+
+// prefixTSQuery turns free text into a tsquery where every word is matched
+// as a prefix, e.g. "ahmad fau" becomes "ahmad:* & fau:*". Punctuation is
+// dropped so user input can never produce a tsquery syntax error.
+func prefixTSQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// searchPhone returns q in the form stored in registrations.phone_normalized
+// when it looks like a (partial) phone number, or "" otherwise. A leading 0
+// or +62 is folded to 62; other digit runs are kept as-is so a fragment from
+// the middle of a number still matches.
+func searchPhone(q string) string {
+	var digits strings.Builder
+	for _, r := range q {
+		switch {
+		case unicode.IsDigit(r):
+			digits.WriteRune(r)
+		case r == '+' || r == '-' || r == ' ' || r == '(' || r == ')' || r == '.':
+		default:
+			return ""
+		}
+	}
+	d := digits.String()
+	if len(d) < 4 {
+		return ""
+	}
+	if strings.HasPrefix(d, "0") {
+		return "62" + d[1:]
+	}
+	return d
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The store interfaces describe what the HTTP handlers and background
+// workers need from persistence. Postgres implements all of them for
+// production and Memory for tests.
+
+// RegistrationStore reads and changes registrations. GetOrder looks up the
+// order a member registration belongs to, whose payer acts for it.
+type RegistrationStore interface {
+	CreateRegistration(ctx context.Context, params CreateRegistrationParams, events func(*Registration) []OutboxMessage) (*Registration, error)
+	GetRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*Registration, error)
+	GetOrder(ctx context.Context, orderID uuid.UUID) (*Order, error)
+	UpdateRegistration(ctx context.Context, params UpdateRegistrationParams) (*Registration, error)
+	CancelRegistration(ctx context.Context, registrationID uuid.UUID, reason string, events ...OutboxMessage) error
+	ListRegistrations(ctx context.Context, filter RegistrationFilter, page RegistrationPageRequest) (*RegistrationPage, error)
+	SearchRegistrations(ctx context.Context, params RegistrationSearchParams) ([]*RegistrationSearchResult, error)
+	ListAuditEvents(ctx context.Context, registrationID uuid.UUID) ([]*AuditEvent, error)
+}
+
+// PaymentStore records payment uploads and their verification.
+type PaymentStore interface {
+	CreatePayment(ctx context.Context, params CreatePaymentParams, events ...OutboxMessage) (*Payment, error)
+	GetLatestPaymentByRegistrationID(ctx context.Context, registrationID uuid.UUID) (*Payment, error)
+	ListPaymentsByRegistrationID(ctx context.Context, registrationID uuid.UUID) ([]*Payment, error)
+	VerifyPayment(ctx context.Context, params VerifyPaymentParams, events func(*Payment, *Registration) []OutboxMessage) (*Payment, error)
+}
+
+// ChargeStore records payments requested through a payment gateway and the
+// webhooks that settle them.
+type ChargeStore interface {
+	GetRegistrationByID(ctx context.Context, registrationID uuid.UUID) (*Registration, error)
+	GetOrder(ctx context.Context, orderID uuid.UUID) (*Order, error)
+	CreateCharge(ctx context.Context, params CreateChargeParams) (*Charge, error)
+	ListChargesByRegistrationID(ctx context.Context, registrationID uuid.UUID) ([]*Charge, error)
+	ApplyChargeWebhook(ctx context.Context, params ChargeWebhookParams, events func(*Payment, *Registration) []OutboxMessage) (*Charge, bool, error)
+}
+
+// RefundStore tracks refunds of cancelled registrations and the per-event
+// policies that size them.
+type RefundStore interface {
+	GetRefundByRegistrationID(ctx context.Context, registrationID uuid.UUID) (*Refund, error)
+	ListRefunds(ctx context.Context, filter RefundFilter) ([]*Refund, error)
+	ProcessRefund(ctx context.Context, params ProcessRefundParams, events ...OutboxMessage) (*Refund, error)
+	GetRefundPolicy(ctx context.Context, eventID uuid.UUID) (*RefundPolicy, error)
+	UpsertRefundPolicy(ctx context.Context, params UpsertRefundPolicyParams) (*RefundPolicy, error)
+}
+
+// EventStore manages per-event capacity and pricing and reads an event's
+// registrations in bulk.
+type EventStore interface {
+	GetEventCapacity(ctx context.Context, eventID uuid.UUID) (*EventCapacity, error)
+	UpsertEventCapacity(ctx context.Context, params UpsertEventCapacityParams) (*EventCapacity, error)
+	GetEventPricing(ctx context.Context, eventID uuid.UUID) (*EventPricing, error)
+	UpsertEventPricing(ctx context.Context, params UpsertEventPricingParams) (*EventPricing, error)
+	EachEventRegistration(ctx context.Context, eventID uuid.UUID, fn func(*RegistrationExportRow) error) error
+}
+
+// VoucherStore manages promo codes. Redemption happens in CreateRegistration.
+type VoucherStore interface {
+	CreateVoucher(ctx context.Context, params CreateVoucherParams) (*Voucher, error)
+	GetVoucher(ctx context.Context, voucherID uuid.UUID) (*Voucher, error)
+	ListVouchers(ctx context.Context, filter VoucherFilter) ([]*Voucher, error)
+	UpdateVoucher(ctx context.Context, params UpdateVoucherParams) (*Voucher, error)
+}
+
+// OrderStore registers several members under one order and records and
+// verifies the order's single payment for all of them.
+type OrderStore interface {
+	CreateOrder(ctx context.Context, params CreateOrderParams, events func(*Registration) []OutboxMessage) (*Order, error)
+	GetOrder(ctx context.Context, orderID uuid.UUID) (*Order, error)
+	CreateOrderPayment(ctx context.Context, params CreateOrderPaymentParams, events func(*Payment) []OutboxMessage) ([]*Payment, error)
+	VerifyOrderPayment(ctx context.Context, params VerifyOrderPaymentParams, events func(*Payment, *Registration) []OutboxMessage) ([]*Payment, error)
+}
+
+// ImportStore inserts registrations in bulk.
+type ImportStore interface {
+	GetEventPricing(ctx context.Context, eventID uuid.UUID) (*EventPricing, error)
+	RegisteredUserIDs(ctx context.Context, eventID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]bool, error)
+	ImportRegistrations(ctx context.Context, eventID uuid.UUID, params []CreateRegistrationParams, events func(*Registration) []OutboxMessage) ([]*Registration, error)
+}
+
+// IdempotencyStore keeps the responses of requests sent with an
+// Idempotency-Key.
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, key, requestHash string, ttl, lease time.Duration) (*IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration, limit int) (int, error)
+}
+
+// OutboxStore hands enqueued events to a publisher.
+type OutboxStore interface {
+	ProcessOutbox(ctx context.Context, limit, maxAttempts int, send func(OutboxRecord) error) (OutboxResult, error)
+	CountParkedOutbox(ctx context.Context) (int, error)
+}
+
+var (
+	_ RegistrationStore = (*Postgres)(nil)
+	_ PaymentStore      = (*Postgres)(nil)
+	_ ChargeStore       = (*Postgres)(nil)
+	_ RefundStore       = (*Postgres)(nil)
+	_ EventStore        = (*Postgres)(nil)
+	_ VoucherStore      = (*Postgres)(nil)
+	_ OrderStore        = (*Postgres)(nil)
+	_ ImportStore       = (*Postgres)(nil)
+	_ IdempotencyStore  = (*Postgres)(nil)
+	_ OutboxStore       = (*Postgres)(nil)
+
+	_ RegistrationStore = (*Memory)(nil)
+	_ PaymentStore      = (*Memory)(nil)
+	_ ChargeStore       = (*Memory)(nil)
+	_ RefundStore       = (*Memory)(nil)
+	_ EventStore        = (*Memory)(nil)
+	_ VoucherStore      = (*Memory)(nil)
+	_ OrderStore        = (*Memory)(nil)
+	_ ImportStore       = (*Memory)(nil)
+	_ IdempotencyStore  = (*Memory)(nil)
+	_ OutboxStore       = (*Memory)(nil)
+)
@@ -0,0 +1,335 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/validation"
+)
+
+var (
+	// ErrVoucherNotFound is returned by mutations targeting a voucher that
+	// does not exist.
+	ErrVoucherNotFound = errors.New("voucher not found")
+	// ErrVoucherExhausted is returned when a voucher has reached max_uses.
+	ErrVoucherExhausted = errors.New("voucher has been fully redeemed")
+	// ErrVoucherAlreadyUsed is returned when the registrant's email has
+	// already redeemed the voucher.
+	ErrVoucherAlreadyUsed = errors.New("voucher has already been used with this email")
+)
+
+// Voucher discounts the amount_due of registrations that quote its code.
+type Voucher struct {
+	VoucherID     uuid.UUID  `json:"voucher_id"`
+	Code          string     `json:"code"`
+	EventID       *uuid.UUID `json:"event_id"`
+	DiscountType  string     `json:"discount_type"`
+	DiscountValue float64    `json:"discount_value"`
+	MaxUses       *int       `json:"max_uses"`
+	UsedCount     int        `json:"used_count"`
+	ValidFrom     *time.Time `json:"valid_from"`
+	ValidUntil    *time.Time `json:"valid_until"`
+	Active        bool       `json:"active"`
+	Description   *string    `json:"description"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// NormalizeVoucherCode returns code as stored: trimmed and upper-case, so
+// codes are matched case-insensitively.
+func NormalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Discount returns what the voucher takes off price, rounded to the cent
+// and never more than price.
+func (v *Voucher) Discount(price float64) float64 {
+	discount := v.DiscountValue
+	if v.DiscountType == "percent" {
+		discount = math.Round(price*v.DiscountValue) / 100
+	}
+	return math.Min(discount, price)
+}
+
+// checkUsable reports why the voucher cannot be redeemed at t for a
+// registration of eventID, or nil if it can. Usage limits are checked
+// separately, under the voucher's row lock.
+func (v *Voucher) checkUsable(eventID uuid.UUID, t time.Time) error {
+	var message string
+	switch {
+	case !v.Active:
+		message = "is no longer active"
+	case v.EventID != nil && *v.EventID != eventID:
+		message = "is not valid for this event"
+	case v.ValidFrom != nil && t.Before(*v.ValidFrom):
+		message = "is not valid yet"
+	case v.ValidUntil != nil && !t.Before(*v.ValidUntil):
+		message = "has expired"
+	default:
+		return nil
+	}
+	return validation.Errors{{Field: "voucher_code", Message: message}}
+}
+
+var voucherCodePattern = regexp.MustCompile(`^[A-Z0-9_-]+$`)
+
+type CreateVoucherParams struct {
+	Code          string
+	EventID       *uuid.UUID
+	DiscountType  string
+	DiscountValue float64
+	MaxUses       *int
+	ValidFrom     *time.Time
+	ValidUntil    *time.Time
+	Description   *string
+}
+
+// Validate expects Code to be normalized already.
+func (p CreateVoucherParams) Validate() error {
+	var v validation.Validator
+	if v.Required("code", p.Code) {
+		v.MaxLen("code", p.Code, 50)
+		v.Check(voucherCodePattern.MatchString(p.Code), "code", "must contain only letters, digits, - and _")
+	}
+	if v.Required("discount_type", p.DiscountType) {
+		v.OneOf("discount_type", p.DiscountType, "percent", "fixed")
+	}
+	v.Check(p.DiscountValue > 0, "discount_value", "must be greater than zero")
+	switch p.DiscountType {
+	case "percent":
+		v.Check(p.DiscountValue <= 100, "discount_value", "must not exceed 100 for a percent discount")
+	case "fixed":
+		v.Check(p.DiscountValue <= MaxAmount, "discount_value", fmt.Sprintf("must not exceed %.2f", MaxAmount))
+	}
+	v.Check(p.MaxUses == nil || *p.MaxUses > 0, "max_uses", "must be positive")
+	validateValidity(&v, p.ValidFrom, p.ValidUntil)
+	return v.Err()
+}
+
+func validateValidity(v *validation.Validator, from, until *time.Time) {
+	if from != nil && until != nil {
+		v.Check(until.After(*from), "valid_until", "must be after valid_from")
+	}
+}
+
+type UpdateVoucherParams struct {
+	VoucherID   uuid.UUID
+	Active      *bool
+	MaxUses     *int
+	ValidFrom   *time.Time
+	ValidUntil  *time.Time
+	Description *string
+}
+
+// Validate checks the fields being changed. A max_uses below the voucher's
+// used_count is refused by the store.
+func (p UpdateVoucherParams) Validate() error {
+	var v validation.Validator
+	v.Check(p.MaxUses == nil || *p.MaxUses > 0, "max_uses", "must be positive")
+	validateValidity(&v, p.ValidFrom, p.ValidUntil)
+	return v.Err()
+}
+
+// VoucherFilter selects vouchers. A nil EventID matches any.
+type VoucherFilter struct {
+	EventID *uuid.UUID
+	Limit   int
+}
+
+const voucherColumns = `voucher_id, code, event_id, discount_type, discount_value, max_uses,
+			used_count, valid_from, valid_until, active, description, created_at, updated_at`
+
+func scanVoucher(row pgx.Row) (*Voucher, error) {
+	var v Voucher
+	err := row.Scan(
+		&v.VoucherID, &v.Code, &v.EventID, &v.DiscountType, &v.DiscountValue, &v.MaxUses,
+		&v.UsedCount, &v.ValidFrom, &v.ValidUntil, &v.Active, &v.Description, &v.CreatedAt, &v.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// utc converts an optional timestamp for a TIMESTAMP column.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func (r *Postgres) CreateVoucher(ctx context.Context, params CreateVoucherParams) (*Voucher, error) {
+	return scanVoucher(r.Pool.QueryRow(ctx, `
+		INSERT INTO vouchers (code, event_id, discount_type, discount_value, max_uses, valid_from, valid_until, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+voucherColumns,
+		params.Code, params.EventID, params.DiscountType, params.DiscountValue, params.MaxUses,
+		utc(params.ValidFrom), utc(params.ValidUntil), params.Description))
+}
+
+// GetVoucher returns a voucher, or nil if it does not exist.
+func (r *Postgres) GetVoucher(ctx context.Context, voucherID uuid.UUID) (*Voucher, error) {
+	v, err := scanVoucher(r.Pool.QueryRow(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE voucher_id = $1
+	`, voucherID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// ListVouchers returns vouchers, newest first. Vouchers valid for every
+// event are listed under any EventID.
+func (r *Postgres) ListVouchers(ctx context.Context, filter VoucherFilter) ([]*Voucher, error) {
+	rows, err := r.Pool.Query(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE $1::uuid IS NULL OR event_id = $1 OR event_id IS NULL
+		ORDER BY created_at DESC, voucher_id
+		LIMIT $2
+	`, filter.EventID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vouchers := []*Voucher{}
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		vouchers = append(vouchers, v)
+	}
+	return vouchers, rows.Err()
+}
+
+// UpdateVoucher changes the non-nil fields of a voucher. Its code and
+// discount are fixed once created, since registrations quote them.
+func (r *Postgres) UpdateVoucher(ctx context.Context, params UpdateVoucherParams) (*Voucher, error) {
+	v, err := scanVoucher(r.Pool.QueryRow(ctx, `
+		UPDATE vouchers
+		SET active = COALESCE($2, active),
+			max_uses = COALESCE($3, max_uses),
+			valid_from = COALESCE($4, valid_from),
+			valid_until = COALESCE($5, valid_until),
+			description = COALESCE($6, description),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE voucher_id = $1
+		RETURNING `+voucherColumns,
+		params.VoucherID, params.Active, params.MaxUses, utc(params.ValidFrom), utc(params.ValidUntil), params.Description))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrVoucherNotFound
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// redeemVoucher takes one use of the voucher with code for a registration
+// of eventID by email, priced at amountDue, and returns the voucher and the
+// discount. The voucher row stays locked until tx ends, so concurrent
+// redemptions queue up and max_uses and the one-use-per-email rule hold.
+// The caller records the redemption once the registration exists.
+func redeemVoucher(ctx context.Context, tx pgx.Tx, code string, eventID uuid.UUID, email string, amountDue *float64) (*Voucher, float64, error) {
+	v, err := scanVoucher(tx.QueryRow(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		WHERE code = $1
+		FOR UPDATE
+	`, code))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, 0, validation.Errors{{Field: "voucher_code", Message: "does not exist"}}
+		}
+		return nil, 0, err
+	}
+	if err := v.checkUsable(eventID, time.Now()); err != nil {
+		return nil, 0, err
+	}
+	if amountDue == nil {
+		return nil, 0, validation.Errors{{Field: "voucher_code", Message: "cannot be used for an event without pricing"}}
+	}
+	if v.MaxUses != nil && v.UsedCount >= *v.MaxUses {
+		return nil, 0, ErrVoucherExhausted
+	}
+	var used bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM voucher_redemptions
+			WHERE voucher_id = $1 AND lower(email) = lower($2)
+		)
+	`, v.VoucherID, email).Scan(&used)
+	if err != nil {
+		return nil, 0, err
+	}
+	if used {
+		return nil, 0, ErrVoucherAlreadyUsed
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE vouchers
+		SET used_count = used_count + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE voucher_id = $1
+	`, v.VoucherID); err != nil {
+		return nil, 0, err
+	}
+	return v, v.Discount(*amountDue), nil
+}
+
+// recordRedemption ties a redeemed voucher to the registration that used it.
+func recordRedemption(ctx context.Context, tx pgx.Tx, v *Voucher, reg *Registration) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO voucher_redemptions (voucher_id, registration_id, email, discount_amount)
+		VALUES ($1, $2, $3, $4)
+	`, v.VoucherID, reg.RegistrationID, reg.Email, reg.DiscountAmount)
+	return err
+}
+
+// releaseVouchers gives back the voucher uses of registrations that were
+// cancelled or rejected, so the codes count them no more and their emails
+// may redeem them again. The registrations keep voucher_code and
+// discount_amount as a record of what they were offered. Vouchers are
+// locked in voucher_id order so concurrent releases cannot deadlock.
+func releaseVouchers(ctx context.Context, tx pgx.Tx, registrationIDs []uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `
+		SELECT voucher_id
+		FROM vouchers
+		WHERE voucher_id IN (
+			SELECT voucher_id FROM voucher_redemptions WHERE registration_id = ANY($1)
+		)
+		ORDER BY voucher_id
+		FOR UPDATE
+	`, registrationIDs); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		WITH released AS (
+			DELETE FROM voucher_redemptions
+			WHERE registration_id = ANY($1)
+			RETURNING voucher_id
+		)
+		UPDATE vouchers v
+		SET used_count = v.used_count - r.uses,
+			updated_at = CURRENT_TIMESTAMP
+		FROM (SELECT voucher_id, COUNT(*) AS uses FROM released GROUP BY voucher_id) r
+		WHERE v.voucher_id = r.voucher_id
+	`, registrationIDs)
+	return err
+}
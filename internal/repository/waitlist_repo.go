@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrWaitlistPromotion is returned when a waitlisted registration is moved
+// to pending directly. Promotion goes through promoteWaitlisted, which
+// checks for a free seat, keeps the queue order and sets a payment deadline.
+var ErrWaitlistPromotion = errors.New("waitlisted registrations are only promoted when a seat frees up")
+
+// nextWaitlistPosition returns the position for a new waitlist entry. It
+// must run while the event's capacity row is locked.
+func nextWaitlistPosition(ctx context.Context, tx pgx.Tx, eventID uuid.UUID) (int, error) {
+	var pos int
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(waitlist_position), 0) + 1
+		FROM registrations
+		WHERE event_id = $1 AND status = 'waitlisted'
+	`, eventID).Scan(&pos)
+	return pos, err
+}
+
+// promoteWaitlisted moves waitlisted registrations of an event to pending,
+// in queue order, for as long as seats are free. Someone whose gender quota
+// is full is skipped so the next person of the other gender can take a
+// seat. Each promotion gets a payment deadline and a registration.promoted
+// event.
+func (r *Postgres) promoteWaitlisted(ctx context.Context, tx pgx.Tx, eventID uuid.UUID) ([]*Registration, error) {
+	ec, err := getEventCapacity(ctx, tx, eventID, true)
+	if err != nil {
+		return nil, err
+	}
+	pricing, err := getEventPricing(ctx, tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+registrationColumns+`
+		FROM registrations
+		WHERE event_id = $1 AND status = 'waitlisted'
+		ORDER BY waitlist_position, created_at
+		FOR UPDATE
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := scanRegistrations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var promoted []*Registration
+	for _, c := range queue {
+		if ec != nil {
+			err := ec.seatAvailable(c.Gender)
+			if err == ErrEventFull {
+				break
+			}
+			if err != nil {
+				continue
+			}
+		}
+
+		reg, err := scanRegistration(tx.QueryRow(ctx, `
+			UPDATE registrations
+			SET status = 'pending',
+				waitlist_position = NULL,
+				payment_due_at = `+paymentDueAt("event_id", "$2")+`,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE registration_id = $1
+			RETURNING `+registrationColumns,
+			c.RegistrationID, r.DefaultPaymentWindowHours,
+		))
+		if err != nil {
+			return nil, err
+		}
+		if reg, err = scheduleInstallments(ctx, tx, reg, pricing); err != nil {
+			return nil, err
+		}
+		if err := auditRegistration(ctx, tx, "registration.promoted", c, reg); err != nil {
+			return nil, err
+		}
+
+		if ec != nil {
+			ec.takeSeat(reg.Gender)
+		}
+
+		if err := enqueueOutbox(ctx, tx, []OutboxMessage{registrationPromotedEvent(r.PromotedTopic, reg)}); err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, reg)
+	}
+	return promoted, nil
+}
+
+// registrationPromotedEvent builds the registration.promoted message for a
+// registration that just left the waitlist.
+func registrationPromotedEvent(topic string, reg *Registration) OutboxMessage {
+	return Event(topic, reg.RegistrationID.String(), "registration.promoted", map[string]any{
+		"registration_id": reg.RegistrationID,
+		"event_id":        reg.EventID,
+		"user_id":         reg.UserID,
+		"full_name":       reg.FullName,
+		"gender":          reg.Gender,
+		"status":          reg.Status,
+		"payment_due_at":  reg.PaymentDueAt,
+		"timestamp":       time.Now().UTC().Format(time.RFC3339),
+	})
+}
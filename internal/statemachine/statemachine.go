@@ -0,0 +1,86 @@
+// Package statemachine defines the registration lifecycle and the status
+// transitions that are allowed between its states.
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Status string
+
+const (
+	Pending   Status = "pending"
+	Paid      Status = "paid"
+	Confirmed Status = "confirmed"
+	Cancelled Status = "cancelled"
+	Rejected  Status = "rejected"
+	// Waitlisted registrations hold no seat until promoted to Pending.
+	Waitlisted Status = "waitlisted"
+	// PartiallyPaid registrations have had part of their amount_due approved
+	// and owe the rest, e.g. further installments.
+	PartiallyPaid Status = "partially_paid"
+)
+
+// ErrUnknownStatus is returned by Parse for values outside registration_status.
+var ErrUnknownStatus = errors.New("unknown registration status")
+
+// transitions lists, for each status, the statuses it may move to.
+var transitions = map[Status][]Status{
+	Pending:       {Paid, Confirmed, Cancelled, Rejected},
+	Paid:          {Pending, PartiallyPaid, Confirmed, Cancelled, Rejected},
+	PartiallyPaid: {Paid, Confirmed, Cancelled, Rejected},
+	Confirmed:     {Cancelled},
+	Cancelled:     {},
+	Rejected:      {},
+	Waitlisted:    {Pending, Cancelled},
+}
+
+// TransitionError reports an attempt to move a registration between two
+// statuses that the lifecycle does not allow.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change registration status from %s to %s", e.From, e.To)
+}
+
+// Parse validates s against the known statuses.
+func Parse(s string) (Status, error) {
+	st := Status(s)
+	if _, ok := transitions[st]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, s)
+	}
+	return st, nil
+}
+
+func CanTransition(from, to Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Sources returns every status from which a registration may move to to.
+// Repositories use it to guard updates with WHERE status = ANY(...).
+func Sources(to Status) []string {
+	var from []string
+	for _, st := range []Status{Pending, Paid, PartiallyPaid, Confirmed, Cancelled, Rejected, Waitlisted} {
+		if CanTransition(st, to) {
+			from = append(from, string(st))
+		}
+	}
+	return from
+}
+
+// Validate returns a *TransitionError if from cannot move to to.
+func Validate(from, to Status) error {
+	if !CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/miftahulhidayati/registration-payment-service/internal/config"
+)
+
+// FilesURLPrefix is the API route stored files are served from, to callers
+// allowed to see what they belong to. It is the default base of the URLs
+// Save returns.
+const FilesURLPrefix = "/api/v1/files"
+
+// ErrNotFound is returned by Open for a key nothing is stored under.
+var ErrNotFound = errors.New("file not found")
+
+// Storage persists uploaded files and returns a URL they can be fetched from.
+type Storage interface {
+	Save(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error)
+	// Open returns the content of the file stored under key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key, if there is one.
+	Delete(ctx context.Context, key string) error
+}
+
+// New builds the Storage selected by STORAGE_DRIVER.
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "local":
+		publicURL := cfg.StoragePublicURL
+		if publicURL == "" {
+			publicURL = FilesURLPrefix
+		}
+		return NewLocal(cfg.StorageLocalDir, publicURL)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:     cfg.S3Endpoint,
+			Region:       cfg.S3Region,
+			Bucket:       cfg.S3Bucket,
+			AccessKey:    cfg.S3AccessKey,
+			SecretKey:    cfg.S3SecretKey,
+			UsePathStyle: cfg.S3UsePathStyle,
+			PublicURL:    cfg.StoragePublicURL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
@@ -0,0 +1,117 @@
+// Package validation checks request fields and collects every problem found
+// instead of stopping at the first one.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes one invalid field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is returned when one or more fields are invalid.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validator accumulates field errors. The zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+// Add records an error for field.
+func (v *Validator) Add(field, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// Check records message for field unless ok.
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Add(field, message)
+	}
+}
+
+// Err returns the collected errors, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Required reports whether value is non-blank, recording an error if not.
+func (v *Validator) Required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, "is required")
+		return false
+	}
+	return true
+}
+
+// MaxLen checks that value has at most n characters.
+func (v *Validator) MaxLen(field, value string, n int) {
+	if utf8.RuneCountInString(value) > n {
+		v.Add(field, fmt.Sprintf("must be at most %d characters", n))
+	}
+}
+
+// OneOf checks that value is one of allowed.
+func (v *Validator) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, "must be one of "+strings.Join(allowed, ", "))
+}
+
+// Email checks that value is a bare email address.
+func (v *Validator) Email(field, value string) {
+	if !IsEmail(value) {
+		v.Add(field, "must be a valid email address")
+	}
+}
+
+// Phone checks that value is an Indonesian mobile number.
+func (v *Validator) Phone(field, value string) {
+	if !IsPhone(value) {
+		v.Add(field, "must be an Indonesian mobile number, e.g. 08123456789 or +628123456789")
+	}
+}
+
+// IsEmail reports whether s is a plain address such as name@example.com,
+// without a display name or angle brackets.
+func IsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return false
+	}
+	at := strings.LastIndexByte(s, '@')
+	return strings.Contains(s[at+1:], ".")
+}
+
+// phoneSeparators are accepted between digits and ignored.
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+// Mobile numbers start with 8 after the 0 or 62 prefix and have 9 to 12
+// digits after it.
+var mobilePattern = regexp.MustCompile(`^(\+62|62|0)8[1-9][0-9]{7,10}$`)
+
+// IsPhone reports whether s is an Indonesian mobile number in local (08...)
+// or international (+628... / 628...) form.
+func IsPhone(s string) bool {
+	return mobilePattern.MatchString(phoneSeparators.Replace(s))
+}
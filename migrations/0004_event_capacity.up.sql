@@ -0,0 +1,10 @@
+-- Seat limits per event. A NULL quota means unlimited; events without a row
+-- accept any number of registrations.
+CREATE TABLE IF NOT EXISTS event_capacity (
+    event_id UUID PRIMARY KEY,
+    total_quota INT CHECK (total_quota >= 0),
+    male_quota INT CHECK (male_quota >= 0),
+    female_quota INT CHECK (female_quota >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
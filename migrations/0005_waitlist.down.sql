@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_registrations_waitlist;
+
+ALTER TABLE registrations
+    DROP COLUMN IF EXISTS payment_due_at,
+    DROP COLUMN IF EXISTS waitlist_position;
+
+-- Postgres cannot drop a value from an enum; move waitlisted rows to cancelled
+-- so the value is unused. Recreating the type would require rewriting the column.
+UPDATE registrations SET status = 'cancelled', cancellation_reason = 'waitlist removed' WHERE status = 'waitlisted';
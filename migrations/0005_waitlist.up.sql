@@ -0,0 +1,7 @@
+ALTER TYPE registration_status ADD VALUE IF NOT EXISTS 'waitlisted';
+
+ALTER TABLE registrations
+    ADD COLUMN IF NOT EXISTS waitlist_position INT,
+    ADD COLUMN IF NOT EXISTS payment_due_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_registrations_waitlist ON registrations(event_id, waitlist_position) WHERE waitlist_position IS NOT NULL;
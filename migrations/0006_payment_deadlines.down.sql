@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_registrations_payment_due;
+
+ALTER TABLE event_capacity
+    DROP COLUMN IF EXISTS payment_window_hours;
@@ -0,0 +1,5 @@
+-- Per-event payment window; NULL falls back to PAYMENT_WINDOW_HOURS
+ALTER TABLE event_capacity
+    ADD COLUMN IF NOT EXISTS payment_window_hours INT CHECK (payment_window_hours > 0);
+
+CREATE INDEX IF NOT EXISTS idx_registrations_payment_due ON registrations(payment_due_at) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_payments_registration_created;
+DROP INDEX IF EXISTS idx_registrations_event_created;
+DROP INDEX IF EXISTS idx_registrations_name_keyset;
+DROP INDEX IF EXISTS idx_registrations_date_keyset;
+DROP INDEX IF EXISTS idx_registrations_updated_keyset;
+DROP INDEX IF EXISTS idx_registrations_created_keyset;
@@ -0,0 +1,9 @@
+-- Keyset pagination on the registration list: (sort column, registration_id)
+CREATE INDEX IF NOT EXISTS idx_registrations_created_keyset ON registrations(created_at, registration_id);
+CREATE INDEX IF NOT EXISTS idx_registrations_updated_keyset ON registrations(updated_at, registration_id);
+CREATE INDEX IF NOT EXISTS idx_registrations_date_keyset ON registrations(registration_date, registration_id);
+CREATE INDEX IF NOT EXISTS idx_registrations_name_keyset ON registrations(full_name, registration_id);
+CREATE INDEX IF NOT EXISTS idx_registrations_event_created ON registrations(event_id, created_at, registration_id);
+
+-- Latest payment per registration (payment_status filter)
+CREATE INDEX IF NOT EXISTS idx_payments_registration_created ON payments(registration_id, created_at DESC);
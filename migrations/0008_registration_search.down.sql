@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_registrations_phone_trgm;
+DROP INDEX IF EXISTS idx_registrations_email_trgm;
+DROP INDEX IF EXISTS idx_registrations_name_trgm;
+DROP INDEX IF EXISTS idx_registrations_search;
+
+ALTER TABLE registrations
+    DROP COLUMN IF EXISTS search_vector,
+    DROP COLUMN IF EXISTS phone_normalized;
+
+DROP FUNCTION IF EXISTS normalize_phone_id(TEXT);
@@ -0,0 +1,28 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Canonical Indonesian phone number: digits only with the 62 country code,
+-- so 0812..., +62 812... and 812... all compare equal
+CREATE OR REPLACE FUNCTION normalize_phone_id(phone TEXT) RETURNS TEXT
+LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+    SELECT CASE
+        WHEN d LIKE '62%' THEN d
+        WHEN d LIKE '0%' THEN '62' || substr(d, 2)
+        WHEN d LIKE '8%' THEN '62' || d
+        ELSE d
+    END
+    FROM (SELECT regexp_replace(COALESCE(phone, ''), '\D', '', 'g') AS d) s
+$$;
+
+ALTER TABLE registrations
+    ADD COLUMN IF NOT EXISTS phone_normalized TEXT
+        GENERATED ALWAYS AS (normalize_phone_id(phone)) STORED,
+    ADD COLUMN IF NOT EXISTS search_vector tsvector
+        GENERATED ALWAYS AS (
+            setweight(to_tsvector('simple', COALESCE(full_name, '')), 'A') ||
+            setweight(to_tsvector('simple', COALESCE(email, '')), 'B')
+        ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_registrations_search ON registrations USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_registrations_name_trgm ON registrations USING GIN (full_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_registrations_email_trgm ON registrations USING GIN (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_registrations_phone_trgm ON registrations USING GIN (phone_normalized gin_trgm_ops);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_refunds_event_status;
+DROP INDEX IF EXISTS idx_refunds_registration;
+
+DROP TABLE IF EXISTS refunds;
+DROP TABLE IF EXISTS refund_policies;
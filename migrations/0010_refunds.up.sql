@@ -0,0 +1,35 @@
+-- Refund rules per event. rules is a JSON array of
+-- {"days_before": N, "percent": P}: cancelling at least N days before
+-- event_starts_at refunds P% of the approved payment. The applicable rule
+-- with the largest N wins; events without a policy refund in full.
+CREATE TABLE IF NOT EXISTS refund_policies (
+    event_id UUID PRIMARY KEY,
+    event_starts_at TIMESTAMP NOT NULL,
+    rules JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Money owed back for an approved payment whose registration was cancelled.
+-- Refunds are opened as pending and marked processed by finance.
+CREATE TABLE IF NOT EXISTS refunds (
+    refund_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments(payment_id) ON DELETE CASCADE,
+    registration_id UUID NOT NULL REFERENCES registrations(registration_id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    percent INT NOT NULL CHECK (percent > 0 AND percent <= 100),
+    refund_type VARCHAR(16) NOT NULL CHECK (refund_type IN ('full', 'partial')),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processed')),
+    refund_proof_url VARCHAR(500),
+    refund_proof_filename VARCHAR(255),
+    notes TEXT,
+    processed_by UUID,
+    processed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_refund_payment UNIQUE (payment_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_registration ON refunds(registration_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_event_status ON refunds(event_id, status, created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS amount_status;
+
+ALTER TABLE registrations
+    DROP COLUMN IF EXISTS amount_due,
+    DROP COLUMN IF EXISTS category;
+
+DROP TABLE IF EXISTS event_pricing;
@@ -0,0 +1,27 @@
+-- What registering for an event costs. categories is a JSON array of
+-- {"category": C, "price": P} overriding the price for registrants of
+-- category C; early_bird is a JSON array of
+-- {"name": N, "ends_at": T, "discount_percent": D} taking D% off
+-- registrations made before T. Events without pricing charge nothing
+-- through this service and leave amount_due empty.
+CREATE TABLE IF NOT EXISTS event_pricing (
+    event_id UUID PRIMARY KEY,
+    base_price DECIMAL(10,2) NOT NULL CHECK (base_price >= 0),
+    male_price DECIMAL(10,2) CHECK (male_price >= 0),
+    female_price DECIMAL(10,2) CHECK (female_price >= 0),
+    categories JSONB NOT NULL DEFAULT '[]',
+    early_bird JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The price is fixed when the registration is created, so later pricing
+-- changes do not move what a registrant owes.
+ALTER TABLE registrations
+    ADD COLUMN IF NOT EXISTS category VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS amount_due DECIMAL(10,2);
+
+-- How a payment compares with the registration's amount_due, when it has one.
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS amount_status VARCHAR(16)
+        CHECK (amount_status IN ('exact', 'underpaid', 'overpaid'));
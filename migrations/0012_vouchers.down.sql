@@ -0,0 +1,9 @@
+ALTER TABLE registrations
+    DROP COLUMN IF EXISTS discount_amount,
+    DROP COLUMN IF EXISTS voucher_code;
+
+DROP INDEX IF EXISTS unique_voucher_email;
+DROP TABLE IF EXISTS voucher_redemptions;
+
+DROP INDEX IF EXISTS idx_vouchers_event;
+DROP TABLE IF EXISTS vouchers;
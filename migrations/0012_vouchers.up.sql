@@ -0,0 +1,43 @@
+-- Promo codes, e.g. from sponsors. A NULL event_id makes the code valid for
+-- every event; a NULL max_uses, valid_from or valid_until leaves that limit
+-- off. used_count is incremented under a row lock when a registration
+-- redeems the code, so the check below never fires in practice.
+CREATE TABLE IF NOT EXISTS vouchers (
+    voucher_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(50) NOT NULL,
+    event_id UUID,
+    discount_type VARCHAR(16) NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    discount_value DECIMAL(10,2) NOT NULL CHECK (discount_value > 0),
+    max_uses INT CHECK (max_uses > 0),
+    used_count INT NOT NULL DEFAULT 0,
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    description TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_voucher_code UNIQUE (code),
+    CONSTRAINT voucher_usage_limit CHECK (max_uses IS NULL OR used_count <= max_uses),
+    CONSTRAINT voucher_percent_range CHECK (discount_type <> 'percent' OR discount_value <= 100),
+    CONSTRAINT voucher_validity CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_until > valid_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_event ON vouchers(event_id, created_at);
+
+-- One row per registration that used a voucher. The unique index keeps each
+-- code to a single use per email address.
+CREATE TABLE IF NOT EXISTS voucher_redemptions (
+    voucher_id UUID NOT NULL REFERENCES vouchers(voucher_id) ON DELETE CASCADE,
+    registration_id UUID NOT NULL REFERENCES registrations(registration_id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    discount_amount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (voucher_id, registration_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS unique_voucher_email ON voucher_redemptions(voucher_id, lower(email));
+
+-- amount_due is what is left after discount_amount is taken off the price.
+ALTER TABLE registrations
+    ADD COLUMN IF NOT EXISTS voucher_code VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS discount_amount DECIMAL(10,2);
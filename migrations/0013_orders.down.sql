@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_payments_order;
+ALTER TABLE payments DROP COLUMN IF EXISTS order_id;
+
+DROP INDEX IF EXISTS idx_registrations_order;
+ALTER TABLE registrations DROP COLUMN IF EXISTS order_id;
+
+DROP INDEX IF EXISTS idx_orders_payer;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,24 @@
+-- An order groups the registrations of several members, e.g. a family, for
+-- one event under a single payer who pays them with one transfer. Each
+-- member keeps its own registration and, once paid, its own payment row;
+-- payments of an order share order_id and proof.
+CREATE TABLE IF NOT EXISTS orders (
+    order_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_id UUID NOT NULL,
+    payer_user_id UUID,
+    payer_name VARCHAR(255) NOT NULL,
+    payer_email VARCHAR(255) NOT NULL,
+    payer_phone VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_payer ON orders(payer_user_id);
+
+ALTER TABLE registrations
+    ADD COLUMN IF NOT EXISTS order_id UUID REFERENCES orders(order_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_registrations_order ON registrations(order_id) WHERE order_id IS NOT NULL;
+
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS order_id UUID REFERENCES orders(order_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(order_id) WHERE order_id IS NOT NULL;
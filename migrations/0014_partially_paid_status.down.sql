@@ -0,0 +1,3 @@
+-- Postgres cannot drop a value from an enum; move partially paid rows back to
+-- pending so the value is unused. They still owe the rest of amount_due.
+UPDATE registrations SET status = 'pending' WHERE status = 'partially_paid';
@@ -0,0 +1,3 @@
+-- Kept apart from the installment columns: a new enum value cannot be used
+-- in the transaction that adds it.
+ALTER TYPE registration_status ADD VALUE IF NOT EXISTS 'partially_paid';
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_registrations_payment_due;
+CREATE INDEX IF NOT EXISTS idx_registrations_payment_due ON registrations(payment_due_at) WHERE status = 'pending';
+
+ALTER TABLE event_pricing DROP COLUMN IF EXISTS installments;
+
+ALTER TABLE registrations
+    DROP COLUMN IF EXISTS installments,
+    DROP COLUMN IF EXISTS balance,
+    DROP COLUMN IF EXISTS amount_paid;
@@ -0,0 +1,27 @@
+-- What has been approved towards amount_due, and what is left of it.
+-- installments is the registration's payment schedule, a JSON array of
+-- {"amount": A, "due_at": T}, or NULL when amount_due is paid in one go.
+ALTER TABLE registrations
+    ADD COLUMN IF NOT EXISTS amount_paid DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS balance DECIMAL(10,2) GENERATED ALWAYS AS (amount_due - amount_paid) STORED,
+    ADD COLUMN IF NOT EXISTS installments JSONB;
+
+UPDATE registrations r
+SET amount_paid = p.total
+FROM (
+    SELECT registration_id, SUM(amount) AS total
+    FROM payments
+    WHERE verification_status = 'approved'
+    GROUP BY registration_id
+) p
+WHERE p.registration_id = r.registration_id;
+
+-- An event's installment plan, a JSON array of {"percent": P, "due_at": T}:
+-- P% of the price is due by T. An empty plan asks for the whole price
+-- within the payment window.
+ALTER TABLE event_pricing
+    ADD COLUMN IF NOT EXISTS installments JSONB NOT NULL DEFAULT '[]';
+
+-- Partially paid registrations expire too when an installment is missed
+DROP INDEX IF EXISTS idx_registrations_payment_due;
+CREATE INDEX IF NOT EXISTS idx_registrations_payment_due ON registrations(payment_due_at) WHERE status IN ('pending', 'partially_paid');
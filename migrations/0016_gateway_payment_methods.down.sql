@@ -0,0 +1,3 @@
+-- Postgres cannot drop a value from an enum; move rows using the gateway
+-- methods to other so the values are unused.
+UPDATE payments SET payment_method = 'other' WHERE payment_method IN ('virtual_account', 'qris');
@@ -0,0 +1,5 @@
+-- Methods collected through a payment gateway (ewallet already exists). Kept
+-- apart from the charge tables: a new enum value cannot be used in the
+-- transaction that adds it.
+ALTER TYPE payment_method ADD VALUE IF NOT EXISTS 'virtual_account';
+ALTER TYPE payment_method ADD VALUE IF NOT EXISTS 'qris';
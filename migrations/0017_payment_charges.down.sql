@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payment_webhooks;
+
+DROP INDEX IF EXISTS idx_payment_charges_registration;
+DROP TABLE IF EXISTS payment_charges;
@@ -0,0 +1,34 @@
+-- Charges created with a payment gateway. The payer completes a charge out
+-- of band (virtual account transfer, QRIS scan, e-wallet checkout) and the
+-- gateway reports the outcome to POST /webhooks/payments/{provider}. A paid
+-- charge records the approved payment it created.
+CREATE TABLE IF NOT EXISTS payment_charges (
+    charge_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    registration_id UUID NOT NULL REFERENCES registrations(registration_id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    provider_charge_id VARCHAR(100) NOT NULL,
+    payment_method payment_method NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    payment_code VARCHAR(500) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'paid', 'expired', 'failed')),
+    expires_at TIMESTAMP,
+    payment_id UUID REFERENCES payments(payment_id) ON DELETE SET NULL,
+    paid_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_provider_charge UNIQUE (provider, provider_charge_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_charges_registration ON payment_charges(registration_id, created_at);
+
+-- Webhook events already applied, so a redelivery is acknowledged without
+-- being applied twice.
+CREATE TABLE IF NOT EXISTS payment_webhooks (
+    provider VARCHAR(32) NOT NULL,
+    event_id VARCHAR(100) NOT NULL,
+    provider_charge_id VARCHAR(100) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    payload JSONB NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, event_id)
+);
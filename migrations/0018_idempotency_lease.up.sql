@@ -0,0 +1,4 @@
+-- How long an incomplete reservation holds its key; a request that died
+-- before completing can be retried once this has passed
+ALTER TABLE idempotency_keys
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
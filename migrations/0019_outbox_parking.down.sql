@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_outbox_parked;
+DROP INDEX IF EXISTS idx_outbox_unsent;
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox(id) WHERE sent_at IS NULL;
+
+ALTER TABLE outbox
+    DROP COLUMN IF EXISTS parked_at;
@@ -0,0 +1,8 @@
+-- Messages that failed OUTBOX_MAX_ATTEMPTS times are parked: the relay stops
+-- retrying them and moves on to the rest of their key
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS parked_at TIMESTAMP;
+
+DROP INDEX IF EXISTS idx_outbox_unsent;
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox(message_key, id) WHERE sent_at IS NULL AND parked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_parked ON outbox(parked_at) WHERE parked_at IS NOT NULL;
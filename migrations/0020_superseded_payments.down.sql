@@ -0,0 +1,3 @@
+-- Postgres cannot drop a value from an enum; move superseded payments to
+-- rejected so the value is unused. They were never verified.
+UPDATE payments SET verification_status = 'rejected' WHERE verification_status = 'superseded';
@@ -0,0 +1,4 @@
+-- A payment still pending when a newer one is uploaded for the same
+-- registration is superseded by it. Kept apart from the backfill: a new enum
+-- value cannot be used in the transaction that adds it.
+ALTER TYPE payment_verification_status ADD VALUE IF NOT EXISTS 'superseded';
@@ -0,0 +1 @@
+UPDATE payments SET verification_status = 'pending' WHERE verification_status = 'superseded';
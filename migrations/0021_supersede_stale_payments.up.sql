@@ -0,0 +1,11 @@
+-- Supersede the pending payments left behind by a newer upload before
+-- 0020, which could no longer be verified.
+UPDATE payments p
+SET verification_status = 'superseded',
+    updated_at = CURRENT_TIMESTAMP
+WHERE p.verification_status = 'pending'
+  AND EXISTS (
+    SELECT 1 FROM payments newer
+    WHERE newer.registration_id = p.registration_id
+      AND newer.created_at > p.created_at
+  );
@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations so the binaries can apply
+// them without the files on disk. Files are named
+// NNNN_description.up.sql / NNNN_description.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS